@@ -0,0 +1,72 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// object storage for uploaded files
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error) // body and content type
+	Delete(ctx context.Context, key string) error
+	URL(key string) string // address clients use to fetch the object
+}
+
+// route that proxies objects when no public url is configured
+const defaultPublicURL = "/media/files"
+
+// builds a store from BLOB_BACKEND => local (default) or s3
+func NewStoreFromEnv() (Store, error) {
+	publicURL := strings.TrimSuffix(os.Getenv("BLOB_PUBLIC_URL"), "/")
+	if publicURL == "" {
+		publicURL = defaultPublicURL
+	}
+
+	switch os.Getenv("BLOB_BACKEND") {
+	case "", "local":
+		dir := os.Getenv("BLOB_LOCAL_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return NewLocalStore(dir, publicURL)
+
+	case "s3":
+		store := &S3Store{
+			Endpoint:  strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PublicURL: publicURL,
+		}
+		if store.Region == "" {
+			store.Region = "us-east-1"
+		}
+		if store.Endpoint == "" || store.Bucket == "" || store.AccessKey == "" || store.SecretKey == "" {
+			return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY must be set")
+		}
+		return store, nil
+
+	default:
+		return nil, errors.New("unknown BLOB_BACKEND, must be 'local' or 's3'")
+	}
+}
+
+// rejects keys that could escape the store namespace
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
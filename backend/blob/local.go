@@ -0,0 +1,80 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// stores objects as files below a directory => local development
+type LocalStore struct {
+	Dir       string
+	PublicURL string
+}
+
+func NewLocalStore(dir, publicURL string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{Dir: dir, PublicURL: publicURL}, nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !validKey(key) {
+		return errors.New("invalid blob key")
+	}
+
+	filePath := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+
+	// write then rename so readers never see a partial file
+	tmp := filePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filePath)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	if !validKey(key) {
+		return nil, "", ErrNotFound
+	}
+
+	file, err := os.Open(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// content type is derived from the key extension
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return file, contentType, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return errors.New("invalid blob key")
+	}
+
+	err := os.Remove(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.PublicURL + "/" + key
+}
@@ -0,0 +1,70 @@
+// reconcile recomputes ticket availability from holds and bookings and reports any drift
+//
+//	DATABASE_URL=postgres://... go run ./cmd/reconcile [-conference 12] [-fix]
+//
+// it exits with status 1 when drift was found and not fixed, so it can run from cron
+package main
+
+import (
+	"backend/query"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func main() {
+	conferenceID := flag.Uint("conference", 0, "only check this conference")
+	fix := flag.Bool("fix", false, "store the recomputed availability")
+	flag.Parse()
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL not set in .env or environment")
+	}
+
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	drifts, err := query.ReconcileInventory(ctx, db, uint32(*conferenceID), *fix)
+	if err != nil {
+		log.Fatalf("Reconciling inventory: %v", err)
+	}
+
+	if len(drifts) == 0 {
+		fmt.Println("no drift")
+		return
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(out, "conference\tticket type\tquota\theld\tbooked\tstored\texpected\tdrift\t")
+	for _, drift := range drifts {
+		fmt.Fprintf(out, "%d %s\t%d %s\t%d\t%d\t%d\t%d\t%d\t%+d\t\n",
+			drift.ConferenceID, drift.Conference,
+			drift.TicketTypeID, drift.TicketType,
+			drift.Quota, drift.Held, drift.Booked,
+			drift.Stored, drift.Expected, drift.Stored-drift.Expected,
+		)
+	}
+	out.Flush()
+
+	for _, drift := range drifts {
+		if drift.Expected < 0 {
+			fmt.Printf("ticket type %d is oversold by %d tickets\n", drift.TicketTypeID, -drift.Expected)
+		}
+	}
+
+	if *fix {
+		fmt.Printf("fixed %d ticket types\n", len(drifts))
+		return
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"backend/middleware"
+	"backend/models"
+	"backend/money"
+	"backend/query"
+	"backend/scheduler"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AdminHandler struct {
+	DB        *pgxpool.Pool
+	Scheduler *scheduler.Scheduler
+}
+
+func NewAdminHandler(db *pgxpool.Pool, sched *scheduler.Scheduler) *AdminHandler {
+	return &AdminHandler{DB: db, Scheduler: sched}
+}
+
+// admin only routes
+func (h *AdminHandler) RegisterRoutes(r chi.Router) {
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(middleware.JWTAuthMiddleware)
+		r.Use(middleware.RequireRole("admin"))
+
+		r.Get("/jobs", h.GetJobs)
+		r.Get("/jobs/runs", h.GetJobRuns)
+
+		r.Post("/users/{id}/restore", h.RestoreUser)
+		r.Post("/conferences/{id}/restore", h.RestoreConference)
+		r.Post("/bookings/{id}/restore", h.RestoreBooking)
+
+		r.Get("/tax-countries", h.GetTaxCountries)
+		r.Put("/tax-countries", h.SaveTaxCountry)
+		r.Get("/tax-rates", h.GetTaxRates)
+		r.Post("/tax-rates", h.CreateTaxRate)
+
+		r.Get("/exchange-rates", h.GetExchangeRates)
+		r.Put("/exchange-rates", h.SaveExchangeRates)
+	})
+}
+
+// scheduler state of this replica
+func (h *AdminHandler) GetJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"instance": h.Scheduler.Instance(),
+		"leader":   h.Scheduler.IsLeader(),
+		"jobs":     h.Scheduler.Status(),
+	})
+}
+
+// persisted job runs of every replica
+func (h *AdminHandler) GetJobRuns(w http.ResponseWriter, r *http.Request) {
+	// parse query param ?limit=
+	limit := 50 // default
+	if val := r.URL.Query().Get("limit"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			limit = parsed
+		}
+	}
+
+	runs, err := query.GetRecentJobRuns(r.Context(), h.DB, limit)
+	if err != nil {
+		http.Error(w, jobRunsFetchError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// restore soft deleted user
+func (h *AdminHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	idString := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, invalidUserError, http.StatusBadRequest)
+		return
+	}
+
+	err = query.RestoreUser(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, restoreError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("User restored successfully"))
+}
+
+// restore soft deleted conference
+func (h *AdminHandler) RestoreConference(w http.ResponseWriter, r *http.Request) {
+	idString := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	err = query.RestoreConference(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, restoreError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Conference restored successfully"))
+}
+
+// restore soft deleted booking
+func (h *AdminHandler) RestoreBooking(w http.ResponseWriter, r *http.Request) {
+	idString := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, bookingIDError, http.StatusBadRequest)
+		return
+	}
+
+	err = query.RestoreBooking(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, restoreError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Booking restored successfully"))
+}
+
+// countries with their tax area and tax id format
+func (h *AdminHandler) GetTaxCountries(w http.ResponseWriter, r *http.Request) {
+	countries, err := query.GetTaxCountries(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, taxRatesError+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(countries)
+}
+
+// add or update a country
+func (h *AdminHandler) SaveTaxCountry(w http.ResponseWriter, r *http.Request) {
+	var country models.TaxCountry
+	if err := json.NewDecoder(r.Body).Decode(&country); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	err := query.SaveTaxCountry(r.Context(), h.DB, &country)
+	if err != nil {
+		http.Error(w, taxRatesError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(country)
+}
+
+// rate history, optionally of one country with ?country=
+func (h *AdminHandler) GetTaxRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := query.GetTaxRates(r.Context(), h.DB, r.URL.Query().Get("country"))
+	if err != nil {
+		http.Error(w, taxRatesError+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+// add a rate from a date, the current rate ends where the new one starts
+func (h *AdminHandler) CreateTaxRate(w http.ResponseWriter, r *http.Request) {
+	var rate models.TaxRate
+	if err := json.NewDecoder(r.Body).Decode(&rate); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	rateID, err := query.SaveTaxRate(r.Context(), h.DB, &rate)
+	if err != nil {
+		http.Error(w, taxRatesError+err.Error(), http.StatusBadRequest)
+		return
+	}
+	rate.ID = rateID
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rate)
+}
+
+// stored exchange rates
+func (h *AdminHandler) GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := query.GetExchangeRates(r.Context(), h.DB)
+	if err != nil {
+		http.Error(w, exchangeRatesError+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+// create or replace rates from a json list of pairs or a text/csv body of base,quote,rate lines
+func (h *AdminHandler) SaveExchangeRates(w http.ResponseWriter, r *http.Request) {
+	var pairs []money.Pair
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		pairs, err = money.ReadCSV(r.Body)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&pairs)
+	}
+	if err != nil {
+		http.Error(w, exchangeRatesError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := query.SaveExchangeRates(r.Context(), h.DB, pairs, "admin")
+	if err != nil {
+		http.Error(w, exchangeRatesError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"saved": saved,
+	})
+}
@@ -1,23 +1,33 @@
 package handler
 
 import (
+	"backend/invoice"
 	"backend/middleware"
 	"backend/models"
+	"backend/payment"
 	"backend/query"
+	"backend/service"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type BookingHandler struct {
-	DB *pgxpool.Pool
+	DB       *pgxpool.Pool
+	Bookings *service.BookingService
+	Payments payment.PaymentProvider
+	HoldTTL  time.Duration // how long checkout may hold tickets
 }
 
-func NewBookingHandler(db *pgxpool.Pool) *BookingHandler {
-	return &BookingHandler{DB: db}
+func NewBookingHandler(db *pgxpool.Pool, payments payment.PaymentProvider, holdTTL time.Duration) *BookingHandler {
+	return &BookingHandler{DB: db, Bookings: service.NewBookingService(db), Payments: payments, HoldTTL: holdTTL}
 }
 
 // routes
@@ -26,7 +36,22 @@ func (h *BookingHandler) RegisterRoutes(r chi.Router) {
 		r.Use(middleware.JWTAuthMiddleware)
 
 		r.With(middleware.RequireRole("customer")).Post("/", (h.CreateBooking))
+		r.With(middleware.RequireRole("customer")).Post("/holds", (h.CreateHold))
+		r.With(middleware.RequireRole("customer")).Get("/holds/{holdID}", (h.GetHold))
+		r.With(middleware.RequireRole("customer")).Delete("/holds/{holdID}", (h.ReleaseHold))
+		r.With(middleware.RequireRole("customer")).Post("/waitlist", (h.JoinWaitlist))
+		r.With(middleware.RequireRole("customer")).Get("/waitlist", (h.GetWaitlist))
+		r.With(middleware.RequireRole("customer")).Delete("/waitlist/{entryID}", (h.LeaveWaitlist))
+		r.With(middleware.RequireRole("customer")).Post("/group", (h.RequestGroupBooking))
+		r.With(middleware.RequireRole("customer")).Get("/group", (h.GetGroupRequests))
+		r.With(middleware.RequireRole("customer")).Delete("/group/{requestID}", (h.CancelGroupRequest))
+		r.With(middleware.RequireRole("customer")).Get("/", (h.GetMyBookings))
 		r.Get("/{id}", h.GetBooking)
+		r.With(middleware.RequireRole("customer")).Post("/{id}/pay", (h.PayBooking))
+		r.With(middleware.RequireRole("customer")).Post("/{id}/cancel", (h.CancelBooking))
+		r.Get("/{id}/invoice", h.GetInvoice)
+		r.Get("/{id}/credit-notes", h.GetCreditNotes)
+		r.Get("/{id}/credit-notes/{noteID}", h.GetCreditNote)
 		r.With(middleware.RequireRole("customer")).Put("/{id}", (h.UpdateBooking))
 		r.With(middleware.RequireRole("customer")).Delete("/{id}", (h.DeleteBooking))
 	})
@@ -34,8 +59,19 @@ func (h *BookingHandler) RegisterRoutes(r chi.Router) {
 
 func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 	type bookingRequest struct {
-		ConferenceID  uint32 `json:"conference_id"`
-		TicketsBooked uint32 `json:"tickets_booked"`
+		HoldID        string            `json:"hold_id"` // confirms a hold, the tickets then come from it
+		ConferenceID  uint32            `json:"conference_id"`
+		TicketTypeID  uint32            `json:"ticket_type_id"` // optional when the conference has one type
+		TicketsBooked uint32            `json:"tickets_booked"`
+		PromoCode     string            `json:"promo_code"` // optional
+		Attendees     []models.Attendee `json:"attendees"`  // optional, one per ticket in order with their registration answers, more can be named later
+		Currency      string            `json:"currency"`   // optional display currency, defaults to the user's preference
+		Billing       struct {
+			Name    string `json:"name"` // defaults to the account name
+			Address string `json:"address"`
+			TaxID   string `json:"tax_id"`  // business buyers in another EU country pay no tax
+			Country string `json:"country"` // 2 letter ISO code, decides the tax rate
+		} `json:"billing"` // optional, printed on the invoice
 	}
 
 	// parse request body
@@ -55,21 +91,65 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 
 	// create booking record
 	booking := models.Booking{
-		UserID:        userID,
-		ConferenceID:  req.ConferenceID,
-		TicketsBooked: req.TicketsBooked,
+		UserID:         userID,
+		ConferenceID:   req.ConferenceID,
+		TicketTypeID:   req.TicketTypeID,
+		TicketsBooked:  req.TicketsBooked,
+		BillingName:    req.Billing.Name,
+		BillingAddress: req.Billing.Address,
+		BillingTaxID:   req.Billing.TaxID,
+		BillingCountry: req.Billing.Country,
+		Attendees:      req.Attendees,
+	}
+	if req.Currency != "" {
+		booking.DisplayCurrency = &req.Currency
+	}
+	if req.HoldID != "" {
+		booking.HoldID = &req.HoldID
 	}
 
-	bookingID, err := query.CreateBooking(r.Context(), h.DB, booking)
+	// free orders are paid already => tickets are issued with the booking
+	created, err := h.Bookings.Book(r.Context(), booking, req.PromoCode)
+	if errors.Is(err, query.ErrSoldOut) {
+		http.Error(w, "Failed to create booking: "+err.Error()+", join the waitlist with POST /booking/waitlist", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, query.ErrBookingLimit) {
+		http.Error(w, "Failed to create booking: "+err.Error()+" with POST /booking/group", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to create booking: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	bookingID := created.ID
 
-	// generate tickets for the booking
-	err = query.GenerateTickets(r.Context(), h.DB, bookingID)
+	if created.Status == query.BookingPaid {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"booking_id": bookingID,
+			"status":     created.Status,
+		})
+		return
+	}
+
+	// start payment, the booking is released when the provider is unavailable
+	intent, err := h.Payments.CreateIntent(r.Context(), created.TotalPrice, created.Currency, fmt.Sprintf("booking-%d", bookingID))
+	if err == nil {
+		_, err = query.CreatePayment(r.Context(), h.DB, &models.Payment{
+			BookingID: &bookingID,
+			Provider:  h.Payments.Name(),
+			IntentID:  intent.ID,
+			Amount:    intent.Amount,
+			Currency:  intent.Currency,
+			Status:    intent.Status,
+		})
+	}
 	if err != nil {
-		http.Error(w, "Booking made but failed to generate tickets", http.StatusInternalServerError)
+		if failErr := query.FailBooking(r.Context(), h.DB, bookingID, err.Error()); failErr != nil {
+			log.Printf("booking %d: releasing after payment error: %v", bookingID, failErr)
+		}
+		http.Error(w, paymentStartError+err.Error(), http.StatusBadGateway)
 		return
 	}
 
@@ -77,9 +157,142 @@ func (h *BookingHandler) CreateBooking(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]any{
 		"booking_id": bookingID,
+		"status":     created.Status,
+		"payment":    intent,
+	})
+}
+
+// confirm payment of a pending booking => customer
+// tickets are only generated once the provider reports success
+func (h *BookingHandler) PayBooking(w http.ResponseWriter, r *http.Request) {
+	// extract booking id from url
+	idString := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, bookingIDError, http.StatusBadRequest)
+		return
+	}
+
+	type payRequest struct {
+		PaymentMethod string `json:"payment_method"`
+	}
+
+	var req payRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	// fetch booking to validate ownership
+	booking, err := query.GetBookingByID(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, bookingError, http.StatusNotFound)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok || booking.UserID != userID {
+		http.Error(w, bookingAuthError, http.StatusForbidden)
+		return
+	}
+
+	if booking.Status != query.BookingPendingPayment {
+		http.Error(w, bookingNotPendingError+booking.Status, http.StatusConflict)
+		return
+	}
+
+	pending, err := query.GetPaymentByBookingID(r.Context(), h.DB, booking.ID)
+	if err != nil {
+		http.Error(w, paymentError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// confirm with the provider
+	intent, err := h.Payments.Confirm(r.Context(), pending.IntentID, req.PaymentMethod)
+	if err != nil {
+		http.Error(w, paymentError+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	switch intent.Status {
+	case payment.IntentSucceeded:
+		err = h.Bookings.CompletePayment(r.Context(), intent.ID)
+	case payment.IntentFailed:
+		err = query.FailPayment(r.Context(), h.DB, intent.ID, "declined by provider")
+	}
+	if err != nil {
+		http.Error(w, paymentError+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// return current booking state
+	updated, err := query.GetBookingByID(r.Context(), h.DB, booking.ID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if updated.Status != query.BookingPaid {
+		w.WriteHeader(http.StatusPaymentRequired)
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+// list own bookings with their conference, filtered and paginated => customer
+func (h *BookingHandler) GetMyBookings(w http.ResponseWriter, r *http.Request) {
+	filter, limit, offset, ok := listingParams(w, r)
+	if !ok {
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	bookings, total, err := query.GetBookingsByUserID(r.Context(), h.DB, userID, filter, limit, offset)
+	if errors.Is(err, query.ErrInvalidListing) {
+		http.Error(w, "Failed to list bookings: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"bookings": bookings,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
 	})
 }
 
+// parses ?filter=upcoming|past|cancelled&limit=&offset= of the customer listings
+func listingParams(w http.ResponseWriter, r *http.Request) (string, int, int, bool) {
+	params := r.URL.Query()
+
+	limit, offset := 20, 0 // default
+	var err error
+	if val := params.Get("limit"); val != "" {
+		if limit, err = strconv.Atoi(val); err != nil {
+			http.Error(w, listingError+"limit must be a number", http.StatusBadRequest)
+			return "", 0, 0, false
+		}
+	}
+	if val := params.Get("offset"); val != "" {
+		if offset, err = strconv.Atoi(val); err != nil {
+			http.Error(w, listingError+"offset must be a number", http.StatusBadRequest)
+			return "", 0, 0, false
+		}
+	}
+
+	return params.Get("filter"), limit, offset, true
+}
+
 // get booking => only customer or organizer requester
 func (h *BookingHandler) GetBooking(w http.ResponseWriter, r *http.Request) {
 	// extract booking id from url
@@ -126,6 +339,35 @@ func (h *BookingHandler) GetBooking(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(booking)
 }
 
+// cancel booking => customer
+// the refund follows the conference policy and is paid back by the refund job
+func (h *BookingHandler) CancelBooking(w http.ResponseWriter, r *http.Request) {
+	// extract booking id from url
+	idString := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, bookingIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract id from JWT claims
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	booking, err := query.CancelBooking(r.Context(), h.DB, uint32(id), userID)
+	if err != nil {
+		http.Error(w, cancelBookingError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// return cancelled booking with the refund due
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(booking)
+}
+
 // update booking => customer
 func (h *BookingHandler) UpdateBooking(w http.ResponseWriter, r *http.Request) {
 	// extract booking id from url
@@ -163,6 +405,10 @@ func (h *BookingHandler) UpdateBooking(w http.ResponseWriter, r *http.Request) {
 
 	// update
 	err = query.UpdateBooking(r.Context(), h.DB, uint32(id), userID, req.Tickets, req.Status)
+	if errors.Is(err, query.ErrSoldOut) || errors.Is(err, query.ErrBookingLimit) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -197,3 +443,110 @@ func (h *BookingHandler) DeleteBooking(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// invoice of a paid booking as PDF => buyer or conference organizer
+// issued on first payment, documents never change afterwards
+func (h *BookingHandler) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	booking, ok := h.documentBooking(w, r)
+	if !ok {
+		return
+	}
+
+	issued, err := query.IssueInvoice(r.Context(), h.DB, booking.ID)
+	if err != nil {
+		http.Error(w, invoiceError+err.Error(), http.StatusConflict)
+		return
+	}
+
+	_, pdf, err := query.GetInvoicePDF(r.Context(), h.DB, booking.ID, issued.ID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	writePDF(w, issued.Number, pdf)
+}
+
+// credit notes issued for refunds of a booking => buyer or conference organizer
+func (h *BookingHandler) GetCreditNotes(w http.ResponseWriter, r *http.Request) {
+	booking, ok := h.documentBooking(w, r)
+	if !ok {
+		return
+	}
+
+	notes, err := query.GetCreditNotesByBookingID(r.Context(), h.DB, booking.ID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// return as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+// single credit note as PDF => buyer or conference organizer
+func (h *BookingHandler) GetCreditNote(w http.ResponseWriter, r *http.Request) {
+	booking, ok := h.documentBooking(w, r)
+	if !ok {
+		return
+	}
+
+	noteID, err := strconv.ParseUint(chi.URLParam(r, "noteID"), 10, 32)
+	if err != nil {
+		http.Error(w, invoiceIDError, http.StatusBadRequest)
+		return
+	}
+
+	note, pdf, err := query.GetInvoicePDF(r.Context(), h.DB, booking.ID, uint32(noteID))
+	if err != nil || note.Kind != invoice.KindCreditNote {
+		http.Error(w, invoiceNotFoundError, http.StatusNotFound)
+		return
+	}
+
+	writePDF(w, note.Number, pdf)
+}
+
+// loads the booking from the url and checks the requester may see its documents
+func (h *BookingHandler) documentBooking(w http.ResponseWriter, r *http.Request) (*models.Booking, bool) {
+	// extract booking id from url
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, bookingIDError, http.StatusBadRequest)
+		return nil, false
+	}
+
+	booking, err := query.GetBookingByID(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, bookingError, http.StatusNotFound)
+		return nil, false
+	}
+
+	// fetch user identity from JWT claims
+	userID, ok1 := r.Context().Value(middleware.UserIDKey).(uint32)
+	role, ok2 := r.Context().Value(middleware.RoleKey).(string)
+	if !ok1 || !ok2 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if role == "organizer" {
+		conference, err := query.GetConferenceByID(r.Context(), h.DB, booking.ConferenceID)
+		if err != nil || conference.OrganizerID != userID {
+			http.Error(w, conferenceAuthError, http.StatusForbidden)
+			return nil, false
+		}
+	} else if booking.UserID != userID {
+		http.Error(w, bookingAuthError, http.StatusForbidden)
+		return nil, false
+	}
+
+	return booking, true
+}
+
+func writePDF(w http.ResponseWriter, number string, pdf []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", number+".pdf"))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.Write(pdf)
+}
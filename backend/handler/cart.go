@@ -0,0 +1,356 @@
+package handler
+
+import (
+	"backend/middleware"
+	"backend/models"
+	"backend/payment"
+	"backend/query"
+	"backend/service"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CartHandler struct {
+	DB       *pgxpool.Pool
+	Bookings *service.BookingService
+	Payments payment.PaymentProvider
+}
+
+func NewCartHandler(db *pgxpool.Pool, payments payment.PaymentProvider) *CartHandler {
+	return &CartHandler{DB: db, Bookings: service.NewBookingService(db), Payments: payments}
+}
+
+// routes
+func (h *CartHandler) RegisterRoutes(r chi.Router) {
+	r.Route("/cart", func(r chi.Router) {
+		r.Use(middleware.JWTAuthMiddleware)
+		r.Use(middleware.RequireRole("customer"))
+
+		r.Get("/", h.GetCart)
+		r.Delete("/", h.ClearCart)
+		r.Post("/items", h.AddCartItem)
+		r.Put("/items/{itemID}", h.UpdateCartItem)
+		r.Delete("/items/{itemID}", h.DeleteCartItem)
+		r.Post("/checkout", h.Checkout)
+	})
+
+	r.Route("/order", func(r chi.Router) {
+		r.Use(middleware.JWTAuthMiddleware)
+		r.Use(middleware.RequireRole("customer"))
+
+		r.Get("/{id}", h.GetOrder)
+		r.Post("/{id}/pay", h.PayOrder)
+	})
+}
+
+// get own cart => customer
+func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	items, err := query.GetCart(r.Context(), h.DB, userID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// add tickets to the cart => customer
+func (h *CartHandler) AddCartItem(w http.ResponseWriter, r *http.Request) {
+	type cartItemRequest struct {
+		ConferenceID uint32 `json:"conference_id"`
+		TicketTypeID uint32 `json:"ticket_type_id"`
+		Quantity     uint32 `json:"quantity"`
+		PromoCode    string `json:"promo_code"` // optional, checked at checkout
+	}
+
+	var req cartItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	item := models.CartItem{
+		UserID:       userID,
+		ConferenceID: req.ConferenceID,
+		TicketTypeID: req.TicketTypeID,
+		Quantity:     req.Quantity,
+		PromoCode:    req.PromoCode,
+	}
+	itemID, err := query.AddCartItem(r.Context(), h.DB, &item)
+	if err != nil {
+		http.Error(w, cartError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"item_id": itemID,
+	})
+}
+
+// change the quantity of a cart item => customer
+func (h *CartHandler) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	itemID, err := strconv.ParseUint(chi.URLParam(r, "itemID"), 10, 32)
+	if err != nil {
+		http.Error(w, cartItemIDError, http.StatusBadRequest)
+		return
+	}
+
+	type updateRequest struct {
+		Quantity uint32 `json:"quantity"`
+	}
+
+	var req updateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err = query.UpdateCartItem(r.Context(), h.DB, uint32(itemID), userID, req.Quantity)
+	if err != nil {
+		http.Error(w, cartError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// remove an item from the cart => customer
+func (h *CartHandler) DeleteCartItem(w http.ResponseWriter, r *http.Request) {
+	itemID, err := strconv.ParseUint(chi.URLParam(r, "itemID"), 10, 32)
+	if err != nil {
+		http.Error(w, cartItemIDError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err = query.DeleteCartItem(r.Context(), h.DB, uint32(itemID), userID)
+	if err != nil {
+		http.Error(w, cartError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// empty the cart => customer
+func (h *CartHandler) ClearCart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := query.ClearCart(r.Context(), h.DB, userID); err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// book the whole cart under one order and start a single payment => customer
+// either every item is reserved or none is
+func (h *CartHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	type checkoutRequest struct {
+		Currency string `json:"currency"` // optional display currency, defaults to the user's preference
+		Billing  struct {
+			Name    string `json:"name"` // defaults to the account name
+			Address string `json:"address"`
+			TaxID   string `json:"tax_id"`
+			Country string `json:"country"`
+		} `json:"billing"` // optional, printed on every invoice of the order
+	}
+
+	var req checkoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	template := models.Booking{
+		UserID:         userID,
+		BillingName:    req.Billing.Name,
+		BillingAddress: req.Billing.Address,
+		BillingTaxID:   req.Billing.TaxID,
+		BillingCountry: req.Billing.Country,
+	}
+	if req.Currency != "" {
+		template.DisplayCurrency = &req.Currency
+	}
+
+	// free bookings are paid already => tickets are issued with the order
+	order, err := h.Bookings.Checkout(r.Context(), template)
+	if err != nil {
+		http.Error(w, checkoutError+err.Error(), http.StatusConflict)
+		return
+	}
+	orderID := order.ID
+
+	response := map[string]any{
+		"order_id": order.ID,
+		"status":   order.Status,
+		"total":    order.Total,
+		"currency": order.Currency,
+		"bookings": order.Bookings,
+	}
+
+	// one payment covers every pending booking, the order is released when the provider is unavailable
+	if order.Total > 0 {
+		intent, err := h.Payments.CreateIntent(r.Context(), order.Total, order.Currency, fmt.Sprintf("order-%d", orderID))
+		if err == nil {
+			_, err = query.CreatePayment(r.Context(), h.DB, &models.Payment{
+				OrderID:  &orderID,
+				Provider: h.Payments.Name(),
+				IntentID: intent.ID,
+				Amount:   intent.Amount,
+				Currency: intent.Currency,
+				Status:   intent.Status,
+			})
+		}
+		if err != nil {
+			if failErr := query.FailOrder(r.Context(), h.DB, orderID, err.Error()); failErr != nil {
+				log.Printf("order %d: releasing after payment error: %v", orderID, failErr)
+			}
+			http.Error(w, paymentStartError+err.Error(), http.StatusBadGateway)
+			return
+		}
+		response["payment"] = intent
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// get own order with its bookings => customer
+func (h *CartHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.ownOrder(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// confirm the single payment of an order => customer
+// tickets are generated for every booking the payment settles
+func (h *CartHandler) PayOrder(w http.ResponseWriter, r *http.Request) {
+	type payRequest struct {
+		PaymentMethod string `json:"payment_method"`
+	}
+
+	var req payRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	order, ok := h.ownOrder(w, r)
+	if !ok {
+		return
+	}
+
+	if order.Status != query.BookingPendingPayment {
+		http.Error(w, orderNotPending+order.Status, http.StatusConflict)
+		return
+	}
+
+	pending, err := query.GetPaymentByOrderID(r.Context(), h.DB, order.ID)
+	if err != nil {
+		http.Error(w, paymentError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// confirm with the provider
+	intent, err := h.Payments.Confirm(r.Context(), pending.IntentID, req.PaymentMethod)
+	if err != nil {
+		http.Error(w, paymentError+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	switch intent.Status {
+	case payment.IntentSucceeded:
+		err = h.Bookings.CompletePayment(r.Context(), intent.ID)
+	case payment.IntentFailed:
+		err = query.FailPayment(r.Context(), h.DB, intent.ID, "declined by provider")
+	}
+	if err != nil {
+		http.Error(w, paymentError+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// return current order state
+	updated, err := query.GetOrder(r.Context(), h.DB, order.ID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if updated.Status != query.BookingPaid {
+		w.WriteHeader(http.StatusPaymentRequired)
+	}
+	json.NewEncoder(w).Encode(updated)
+}
+
+// loads the order in the url and checks it belongs to the requester
+func (h *CartHandler) ownOrder(w http.ResponseWriter, r *http.Request) (*models.Order, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, orderIDError, http.StatusBadRequest)
+		return nil, false
+	}
+
+	order, err := query.GetOrder(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, orderNotFoundError, http.StatusNotFound)
+		return nil, false
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok || order.UserID != userID {
+		http.Error(w, orderAuthError, http.StatusForbidden)
+		return nil, false
+	}
+
+	return order, true
+}
@@ -3,13 +3,17 @@ package handler
 import (
 	"backend/middleware"
 	"backend/models"
+	"backend/money"
+	"backend/pricing"
 	"backend/query"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -21,6 +25,34 @@ func NewConferenceHandler(db *pgxpool.Pool) *ConferenceHandler {
 	return &ConferenceHandler{DB: db}
 }
 
+// ticket type request structure, prices are in minor units
+type ticketTypeRequest struct {
+	Name        string     `json:"name"`
+	Price       int64      `json:"price"`
+	Currency    string     `json:"currency"`
+	Quota       uint32     `json:"quota"`
+	SalesStart  *time.Time `json:"sales_start"`
+	SalesEnd    *time.Time `json:"sales_end"`
+	MinPerOrder uint32     `json:"min_per_order"`
+	MaxPerOrder *uint32    `json:"max_per_order"`
+	Hidden      bool       `json:"hidden"`
+}
+
+func (req ticketTypeRequest) toModel(conferenceID uint32) models.TicketType {
+	return models.TicketType{
+		ConferenceID: conferenceID,
+		Name:         req.Name,
+		Price:        req.Price,
+		Currency:     req.Currency,
+		Quota:        req.Quota,
+		SalesStart:   req.SalesStart,
+		SalesEnd:     req.SalesEnd,
+		MinPerOrder:  req.MinPerOrder,
+		MaxPerOrder:  req.MaxPerOrder,
+		Hidden:       req.Hidden,
+	}
+}
+
 func (h *ConferenceHandler) RegisterRoutes(r chi.Router) {
 	r.Route("/conference", func(r chi.Router) {
 		r.Use(middleware.JWTAuthMiddleware)
@@ -30,17 +62,43 @@ func (h *ConferenceHandler) RegisterRoutes(r chi.Router) {
 		r.Get("/{id}", h.GetConferenceByID)                                      // public
 		r.With(middleware.JWTAuthMiddleware).Put("/{id}", h.UpdateConference)    // organizer only
 		r.With(middleware.JWTAuthMiddleware).Delete("/{id}", h.DeleteConference) // organizer only
+		r.With(middleware.RequireRole("organizer")).Post("/{id}/transition", h.TransitionConference)
+		r.Get("/{id}/transitions", h.GetConferenceTransitions)
+		r.With(middleware.RequireRole("organizer")).Post("/{id}/cancel", h.CancelConference)
+		r.Get("/{id}/ticket-types", h.GetTicketTypes)
+		r.With(middleware.RequireRole("organizer")).Post("/{id}/ticket-types", h.CreateTicketType)
+		r.With(middleware.RequireRole("organizer")).Put("/{id}/ticket-types/{typeID}", h.UpdateTicketType)
+		r.With(middleware.RequireRole("organizer")).Post("/{id}/ticket-types/{typeID}/tiers", h.CreatePriceTier)
+		r.With(middleware.RequireRole("organizer")).Delete("/{id}/ticket-types/{typeID}/tiers/{tierID}", h.DeletePriceTier)
+		r.With(middleware.RequireRole("organizer")).Get("/{id}/attendees", h.GetAttendees)
+		r.Get("/{id}/questions", h.GetQuestions)
+		r.With(middleware.RequireRole("organizer")).Post("/{id}/questions", h.CreateQuestion)
+		r.With(middleware.RequireRole("organizer")).Delete("/{id}/questions/{questionID}", h.DeleteQuestion)
+		r.With(middleware.RequireRole("organizer")).Get("/{id}/promo-codes", h.GetPromoCodes)
+		r.With(middleware.RequireRole("organizer")).Post("/{id}/promo-codes", h.CreatePromoCode)
+		r.With(middleware.RequireRole("organizer")).Delete("/{id}/promo-codes/{codeID}", h.DeletePromoCode)
+		r.Get("/{id}/refund-policy", h.GetRefundPolicy)
+		r.With(middleware.RequireRole("organizer")).Put("/{id}/refund-policy", h.SetRefundPolicy)
+		r.Get("/{id}/transfer-policy", h.GetTransferPolicy)
+		r.With(middleware.RequireRole("organizer")).Put("/{id}/transfer-policy", h.SetTransferPolicy)
+		r.Get("/{id}/booking-limits", h.GetBookingLimits)
+		r.With(middleware.RequireRole("organizer")).Put("/{id}/booking-limits", h.SetBookingLimits)
+		r.With(middleware.RequireRole("organizer")).Get("/{id}/group-requests", h.GetGroupRequests)
+		r.With(middleware.RequireRole("organizer")).Post("/{id}/group-requests/{requestID}/approve", h.ApproveGroupRequest)
+		r.With(middleware.RequireRole("organizer")).Post("/{id}/group-requests/{requestID}/decline", h.DeclineGroupRequest)
 	})
 }
 
 // create conference => organizer
 func (h *ConferenceHandler) CreateConference(w http.ResponseWriter, r *http.Request) {
 	type createConferenceRequest struct {
-		Title        string `json:"title"`
-		Description  string `json:"description"`
-		Location     string `json:"location"`
-		EventTime    string `json:"event_time"`
-		TotalTickets uint32 `json:"total_tickets"`
+		Title        string              `json:"title"`
+		Description  string              `json:"description"`
+		Location     string              `json:"location"`
+		EventTime    string              `json:"event_time"`
+		Currency     string              `json:"currency"` // defaults to USD
+		TotalTickets uint32              `json:"total_tickets"`
+		TicketTypes  []ticketTypeRequest `json:"ticket_types"`
 	}
 
 	// fetch user id and role from context
@@ -69,6 +127,12 @@ func (h *ConferenceHandler) CreateConference(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// either explicit ticket types or a total for the default type
+	if len(req.TicketTypes) == 0 && req.TotalTickets == 0 {
+		http.Error(w, ticketsRequiredError, http.StatusBadRequest)
+		return
+	}
+
 	// creates conference
 	conference := models.Conference{
 		Title:            req.Title,
@@ -79,11 +143,15 @@ func (h *ConferenceHandler) CreateConference(w http.ResponseWriter, r *http.Requ
 		AvailableTickets: req.TotalTickets,
 		OrganizerID:      userID,
 		Status:           "ongoing",
+		Currency:         req.Currency,
+	}
+	for _, ticketType := range req.TicketTypes {
+		conference.TicketTypes = append(conference.TicketTypes, ticketType.toModel(0))
 	}
 
 	conferenceID, err := query.CreateConference(r.Context(), h.DB, &conference)
 	if err != nil {
-		http.Error(w, createConferenceError, http.StatusInternalServerError)
+		http.Error(w, createConferenceError+": "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -134,6 +202,13 @@ func (h *ConferenceHandler) GetConferenceByID(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// embed ticket types so clients see prices and availability in one call
+	conf.TicketTypes, err = h.pricedTicketTypes(r, conf)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
 	// return as json
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(conf)
@@ -147,7 +222,6 @@ func (h *ConferenceHandler) UpdateConference(w http.ResponseWriter, r *http.Requ
 		Description string `json:"description"`
 		Location    string `json:"location"`
 		EventTime   string `json:"EventTime"`
-		Status      string `json:"status"`
 	}
 
 	// get conference id
@@ -190,7 +264,6 @@ func (h *ConferenceHandler) UpdateConference(w http.ResponseWriter, r *http.Requ
 		req.Description,
 		req.Location,
 		eventTime,
-		req.Status,
 	)
 	if err != nil {
 		http.Error(w, updateConferenceError+err.Error(), http.StatusBadRequest)
@@ -205,8 +278,8 @@ func (h *ConferenceHandler) UpdateConference(w http.ResponseWriter, r *http.Requ
 // delete conference => organizer
 func (h *ConferenceHandler) DeleteConference(w http.ResponseWriter, r *http.Request) {
 	// get user id and role from context
-	userID, ok1 := r.Context().Value("user_id").(uint32)
-	role, ok2 := r.Context().Value("role").(string)
+	userID, ok1 := r.Context().Value(middleware.UserIDKey).(uint32)
+	role, ok2 := r.Context().Value(middleware.RoleKey).(string)
 
 	if !ok1 || !ok2 || role != "organizer" {
 		http.Error(w, notOrganizerError, http.StatusUnauthorized)
@@ -231,3 +304,645 @@ func (h *ConferenceHandler) DeleteConference(w http.ResponseWriter, r *http.Requ
 	// success response
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// change conference status => organizer
+func (h *ConferenceHandler) TransitionConference(w http.ResponseWriter, r *http.Request) {
+	type transitionRequest struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+
+	// get conference id
+	idString := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	// parse json body
+	var req transitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	// transition
+	transition, err := query.TransitionConference(r.Context(), h.DB, uint32(id), &userID, req.Status, req.Reason)
+	if err != nil {
+		http.Error(w, transitionConferenceError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// return transition in json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transition)
+}
+
+// status history of a conference
+func (h *ConferenceHandler) GetConferenceTransitions(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	idString := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// fetch history
+	transitions, err := query.GetConferenceTransitions(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// return as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transitions)
+}
+
+// cancel conference keeping bookings and tickets => organizer
+func (h *ConferenceHandler) CancelConference(w http.ResponseWriter, r *http.Request) {
+	type cancelRequest struct {
+		Message string `json:"message"`
+	}
+
+	// get conference id
+	idString := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	// parse json body
+	var req cancelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	// cancel
+	transition, err := query.CancelConference(r.Context(), h.DB, uint32(id), userID, req.Message)
+	if err != nil {
+		http.Error(w, cancelConferenceError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// return transition in json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transition)
+}
+
+// list ticket types of a conference, ?code= also shows hidden types the promo code unlocks
+func (h *ConferenceHandler) GetTicketTypes(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	idString := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	conf, err := query.GetConferenceByID(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, conferenceNotFoundError, http.StatusNotFound)
+		return
+	}
+
+	ticketTypes, err := h.pricedTicketTypes(r, conf)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// return as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ticketTypes)
+}
+
+// add ticket type => organizer
+func (h *ConferenceHandler) CreateTicketType(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	idString := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	// parse json body
+	var req ticketTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	ticketType := req.toModel(uint32(id))
+	ticketTypeID, err := query.CreateTicketType(r.Context(), h.DB, &ticketType, userID)
+	if err != nil {
+		http.Error(w, ticketTypeError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// respond with ticket type id
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"ticket_type_id": ticketTypeID,
+	})
+}
+
+// update ticket type => organizer
+func (h *ConferenceHandler) UpdateTicketType(w http.ResponseWriter, r *http.Request) {
+	// get conference and ticket type id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	typeID, err := strconv.ParseUint(chi.URLParam(r, "typeID"), 10, 32)
+	if err != nil {
+		http.Error(w, ticketTypeIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	// parse json body
+	var req ticketTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	ticketType := req.toModel(uint32(id))
+	ticketType.ID = uint32(typeID)
+	err = query.UpdateTicketType(r.Context(), h.DB, &ticketType, userID)
+	if err != nil {
+		http.Error(w, ticketTypeError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// response
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Ticket type updated successfully"))
+}
+
+// add pricing tier to a ticket type => organizer
+func (h *ConferenceHandler) CreatePriceTier(w http.ResponseWriter, r *http.Request) {
+	type priceTierRequest struct {
+		Name     string     `json:"name"`
+		Price    int64      `json:"price"`
+		StartsAt *time.Time `json:"starts_at"`
+		EndsAt   *time.Time `json:"ends_at"`
+		MaxSold  *uint32    `json:"max_sold"`
+		Position int        `json:"position"`
+	}
+
+	// get conference and ticket type id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	typeID, err := strconv.ParseUint(chi.URLParam(r, "typeID"), 10, 32)
+	if err != nil {
+		http.Error(w, ticketTypeIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	// parse json body
+	var req priceTierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	tier := models.PriceTier{
+		TicketTypeID: uint32(typeID),
+		Name:         req.Name,
+		Price:        req.Price,
+		StartsAt:     req.StartsAt,
+		EndsAt:       req.EndsAt,
+		MaxSold:      req.MaxSold,
+		Position:     req.Position,
+	}
+
+	tierID, err := query.CreatePriceTier(r.Context(), h.DB, &tier, uint32(id), userID)
+	if err != nil {
+		http.Error(w, priceTierError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// respond with tier id
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"price_tier_id": tierID,
+	})
+}
+
+// remove pricing tier => organizer
+func (h *ConferenceHandler) DeletePriceTier(w http.ResponseWriter, r *http.Request) {
+	// get conference and tier id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	tierID, err := strconv.ParseUint(chi.URLParam(r, "tierID"), 10, 32)
+	if err != nil {
+		http.Error(w, priceTierIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	err = query.DeletePriceTier(r.Context(), h.DB, uint32(tierID), uint32(id), userID)
+	if err != nil {
+		http.Error(w, priceTierError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ticket types with their current tier and upcoming price changes
+// hidden types are listed for the organizer, or when unlocked by the ?code= promo code
+func (h *ConferenceHandler) pricedTicketTypes(r *http.Request, conf *models.Conference) ([]models.TicketType, error) {
+	userID, _ := r.Context().Value(middleware.UserIDKey).(uint32)
+	isOrganizer := userID == conf.OrganizerID
+
+	ticketTypes, err := query.GetTicketTypesByConferenceID(r.Context(), h.DB, conf.ID, isOrganizer)
+	if err != nil {
+		return nil, err
+	}
+
+	if code := r.URL.Query().Get("code"); code != "" && !isOrganizer {
+		unlocked, err := query.GetTicketTypesUnlockedByCode(r.Context(), h.DB, conf.ID, code)
+		if err != nil {
+			return nil, err
+		}
+		ticketTypes = append(ticketTypes, unlocked...)
+	}
+
+	tiers, err := query.GetPriceTiersByConferenceID(r.Context(), h.DB, conf.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range ticketTypes {
+		pricing.Annotate(&ticketTypes[i], tiers[ticketTypes[i].ID], now)
+	}
+
+	// indicative prices in ?currency= or the user's preferred currency
+	display := strings.ToUpper(r.URL.Query().Get("currency"))
+	if display == "" && userID != 0 {
+		if user, err := query.GetUserByID(r.Context(), h.DB, userID); err == nil && user.PreferredCurrency != nil {
+			display = *user.PreferredCurrency
+		}
+	}
+	if display == "" || display == conf.Currency {
+		return ticketTypes, nil
+	}
+
+	rate, err := query.GetExchangeRate(r.Context(), h.DB, conf.Currency, display)
+	if err == pgx.ErrNoRows {
+		return ticketTypes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range ticketTypes {
+		ticketTypes[i].Indicative = &models.Indicative{
+			Currency: display,
+			Price:    money.Convert(ticketTypes[i].CurrentPrice, conf.Currency, display, rate.Rate),
+			Rate:     rate.Rate,
+			RateAt:   rate.UpdatedAt,
+		}
+	}
+
+	return ticketTypes, nil
+}
+
+// list attendees of every active ticket with their registration answers => organizer
+// ?format=csv exports them with one column per question
+func (h *ConferenceHandler) GetAttendees(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	attendees, err := query.GetConferenceAttendees(r.Context(), h.DB, uint32(id), userID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		questions, err := query.GetRegistrationQuestions(r.Context(), h.DB, uint32(id))
+		if err != nil {
+			http.Error(w, internalServerError, http.StatusInternalServerError)
+			return
+		}
+		writeAttendeesCSV(w, uint32(id), attendees, questions)
+		return
+	}
+
+	// return as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attendees)
+}
+
+// list promo codes => organizer
+func (h *ConferenceHandler) GetPromoCodes(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	promos, err := query.GetPromoCodesByConferenceID(r.Context(), h.DB, uint32(id), userID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// return as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promos)
+}
+
+// add promo code => organizer
+func (h *ConferenceHandler) CreatePromoCode(w http.ResponseWriter, r *http.Request) {
+	type promoCodeRequest struct {
+		Code          string     `json:"code"`
+		DiscountType  string     `json:"discount_type"` // percent or fixed
+		Amount        int64      `json:"amount"`
+		MaxUses       *uint32    `json:"max_uses"`
+		PerUserLimit  *uint32    `json:"per_user_limit"`
+		ValidFrom     *time.Time `json:"valid_from"`
+		ValidUntil    *time.Time `json:"valid_until"`
+		TicketTypeIDs []uint32   `json:"ticket_type_ids"`
+	}
+
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	// parse json body
+	var req promoCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	promo := models.PromoCode{
+		ConferenceID:  uint32(id),
+		Code:          req.Code,
+		DiscountType:  req.DiscountType,
+		Amount:        req.Amount,
+		MaxUses:       req.MaxUses,
+		PerUserLimit:  req.PerUserLimit,
+		ValidFrom:     req.ValidFrom,
+		ValidUntil:    req.ValidUntil,
+		TicketTypeIDs: req.TicketTypeIDs,
+	}
+
+	promoID, err := query.CreatePromoCode(r.Context(), h.DB, &promo, userID)
+	if err != nil {
+		http.Error(w, promoCodeError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// respond with promo code id
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"promo_code_id": promoID,
+	})
+}
+
+// remove promo code => organizer
+func (h *ConferenceHandler) DeletePromoCode(w http.ResponseWriter, r *http.Request) {
+	// get conference and promo code id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	codeID, err := strconv.ParseUint(chi.URLParam(r, "codeID"), 10, 32)
+	if err != nil {
+		http.Error(w, promoCodeIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	err = query.DeletePromoCode(r.Context(), h.DB, uint32(codeID), uint32(id), userID)
+	if err != nil {
+		http.Error(w, promoCodeError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refund rules of a conference, an empty list means full refund until the event starts
+func (h *ConferenceHandler) GetRefundPolicy(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	rules, err := query.GetRefundPolicy(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// return as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// replace refund rules => organizer
+func (h *ConferenceHandler) SetRefundPolicy(w http.ResponseWriter, r *http.Request) {
+	type refundRuleRequest struct {
+		HoursBefore   uint32 `json:"hours_before"`   // applies while at least this many hours remain
+		RefundPercent uint32 `json:"refund_percent"` // 0 - 100
+	}
+
+	type refundPolicyRequest struct {
+		Rules []refundRuleRequest `json:"rules"`
+	}
+
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	// parse json body
+	var req refundPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	rules := make([]models.RefundRule, 0, len(req.Rules))
+	for _, rule := range req.Rules {
+		rules = append(rules, models.RefundRule{
+			ConferenceID:  uint32(id),
+			HoursBefore:   rule.HoursBefore,
+			RefundPercent: rule.RefundPercent,
+		})
+	}
+
+	err = query.SetRefundPolicy(r.Context(), h.DB, uint32(id), userID, rules)
+	if err != nil {
+		http.Error(w, refundPolicyError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// get transfer settings => public
+func (h *ConferenceHandler) GetTransferPolicy(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	policy, err := query.GetTransferPolicy(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, conferenceNotFoundError, http.StatusNotFound)
+		return
+	}
+
+	// return as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// turn ticket transfers on or off and set how long before the event they close => organizer
+func (h *ConferenceHandler) SetTransferPolicy(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	// parse json body
+	var req models.TransferPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	err = query.SetTransferPolicy(r.Context(), h.DB, uint32(id), userID, req)
+	if err != nil {
+		http.Error(w, transferPolicyError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -12,14 +12,30 @@ const (
 
 // conference errors
 const (
-	eventTimeError          string = "Invalid event time format"
-	createConferenceError   string = "Failed to create conference"
-	conferencesFetchError   string = "Error fecthing upcoming conferences: "
-	conferenceIDError       string = "Invalid conference ID"
-	conferenceNotFoundError string = "Conference not found"
-	updateConferenceError   string = "Error updating conference: "
-	deleteConferenceError   string = "Failed to delete conference: "
-	conferenceAuthError     string = "Unauthorized: Not your conference"
+	eventTimeError            string = "Invalid event time format"
+	createConferenceError     string = "Failed to create conference"
+	conferencesFetchError     string = "Error fecthing upcoming conferences: "
+	conferenceIDError         string = "Invalid conference ID"
+	conferenceNotFoundError   string = "Conference not found"
+	updateConferenceError     string = "Error updating conference: "
+	deleteConferenceError     string = "Failed to delete conference: "
+	conferenceAuthError       string = "Unauthorized: Not your conference"
+	transitionConferenceError string = "Error changing conference status: "
+	cancelConferenceError     string = "Error cancelling conference: "
+	ticketsRequiredError      string = "Either total_tickets or ticket_types is required"
+	ticketTypeIDError         string = "Invalid ticket type ID"
+	ticketTypeError           string = "Error saving ticket type: "
+	priceTierIDError          string = "Invalid price tier ID"
+	priceTierError            string = "Error saving price tier: "
+	promoCodeIDError          string = "Invalid promo code ID"
+	promoCodeError            string = "Error saving promo code: "
+	refundPolicyError         string = "Error saving refund policy: "
+	questionIDError           string = "Invalid question ID"
+	questionError             string = "Error saving question: "
+	transferPolicyError       string = "Error saving transfer policy: "
+	bookingLimitsError        string = "Error saving booking limits: "
+	groupRequestIDError       string = "Invalid group request ID"
+	groupDecisionError        string = "Cannot decide group request: "
 )
 
 // booking error
@@ -28,11 +44,66 @@ const (
 	bookingError       string = "Booking not found"
 	bookingAuthError   string = "Unauthorized: Not your booking"
 	bookingAccessError string = "Access denied: not your booking"
+	listingError       string = "Invalid listing: "
+)
+
+// payment errors
+const (
+	paymentStartError      string = "Failed to start payment: "
+	paymentError           string = "Error processing payment: "
+	bookingNotPendingError string = "Booking is not awaiting payment: "
+	webhookError           string = "Invalid webhook: "
+	cancelBookingError     string = "Error cancelling booking: "
+	invoiceError           string = "Cannot issue invoice: "
+	invoiceIDError         string = "Invalid document ID"
+	invoiceNotFoundError   string = "Document not found"
+	billingProfileError    string = "Error saving billing profile: "
+	holdError              string = "Cannot hold tickets: "
+	holdNotFoundError      string = "Hold not found"
+	waitlistError          string = "Cannot join waitlist: "
+	waitlistEntryIDError   string = "Invalid waitlist entry ID"
+	leaveWaitlistError     string = "Cannot leave waitlist: "
+	groupRequestError      string = "Cannot request group booking: "
+	cancelGroupError       string = "Cannot cancel group request: "
 )
 
 // ticket error
 const (
-	fetchTicketsError string = "Failed to fetch tickets"
+	fetchTicketsError   string = "Failed to fetch tickets"
+	ticketIDError       string = "Invalid ticket ID"
+	ticketNotFoundError string = "Ticket not found"
+	assignTicketError   string = "Cannot assign ticket: "
+	transferIDError     string = "Invalid transfer ID"
+	transferError       string = "Ticket transfer failed: "
+)
+
+// cart and order errors
+const (
+	cartError          string = "Error updating cart: "
+	cartItemIDError    string = "Invalid cart item ID"
+	checkoutError      string = "Checkout failed: "
+	orderIDError       string = "Invalid order ID"
+	orderNotFoundError string = "Order not found"
+	orderAuthError     string = "Not allowed to access this order"
+	orderNotPending    string = "Order is not awaiting payment: "
+)
+
+// admin errors
+const (
+	jobRunsFetchError  string = "Error fetching job runs: "
+	restoreError       string = "Error restoring record: "
+	taxRatesError      string = "Error managing tax rates: "
+	exchangeRatesError string = "Error managing exchange rates: "
+)
+
+// media errors
+const (
+	mediaIDError       string = "Invalid media ID"
+	mediaKindError     string = "Invalid kind, must be 'cover', 'speaker' or 'venue'"
+	mediaNotFoundError string = "File not found"
+	uploadFileError    string = "Missing or unreadable file field"
+	uploadSizeError    string = "Upload too large"
+	storeMediaError    string = "Failed to store media"
 )
 
 // JSON related errors: includes json, jwt
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"backend/middleware"
+	"backend/models"
+	"backend/query"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// how long an approved group booking holds its tickets unless the organizer says otherwise
+const defaultGroupHoldHours = 72
+
+// ask the organizer for a group booking above the order limits => customer
+// once approved the tickets are held for the leader, who books them with POST /booking and names attendees later
+func (h *BookingHandler) RequestGroupBooking(w http.ResponseWriter, r *http.Request) {
+	type groupRequest struct {
+		ConferenceID uint32 `json:"conference_id"`
+		TicketTypeID uint32 `json:"ticket_type_id"` // optional when the conference has one type
+		Quantity     uint32 `json:"quantity"`
+		Note         string `json:"note"` // optional, e.g. company and purpose
+	}
+
+	// parse request body
+	var req groupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	// get user ID from context
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	request := models.GroupBookingRequest{
+		UserID:       userID,
+		ConferenceID: req.ConferenceID,
+		TicketTypeID: req.TicketTypeID,
+		Quantity:     req.Quantity,
+		Note:         req.Note,
+	}
+	if err := query.CreateGroupRequest(r.Context(), h.DB, &request); err != nil {
+		http.Error(w, groupRequestError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(request)
+}
+
+// list own group booking requests => customer
+func (h *BookingHandler) GetGroupRequests(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	requests, err := query.GetGroupRequests(r.Context(), h.DB, userID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+// withdraw a group request, held tickets of an approved one go back on sale => customer
+func (h *BookingHandler) CancelGroupRequest(w http.ResponseWriter, r *http.Request) {
+	requestID, err := strconv.ParseUint(chi.URLParam(r, "requestID"), 10, 32)
+	if err != nil {
+		http.Error(w, groupRequestIDError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := query.CancelGroupRequest(r.Context(), h.DB, uint32(requestID), userID); err != nil {
+		http.Error(w, cancelGroupError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// get order limits => public
+func (h *ConferenceHandler) GetBookingLimits(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	limits, err := query.GetBookingLimits(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, conferenceNotFoundError, http.StatusNotFound)
+		return
+	}
+
+	// return as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
+
+// set the per-order and per-user maximums, empty values remove a limit => organizer
+func (h *ConferenceHandler) SetBookingLimits(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	// parse json body
+	var req models.BookingLimits
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	err = query.SetBookingLimits(r.Context(), h.DB, uint32(id), userID, req)
+	if err != nil {
+		http.Error(w, bookingLimitsError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// list group booking requests => organizer
+func (h *ConferenceHandler) GetGroupRequests(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	requests, err := query.GetConferenceGroupRequests(r.Context(), h.DB, uint32(id), userID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// return as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+// approve a group request, its tickets are held for the leader => organizer
+func (h *ConferenceHandler) ApproveGroupRequest(w http.ResponseWriter, r *http.Request) {
+	type approveRequest struct {
+		HoldHours uint32 `json:"hold_hours"` // optional, 72 by default, at most 30 days
+		Note      string `json:"note"`       // optional, sent to the leader
+	}
+
+	id, requestID, userID, ok := groupRequestParams(w, r)
+	if !ok {
+		return
+	}
+
+	// parse json body
+	var req approveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	if req.HoldHours == 0 {
+		req.HoldHours = defaultGroupHoldHours
+	}
+	if req.HoldHours > 30*24 {
+		http.Error(w, groupDecisionError+"hold_hours must be at most 720", http.StatusBadRequest)
+		return
+	}
+
+	hold, err := query.ApproveGroupRequest(r.Context(), h.DB, requestID, id, userID, time.Duration(req.HoldHours)*time.Hour, req.Note)
+	if errors.Is(err, query.ErrSoldOut) {
+		http.Error(w, groupDecisionError+err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, groupDecisionError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// return the hold the leader confirms
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hold)
+}
+
+// decline a pending group request => organizer
+func (h *ConferenceHandler) DeclineGroupRequest(w http.ResponseWriter, r *http.Request) {
+	type declineRequest struct {
+		Note string `json:"note"` // optional, sent to the leader
+	}
+
+	id, requestID, userID, ok := groupRequestParams(w, r)
+	if !ok {
+		return
+	}
+
+	// parse json body
+	var req declineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	err := query.DeclineGroupRequest(r.Context(), h.DB, requestID, id, userID, req.Note)
+	if err != nil {
+		http.Error(w, groupDecisionError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reads the conference and group request ids from the url and the organizer from the token
+func groupRequestParams(w http.ResponseWriter, r *http.Request) (uint32, uint32, uint32, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+
+	requestID, err := strconv.ParseUint(chi.URLParam(r, "requestID"), 10, 32)
+	if err != nil {
+		http.Error(w, groupRequestIDError, http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return 0, 0, 0, false
+	}
+
+	return uint32(id), uint32(requestID), userID, true
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"backend/middleware"
+	"backend/models"
+	"backend/query"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// hold tickets during checkout => customer
+func (h *BookingHandler) CreateHold(w http.ResponseWriter, r *http.Request) {
+	type holdRequest struct {
+		ConferenceID uint32 `json:"conference_id"`
+		TicketTypeID uint32 `json:"ticket_type_id"` // optional when the conference has one type
+		Tickets      uint32 `json:"tickets"`
+		PromoCode    string `json:"promo_code"` // optional, needed to hold hidden types
+	}
+
+	// parse request body
+	var req holdRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	// get user ID from context
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hold := models.Hold{
+		UserID:       userID,
+		ConferenceID: req.ConferenceID,
+		TicketTypeID: req.TicketTypeID,
+		Quantity:     req.Tickets,
+	}
+	err := query.CreateHold(r.Context(), h.DB, &hold, req.PromoCode, h.HoldTTL)
+	if err != nil {
+		http.Error(w, holdError+err.Error(), http.StatusConflict)
+		return
+	}
+
+	// return the hold to confirm with POST /booking
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hold)
+}
+
+// get own hold => customer
+func (h *BookingHandler) GetHold(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hold, err := query.GetHold(r.Context(), h.DB, chi.URLParam(r, "holdID"), userID)
+	if err != nil {
+		http.Error(w, holdNotFoundError, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hold)
+}
+
+// give held tickets back => customer
+func (h *BookingHandler) ReleaseHold(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := query.ReleaseHold(r.Context(), h.DB, chi.URLParam(r, "holdID"), userID)
+	if err != nil {
+		http.Error(w, holdError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"backend/blob"
+	"backend/media"
+	"backend/middleware"
+	"backend/models"
+	"backend/query"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type MediaHandler struct {
+	DB    *pgxpool.Pool
+	Store blob.Store
+}
+
+func NewMediaHandler(db *pgxpool.Pool, store blob.Store) *MediaHandler {
+	return &MediaHandler{DB: db, Store: store}
+}
+
+// routes for conference images and stored files
+func (h *MediaHandler) RegisterRoutes(r chi.Router) {
+	r.Route("/media", func(r chi.Router) {
+		r.Get("/files/*", h.GetFile) // public
+		r.Get("/conference/{conferenceID}", h.GetConferenceMedia)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.JWTAuthMiddleware)
+			r.Use(middleware.RequireRole("organizer"))
+
+			r.Post("/conference/{conferenceID}", h.UploadConferenceMedia)
+			r.Delete("/{mediaID}", h.DeleteConferenceMedia)
+		})
+	})
+}
+
+// upload image => organizer
+// ?kind=cover|speaker|venue, multipart form: file, caption
+func (h *MediaHandler) UploadConferenceMedia(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	idString := chi.URLParam(r, "conferenceID")
+	conferenceID, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("kind")))
+	if kind == "" {
+		kind = "cover"
+	}
+	if kind != "cover" && kind != "speaker" && kind != "venue" {
+		http.Error(w, mediaKindError, http.StatusBadRequest)
+		return
+	}
+
+	// parse multipart form, leave headroom for the other fields
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxFileSize+1<<20)
+	if err := r.ParseMultipartForm(media.MaxFileSize); err != nil {
+		http.Error(w, uploadSizeError, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, uploadFileError, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxFileSize+1))
+	if err != nil {
+		http.Error(w, uploadFileError, http.StatusBadRequest)
+		return
+	}
+
+	// validate, strip metadata and resize
+	img, err := media.Process(data)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, media.ErrTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	record := models.ConferenceMedia{
+		ConferenceID: uint32(conferenceID),
+		Kind:         kind,
+		Caption:      strings.TrimSpace(r.FormValue("caption")),
+		ContentType:  img.ContentType,
+		UploadedBy:   &userID,
+	}
+
+	// store every variant under a common prefix
+	prefix := fmt.Sprintf("conferences/%d/%s/%s", conferenceID, kind, uuid.New().String())
+	for _, variant := range img.Variants {
+		key := fmt.Sprintf("%s-%s.%s", prefix, variant.Name, img.Ext)
+		if err := h.Store.Put(r.Context(), key, variant.Data, img.ContentType); err != nil {
+			log.Println("blob put error:", err)
+			h.removeBlobs(r, record.Variants)
+			http.Error(w, storeMediaError, http.StatusInternalServerError)
+			return
+		}
+		record.Variants = append(record.Variants, models.MediaVariant{
+			Name:   variant.Name,
+			Key:    key,
+			Width:  variant.Width,
+			Height: variant.Height,
+		})
+	}
+
+	mediaID, replaced, err := query.CreateConferenceMedia(r.Context(), h.DB, &record)
+	if err != nil {
+		h.removeBlobs(r, record.Variants)
+		http.Error(w, storeMediaError+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// old cover files are no longer referenced
+	for _, old := range replaced {
+		h.removeBlobs(r, old.Variants)
+	}
+
+	record.ID = mediaID
+	h.withURLs(&record)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(record)
+}
+
+// list conference images
+func (h *MediaHandler) GetConferenceMedia(w http.ResponseWriter, r *http.Request) {
+	idString := chi.URLParam(r, "conferenceID")
+	conferenceID, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	mediaList, err := query.GetConferenceMedia(r.Context(), h.DB, uint32(conferenceID))
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	for i := range mediaList {
+		h.withURLs(&mediaList[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mediaList)
+}
+
+// delete image => organizer
+func (h *MediaHandler) DeleteConferenceMedia(w http.ResponseWriter, r *http.Request) {
+	idString := chi.URLParam(r, "mediaID")
+	mediaID, err := strconv.ParseUint(idString, 10, 32)
+	if err != nil {
+		http.Error(w, mediaIDError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	deleted, err := query.DeleteConferenceMedia(r.Context(), h.DB, uint32(mediaID), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	h.removeBlobs(r, deleted.Variants)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serves stored files when the store has no public address of its own
+func (h *MediaHandler) GetFile(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "*")
+
+	body, contentType, err := h.Store.Get(r.Context(), key)
+	if errors.Is(err, blob.ErrNotFound) {
+		http.Error(w, mediaNotFoundError, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("blob get error:", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	// keys are never reused, so files can be cached forever
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, body)
+}
+
+// fills variant urls from the store
+func (h *MediaHandler) withURLs(record *models.ConferenceMedia) {
+	for i := range record.Variants {
+		record.Variants[i].URL = h.Store.URL(record.Variants[i].Key)
+	}
+}
+
+// best effort cleanup of stored files
+func (h *MediaHandler) removeBlobs(r *http.Request, variants []models.MediaVariant) {
+	for _, variant := range variants {
+		if err := h.Store.Delete(r.Context(), variant.Key); err != nil {
+			log.Println("blob delete error:", err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"backend/payment"
+	"backend/query"
+	"backend/service"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// largest webhook body accepted from a provider
+const maxWebhookSize = 1 << 20
+
+type PaymentHandler struct {
+	DB       *pgxpool.Pool
+	Bookings *service.BookingService
+	Payments payment.PaymentProvider
+}
+
+func NewPaymentHandler(db *pgxpool.Pool, payments payment.PaymentProvider) *PaymentHandler {
+	return &PaymentHandler{DB: db, Bookings: service.NewBookingService(db), Payments: payments}
+}
+
+// routes => called by the provider, authenticated by the webhook signature
+func (h *PaymentHandler) RegisterRoutes(r chi.Router) {
+	r.Route("/payment", func(r chi.Router) {
+		r.Post("/webhook", h.Webhook)
+	})
+}
+
+// provider callback for asynchronous payment and refund outcomes
+// events are applied idempotently so provider retries are safe
+func (h *PaymentHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	event, err := h.Payments.VerifyWebhook(payload, r.Header)
+	if err != nil {
+		http.Error(w, webhookError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch event.Type {
+	case payment.EventPaymentSucceeded:
+		err = h.Bookings.CompletePayment(r.Context(), event.IntentID)
+	case payment.EventPaymentFailed:
+		err = query.FailPayment(r.Context(), h.DB, event.IntentID, "declined by provider")
+	case payment.EventRefundSucceeded:
+		err = query.SettleRefund(r.Context(), h.DB, event.RefundID, true, "")
+	case payment.EventRefundFailed:
+		err = query.SettleRefund(r.Context(), h.DB, event.RefundID, false, "refund failed at provider")
+	default:
+		// unknown events are acknowledged so the provider stops retrying
+		log.Printf("payment webhook: ignoring event %q", event.Type)
+	}
+	if err != nil {
+		// non 2xx makes the provider retry later
+		http.Error(w, paymentError+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
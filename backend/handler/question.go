@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"backend/middleware"
+	"backend/models"
+	"backend/query"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// registration form of a conference => public
+// each question lists the ticket type it is asked of, nil for every type
+func (h *ConferenceHandler) GetQuestions(w http.ResponseWriter, r *http.Request) {
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	questions, err := query.GetRegistrationQuestions(r.Context(), h.DB, uint32(id))
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	// return as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(questions)
+}
+
+// add a question to the registration form => organizer
+func (h *ConferenceHandler) CreateQuestion(w http.ResponseWriter, r *http.Request) {
+	type questionRequest struct {
+		TicketTypeID     *uint32  `json:"ticket_type_id"` // optional, every type when omitted
+		Label            string   `json:"label"`
+		Kind             string   `json:"kind"`    // text, choice, multi_choice, boolean or number
+		Options          []string `json:"options"` // choices of choice and multi_choice questions
+		Required         bool     `json:"required"`
+		ShowIfQuestionID *uint32  `json:"show_if_question_id"` // optional, only asked when that question
+		ShowIfAnswer     *string  `json:"show_if_answer"`      // was answered with this value
+		Position         int      `json:"position"`
+	}
+
+	// get conference id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	// parse json body
+	var req questionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	question := models.RegistrationQuestion{
+		ConferenceID:     uint32(id),
+		TicketTypeID:     req.TicketTypeID,
+		Label:            req.Label,
+		Kind:             req.Kind,
+		Options:          req.Options,
+		Required:         req.Required,
+		ShowIfQuestionID: req.ShowIfQuestionID,
+		ShowIfAnswer:     req.ShowIfAnswer,
+		Position:         req.Position,
+	}
+
+	questionID, err := query.CreateRegistrationQuestion(r.Context(), h.DB, &question, userID)
+	if err != nil {
+		http.Error(w, questionError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// respond with question id
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"question_id": questionID,
+	})
+}
+
+// remove a question from the registration form => organizer
+func (h *ConferenceHandler) DeleteQuestion(w http.ResponseWriter, r *http.Request) {
+	// get conference and question id
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		http.Error(w, conferenceIDError, http.StatusBadRequest)
+		return
+	}
+
+	questionID, err := strconv.ParseUint(chi.URLParam(r, "questionID"), 10, 32)
+	if err != nil {
+		http.Error(w, questionIDError, http.StatusBadRequest)
+		return
+	}
+
+	// extract user id
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	err = query.DeleteRegistrationQuestion(r.Context(), h.DB, uint32(questionID), uint32(id), userID)
+	if err != nil {
+		http.Error(w, questionError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writes the attendee list as csv, one column per registration question
+func writeAttendeesCSV(w http.ResponseWriter, conferenceID uint32, attendees []models.ConferenceAttendee, questions []models.RegistrationQuestion) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="conference-%d-attendees.csv"`, conferenceID))
+
+	out := csv.NewWriter(w)
+	header := []string{"ticket_code", "ticket_type", "attendee_name", "attendee_email", "booking_id", "buyer_name", "buyer_email"}
+	for _, question := range questions {
+		header = append(header, question.Label)
+	}
+	out.Write(csvSafe(header))
+
+	for _, attendee := range attendees {
+		record := []string{
+			attendee.TicketCode,
+			attendee.TicketType,
+			deref(attendee.AttendeeName),
+			deref(attendee.AttendeeEmail),
+			strconv.FormatUint(uint64(attendee.BookingID), 10),
+			attendee.BuyerName,
+			attendee.BuyerEmail,
+		}
+		for _, question := range questions {
+			record = append(record, formatAnswer(attendee.Answers[question.ID]))
+		}
+		out.Write(csvSafe(record))
+	}
+	out.Flush()
+}
+
+// cells are typed by attendees, a leading formula character would run in a spreadsheet
+// numbers such as -5 are left alone so they still read as numbers
+func csvSafe(record []string) []string {
+	for i, cell := range record {
+		if cell == "" || !strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			continue
+		}
+		if _, err := strconv.ParseFloat(cell, 64); err == nil {
+			continue
+		}
+		record[i] = "'" + cell
+	}
+	return record
+}
+
+// stored answers come back from jsonb as strings, lists, booleans and numbers
+func formatAnswer(answer any) string {
+	switch value := answer.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case bool:
+		if value {
+			return "yes"
+		}
+		return "no"
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case []any:
+		items := []string{}
+		for _, item := range value {
+			items = append(items, formatAnswer(item))
+		}
+		return strings.Join(items, "; ")
+	}
+	return fmt.Sprint(answer)
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
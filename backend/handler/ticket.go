@@ -2,8 +2,10 @@ package handler
 
 import (
 	"backend/middleware"
+	"backend/models"
 	"backend/query"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -21,7 +23,19 @@ func NewTicketHandler(db *pgxpool.Pool) *TicketHandler {
 
 func (h *TicketHandler) RegisterRoutes(r chi.Router) {
 	r.Route("/ticket", func(r chi.Router) {
-		r.Get("/booking/{bookingID}", h.GetTicketsByBookingID)
+		r.Get("/view/{token}", h.ViewTicket) // public, the token is the access link sent to the attendee
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.JWTAuthMiddleware)
+
+			r.With(middleware.RequireRole("customer")).Get("/", h.GetMyTickets)
+			r.Get("/booking/{bookingID}", h.GetTicketsByBookingID)
+			r.With(middleware.RequireRole("customer")).Put("/{ticketID}/attendee", h.AssignTicket)
+			r.With(middleware.RequireRole("customer")).Post("/{ticketID}/transfer", h.StartTransfer)
+			r.Get("/transfers", h.GetTransfers)
+			r.With(middleware.RequireRole("customer")).Post("/transfers/{transferID}/accept", h.AcceptTransfer)
+			r.Delete("/transfers/{transferID}", h.CancelTransfer)
+		})
 	})
 }
 
@@ -60,3 +74,183 @@ func (h *TicketHandler) GetTicketsByBookingID(w http.ResponseWriter, r *http.Req
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tickets)
 }
+
+// name the attendee of a ticket with their registration answers, empty name and email clear it => customer
+// the attendee gets an email with their own link to the ticket
+func (h *TicketHandler) AssignTicket(w http.ResponseWriter, r *http.Request) {
+	ticketID, err := strconv.ParseUint(chi.URLParam(r, "ticketID"), 10, 32)
+	if err != nil {
+		http.Error(w, ticketIDError, http.StatusBadRequest)
+		return
+	}
+
+	var req models.Attendee
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ticket, err := query.AssignTicket(r.Context(), h.DB, uint32(ticketID), userID, req)
+	if err != nil {
+		http.Error(w, assignTicketError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ticket)
+}
+
+// view a ticket through its access link => public
+func (h *TicketHandler) ViewTicket(w http.ResponseWriter, r *http.Request) {
+	ticket, err := query.GetTicketByAccessToken(r.Context(), h.DB, chi.URLParam(r, "token"))
+	if err != nil {
+		http.Error(w, ticketNotFoundError, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ticket)
+}
+
+// offer a ticket to someone else by email => ticket holder
+// the ticket stays valid until the recipient accepts
+func (h *TicketHandler) StartTransfer(w http.ResponseWriter, r *http.Request) {
+	ticketID, err := strconv.ParseUint(chi.URLParam(r, "ticketID"), 10, 32)
+	if err != nil {
+		http.Error(w, ticketIDError, http.StatusBadRequest)
+		return
+	}
+
+	type transferRequest struct {
+		Email string `json:"email"`
+	}
+
+	var req transferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	transfer, err := query.StartTransfer(r.Context(), h.DB, uint32(ticketID), userID, req.Email)
+	if err != nil {
+		http.Error(w, transferError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// transfers sent and received => user
+func (h *TicketHandler) GetTransfers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	transfers, err := query.GetTransfers(r.Context(), h.DB, userID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfers)
+}
+
+// accept a transfer sent to own email, a new ticket code is issued => recipient
+func (h *TicketHandler) AcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	transferID, err := strconv.ParseUint(chi.URLParam(r, "transferID"), 10, 32)
+	if err != nil {
+		http.Error(w, transferIDError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ticket, err := query.AcceptTransfer(r.Context(), h.DB, uint32(transferID), userID)
+	if err != nil {
+		http.Error(w, transferError+err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ticket)
+}
+
+// cancel a sent transfer or decline a received one => sender or recipient
+func (h *TicketHandler) CancelTransfer(w http.ResponseWriter, r *http.Request) {
+	transferID, err := strconv.ParseUint(chi.URLParam(r, "transferID"), 10, 32)
+	if err != nil {
+		http.Error(w, transferIDError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := query.CancelTransfer(r.Context(), h.DB, uint32(transferID), userID)
+	if err != nil {
+		http.Error(w, transferError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"transfer_id": transferID,
+		"status":      status,
+	})
+}
+
+// tickets held by the requester, bought or received by transfer => customer
+func (h *TicketHandler) GetMyTickets(w http.ResponseWriter, r *http.Request) {
+	filter, limit, offset, ok := listingParams(w, r)
+	if !ok {
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tickets, total, err := query.GetTicketsByUserID(r.Context(), h.DB, userID, filter, limit, offset)
+	if errors.Is(err, query.ErrInvalidListing) {
+		http.Error(w, "Failed to list tickets: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"tickets": tickets,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"backend/middleware"
+	"backend/models"
 	"backend/query"
 	"database/sql"
 	"encoding/json"
@@ -25,6 +27,8 @@ type updateUserRequest struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Role      string `json:"role"`
+
+	PreferredCurrency *string `json:"preferred_currency"` // optional, "" clears it
 }
 
 // includes register routes in UserHandler function
@@ -33,6 +37,10 @@ func (h *UserHandler) RegisterRoutes(r chi.Router) {
 		r.Get("/{id}", h.GetUser)
 		r.Put("/{id}", h.UpdateUser)
 		r.Delete("/{id}", h.DeleteUser)
+
+		// seller details printed on invoices
+		r.With(middleware.JWTAuthMiddleware, middleware.RequireRole("organizer")).Get("/billing-profile", h.GetBillingProfile)
+		r.With(middleware.JWTAuthMiddleware, middleware.RequireRole("organizer")).Put("/billing-profile", h.SaveBillingProfile)
 	})
 }
 
@@ -80,7 +88,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// update user info in DB
-	err = query.UpdateUserInfo(r.Context(), h.DB, uint32(id), request.FirstName, request.LastName, request.Role)
+	err = query.UpdateUserInfo(r.Context(), h.DB, uint32(id), request.FirstName, request.LastName, request.Role, request.PreferredCurrency)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -110,3 +118,46 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	// response with status
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// get billing profile => organizer
+func (h *UserHandler) GetBillingProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := query.GetOrganizerProfile(r.Context(), h.DB, userID)
+	if err != nil {
+		http.Error(w, "Billing profile not set", http.StatusNotFound)
+		return
+	}
+
+	// return profile as json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// create or replace billing profile => organizer
+func (h *UserHandler) SaveBillingProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, notOrganizerError, http.StatusUnauthorized)
+		return
+	}
+
+	var profile models.OrganizerProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, invalidJSONRequest, http.StatusBadRequest)
+		return
+	}
+	profile.OrganizerID = userID
+
+	err := query.SaveOrganizerProfile(r.Context(), h.DB, &profile)
+	if err != nil {
+		http.Error(w, billingProfileError+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"backend/middleware"
+	"backend/models"
+	"backend/query"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// line up for a sold out conference => customer
+// freed tickets are offered as a hold, confirmed with POST /booking like any other
+func (h *BookingHandler) JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	type waitlistRequest struct {
+		ConferenceID uint32  `json:"conference_id"`
+		TicketTypeID *uint32 `json:"ticket_type_id"` // optional, any visible type when omitted
+		Quantity     uint32  `json:"quantity"`
+	}
+
+	// parse request body
+	var req waitlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, requestBodyError, http.StatusBadRequest)
+		return
+	}
+
+	// get user ID from context
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	entry := models.WaitlistEntry{
+		UserID:       userID,
+		ConferenceID: req.ConferenceID,
+		TicketTypeID: req.TicketTypeID,
+		Quantity:     req.Quantity,
+	}
+	if err := query.JoinWaitlist(r.Context(), h.DB, &entry); err != nil {
+		http.Error(w, waitlistError+err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// own waitlist entries with place in line and open offers => customer
+func (h *BookingHandler) GetWaitlist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	entries, err := query.GetWaitlistEntries(r.Context(), h.DB, userID)
+	if err != nil {
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// leave the waitlist, an open offer is given up => customer
+func (h *BookingHandler) LeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	entryID, err := strconv.ParseUint(chi.URLParam(r, "entryID"), 10, 32)
+	if err != nil {
+		http.Error(w, waitlistEntryIDError, http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(middleware.UserIDKey).(uint32)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := query.LeaveWaitlist(r.Context(), h.DB, uint32(entryID), userID); err != nil {
+		http.Error(w, leaveWaitlistError+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
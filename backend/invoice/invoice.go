@@ -0,0 +1,182 @@
+package invoice
+
+import (
+	"backend/money"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// document kinds
+const (
+	KindInvoice    = "invoice"
+	KindCreditNote = "credit_note"
+)
+
+// seller or buyer as printed on the document
+type Party struct {
+	Name    string `json:"name"`
+	Address string `json:"address"` // one line per address line
+	TaxID   string `json:"tax_id,omitempty"`
+}
+
+// one billed item, amounts in minor units
+type Line struct {
+	Description string `json:"description"`
+	Quantity    uint32 `json:"quantity"`
+	UnitPrice   *int64 `json:"unit_price,omitempty"` // nil when tickets were priced differently
+	Amount      int64  `json:"amount"`
+}
+
+// tax charged at one rate
+type TaxLine struct {
+	Label  string `json:"label"`
+	RateBP uint32 `json:"rate_bp"` // basis points, 1900 = 19%
+	Base   int64  `json:"base"`
+	Amount int64  `json:"amount"`
+}
+
+// everything printed on an invoice or credit note, frozen at issue time
+type Document struct {
+	Kind      string    `json:"kind"`
+	Number    string    `json:"number"`
+	IssuedAt  time.Time `json:"issued_at"`
+	Reference string    `json:"reference,omitempty"` // invoice a credit note corrects
+	Seller    Party     `json:"seller"`
+	Buyer     Party     `json:"buyer"`
+	Currency  string    `json:"currency"`
+	Lines     []Line    `json:"lines"`
+	Taxes     []TaxLine `json:"taxes"`
+	Inclusive bool      `json:"inclusive"` // subtotal already contains the tax
+	Subtotal  int64     `json:"subtotal"`
+	Tax       int64     `json:"tax"`
+	Total     int64     `json:"total"`
+	Note      string    `json:"note,omitempty"`
+}
+
+// column positions
+const (
+	marginLeft  = 50.0
+	marginRight = pageWidth - 50
+	colQuantity = 340.0
+	colUnit     = 430.0
+	pageBottom  = pageHeight - 60
+)
+
+// renders the document as a single or multi page PDF
+func Render(doc Document) []byte {
+	p := newPDF()
+	p.addPage()
+
+	title := "INVOICE"
+	if doc.Kind == KindCreditNote {
+		title = "CREDIT NOTE"
+	}
+
+	// header
+	y := 70.0
+	p.text(marginLeft, y, 20, true, title)
+	p.textRight(marginRight, y, 10, true, "No. "+doc.Number)
+	y += 16
+	p.textRight(marginRight, y, 10, false, "Issued "+doc.IssuedAt.UTC().Format("2006-01-02"))
+	if doc.Reference != "" {
+		y += 14
+		p.textRight(marginRight, y, 10, false, "Corrects invoice "+doc.Reference)
+	}
+
+	// parties
+	y = 130
+	sellerEnd := party(p, marginLeft, y, "From", doc.Seller)
+	buyerEnd := party(p, 320, y, "Bill to", doc.Buyer)
+	y = max(sellerEnd, buyerEnd) + 20
+
+	// line items
+	y = lineHeader(p, y)
+	for _, line := range doc.Lines {
+		if y > pageBottom-120 {
+			p.addPage()
+			y = lineHeader(p, 70)
+		}
+
+		p.text(marginLeft, y, 10, false, line.Description)
+		p.textRight(colQuantity+30, y, 10, false, fmt.Sprint(line.Quantity))
+		if line.UnitPrice != nil {
+			p.textRight(colUnit+60, y, 10, false, money.Format(*line.UnitPrice, doc.Currency))
+		}
+		p.textRight(marginRight, y, 10, false, money.Format(line.Amount, doc.Currency))
+		y += 16
+	}
+	p.line(marginLeft, marginRight, y-8)
+
+	// totals and tax breakdown
+	y += 8
+	y = total(p, y, false, "Subtotal", money.Format(doc.Subtotal, doc.Currency))
+	for _, tax := range doc.Taxes {
+		label := fmt.Sprintf("%s %s of %s", tax.Label, FormatRate(tax.RateBP), money.Format(tax.Base, doc.Currency))
+		if doc.Inclusive {
+			label = "incl. " + label
+		}
+		y = total(p, y, false, label, money.Format(tax.Amount, doc.Currency))
+	}
+	if len(doc.Taxes) == 0 {
+		y = total(p, y, false, "Tax", money.Format(doc.Tax, doc.Currency))
+	}
+	y = total(p, y+4, true, "Total "+doc.Currency, money.Format(doc.Total, doc.Currency))
+
+	// note
+	if doc.Note != "" {
+		y += 30
+		for _, noteLine := range strings.Split(doc.Note, "\n") {
+			p.text(marginLeft, y, 9, false, noteLine)
+			y += 12
+		}
+	}
+
+	return p.bytes()
+}
+
+func party(p *pdf, x, y float64, label string, who Party) float64 {
+	p.text(x, y, 9, true, strings.ToUpper(label))
+	y += 14
+	p.text(x, y, 10, true, who.Name)
+	for _, addressLine := range strings.Split(who.Address, "\n") {
+		if strings.TrimSpace(addressLine) == "" {
+			continue
+		}
+		y += 13
+		p.text(x, y, 10, false, strings.TrimSpace(addressLine))
+	}
+	if who.TaxID != "" {
+		y += 13
+		p.text(x, y, 10, false, "Tax ID: "+who.TaxID)
+	}
+	return y
+}
+
+func lineHeader(p *pdf, y float64) float64 {
+	p.text(marginLeft, y, 9, true, "DESCRIPTION")
+	p.textRight(colQuantity+30, y, 9, true, "QTY")
+	p.textRight(colUnit+60, y, 9, true, "UNIT")
+	p.textRight(marginRight, y, 9, true, "AMOUNT")
+	p.line(marginLeft, marginRight, y+6)
+	return y + 22
+}
+
+func total(p *pdf, y float64, bold bool, label, amount string) float64 {
+	size := 10.0
+	if bold {
+		size = 11
+	}
+	p.textRight(colUnit+60, y, size, bold, label)
+	p.textRight(marginRight, y, size, bold, amount)
+	return y + 16
+}
+
+// formats basis points as a percentage, e.g. 1950 => 19.5%
+func FormatRate(rateBP uint32) string {
+	whole, fraction := rateBP/100, rateBP%100
+	if fraction == 0 {
+		return fmt.Sprintf("%d%%", whole)
+	}
+	return strings.TrimRight(fmt.Sprintf("%d.%02d", whole, fraction), "0") + "%"
+}
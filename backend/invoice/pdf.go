@@ -0,0 +1,131 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+)
+
+// minimal single font family PDF writer, enough for text documents
+// uses the standard Helvetica fonts so nothing has to be embedded
+type pdf struct {
+	pages []*bytes.Buffer
+}
+
+func newPDF() *pdf {
+	return &pdf{}
+}
+
+func (p *pdf) addPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+}
+
+func (p *pdf) page() *bytes.Buffer {
+	if len(p.pages) == 0 {
+		p.addPage()
+	}
+	return p.pages[len(p.pages)-1]
+}
+
+// writes text with its baseline at y measured from the top of the page
+func (p *pdf) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, pageHeight-y, escape(s))
+}
+
+// writes text ending at x, widths are approximated from the font size
+func (p *pdf) textRight(x, y, size float64, bold bool, s string) {
+	p.text(x-textWidth(s, size, bold), y, size, bold, s)
+}
+
+// horizontal rule from x1 to x2
+func (p *pdf) line(x1, x2, y float64) {
+	fmt.Fprintf(p.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, pageHeight-y, x2, pageHeight-y)
+}
+
+// serialises the document with a cross reference table
+func (p *pdf) bytes() []byte {
+	if len(p.pages) == 0 {
+		p.addPage()
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// 1 catalog, 2 pages, 3-4 fonts, then a page and content object per page
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range p.pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i,
+		))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// converts to WinAnsi and escapes string delimiters
+// characters outside Latin-1 are replaced so the standard fonts can draw them
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '–' || r == '—':
+			b.WriteByte('-')
+		case r == '\n' || r == '\t':
+			b.WriteByte(' ')
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// rough Helvetica width, good enough to right align numbers
+func textWidth(s string, size float64, bold bool) float64 {
+	factor := 0.52
+	if bold {
+		factor = 0.56
+	}
+	return float64(len([]rune(s))) * size * factor
+}
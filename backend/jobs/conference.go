@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"backend/query"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// moves ongoing conferences whose event time has passed to completed
+// completed conferences no longer accept bookings, which closes their sales
+func CompletePastConferences(ctx context.Context, db *pgxpool.Pool) error {
+	conferenceIDs, err := query.GetPastOngoingConferenceIDs(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// one failing conference must not keep the rest open for sale
+	var errs []error
+	for _, conferenceID := range conferenceIDs {
+		_, err := query.TransitionConference(ctx, db, conferenceID, nil, query.ConferenceCompleted, "event time passed")
+		if err != nil {
+			log.Printf("jobs: completing conference %d: %v", conferenceID, err)
+			errs = append(errs, fmt.Errorf("conference %d: %w", conferenceID, err))
+			continue
+		}
+		log.Printf("jobs: conference %d completed", conferenceID)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"backend/money"
+	"backend/query"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// loads exchange rates from a csv file of base,quote,rate lines
+// the file is only read again after it changed, so rates keep the time they were published
+func LoadExchangeRates(path string) func(ctx context.Context, db *pgxpool.Pool) error {
+	var loadedAt time.Time
+	return func(ctx context.Context, db *pgxpool.Pool) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().After(loadedAt) {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		pairs, err := money.ReadCSV(file)
+		if err != nil {
+			return err
+		}
+
+		saved, err := query.SaveExchangeRates(ctx, db, pairs, "file "+filepath.Base(path))
+		if err != nil {
+			return err
+		}
+
+		loadedAt = info.ModTime()
+		log.Printf("jobs: loaded %d exchange rates from %s", saved, path)
+		return nil
+	}
+}
@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"backend/query"
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// returns tickets of holds that ran out to availability
+func ReleaseExpiredHolds(ctx context.Context, db *pgxpool.Pool) error {
+	released, err := query.ReleaseExpiredHolds(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if released > 0 {
+		log.Printf("jobs: released %d tickets from expired holds", released)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"backend/notify"
+	"backend/query"
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// notifications sent per run
+const notificationBatchSize = 100
+
+// sends queued notifications through the given sender
+func DeliverNotifications(sender notify.Sender) func(ctx context.Context, db *pgxpool.Pool) error {
+	return func(ctx context.Context, db *pgxpool.Pool) error {
+		notifications, err := query.GetQueuedNotifications(ctx, db, notificationBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range notifications {
+			msg := notify.Message{To: n.Email, Subject: n.Subject, Body: n.Body}
+
+			if sendErr := sender.Send(ctx, msg); sendErr != nil {
+				err = query.MarkNotificationFailed(ctx, db, n.ID, sendErr)
+			} else {
+				err = query.MarkNotificationSent(ctx, db, n.ID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"backend/payment"
+	"backend/query"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// refunds submitted per run
+const refundBatchSize = 50
+
+// submits queued refunds to the provider
+// the refund row id is the idempotency reference, so a retry after a lost response or a failed save
+// gets the first refund back instead of paying out twice
+// synchronous outcomes settle right away, pending ones wait for the webhook
+func ProcessRefunds(provider payment.PaymentProvider) func(ctx context.Context, db *pgxpool.Pool) error {
+	return func(ctx context.Context, db *pgxpool.Pool) error {
+		refunds, err := query.GetQueuedRefunds(ctx, db, refundBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, queued := range refunds {
+			result, refundErr := provider.Refund(ctx, queued.IntentID, queued.Amount, fmt.Sprintf("refund-%d", queued.ID))
+			if refundErr != nil {
+				if err := query.MarkRefundFailed(ctx, db, queued.ID, refundErr); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := query.MarkRefundSubmitted(ctx, db, queued.ID, result.ID); err != nil {
+				return err
+			}
+
+			switch result.Status {
+			case payment.RefundSucceeded:
+				err = query.SettleRefund(ctx, db, result.ID, true, "")
+			case payment.RefundFailed:
+				err = query.SettleRefund(ctx, db, result.ID, false, "refund failed at provider")
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// fails bookings whose payment was not completed in time, their tickets go back on sale
+func ExpirePendingPayments(ttl time.Duration) func(ctx context.Context, db *pgxpool.Pool) error {
+	return func(ctx context.Context, db *pgxpool.Pool) error {
+		expired, err := query.ExpirePendingBookings(ctx, db, ttl)
+		if err != nil {
+			return err
+		}
+
+		if expired > 0 {
+			log.Printf("jobs: expired %d unpaid bookings", expired)
+		}
+		return nil
+	}
+}
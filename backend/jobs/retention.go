@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"backend/query"
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// hard deletes rows that were soft deleted longer than retention ago
+func PurgeDeletedRecords(retention time.Duration) func(ctx context.Context, db *pgxpool.Pool) error {
+	return func(ctx context.Context, db *pgxpool.Pool) error {
+		purged, err := query.PurgeDeletedRecords(ctx, db, retention)
+		if err != nil {
+			return err
+		}
+
+		if purged > 0 {
+			log.Printf("jobs: purged %d soft deleted rows", purged)
+		}
+		return nil
+	}
+}
+
+// deletes idempotency keys whose requests can no longer be replayed
+func PurgeIdempotencyKeys(ttl time.Duration) func(ctx context.Context, db *pgxpool.Pool) error {
+	return func(ctx context.Context, db *pgxpool.Pool) error {
+		purged, err := query.PurgeIdempotencyKeys(ctx, db, ttl)
+		if err != nil {
+			return err
+		}
+
+		if purged > 0 {
+			log.Printf("jobs: purged %d idempotency keys", purged)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,18 @@
+package jobs
+
+import (
+	"backend/service"
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// issues tickets paid bookings are missing, e.g. from before booking and tickets were one transaction
+func RecoverMissingTickets(ctx context.Context, db *pgxpool.Pool) error {
+	recovered, err := service.NewBookingService(db).RecoverTickets(ctx)
+	if recovered > 0 {
+		log.Printf("jobs: issued missing tickets for %d paid bookings", recovered)
+	}
+	return err
+}
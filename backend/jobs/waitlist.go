@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"backend/query"
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// offers freed tickets to the waitlist, each offer holds them for offerTTL
+func PromoteWaitlist(offerTTL time.Duration) func(ctx context.Context, db *pgxpool.Pool) error {
+	return func(ctx context.Context, db *pgxpool.Pool) error {
+		offered, err := query.PromoteWaitlist(ctx, db, offerTTL)
+		if err != nil {
+			return err
+		}
+
+		if offered > 0 {
+			log.Printf("jobs: offered tickets to %d waitlist entries", offered)
+		}
+		return nil
+	}
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"backend/blob"
 	"backend/handler"
+	"backend/jobs"
 	"backend/middleware"
+	"backend/notify"
+	"backend/payment"
+	"backend/scheduler"
 	"context"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -27,6 +33,88 @@ func main() {
 	}
 	defer dbpool.Close()
 
+	// Soft deleted rows are purged after this many days
+	retentionDays := 30
+	if val := os.Getenv("SOFT_DELETE_RETENTION_DAYS"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			log.Fatal("SOFT_DELETE_RETENTION_DAYS must be a positive number of days")
+		}
+		retentionDays = parsed
+	}
+
+	// Unpaid bookings are released after this many minutes
+	paymentWindowMinutes := 30
+	if val := os.Getenv("PAYMENT_WINDOW_MINUTES"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			log.Fatal("PAYMENT_WINDOW_MINUTES must be a positive number of minutes")
+		}
+		paymentWindowMinutes = parsed
+	}
+
+	// Checkout holds tickets for this many minutes
+	holdMinutes := 10
+	if val := os.Getenv("HOLD_MINUTES"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			log.Fatal("HOLD_MINUTES must be a positive number of minutes")
+		}
+		holdMinutes = parsed
+	}
+
+	// Waitlist offers hold freed tickets for this many minutes
+	waitlistOfferMinutes := 30
+	if val := os.Getenv("WAITLIST_OFFER_MINUTES"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			log.Fatal("WAITLIST_OFFER_MINUTES must be a positive number of minutes")
+		}
+		waitlistOfferMinutes = parsed
+	}
+
+	// Idempotency keys replay their response for this many hours
+	idempotencyHours := 24
+	if val := os.Getenv("IDEMPOTENCY_KEY_HOURS"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			log.Fatal("IDEMPOTENCY_KEY_HOURS must be a positive number of hours")
+		}
+		idempotencyHours = parsed
+	}
+	idempotencyTTL := time.Duration(idempotencyHours) * time.Hour
+
+	// Payment provider
+	payments, err := payment.NewProviderFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to configure payments: %v", err)
+	}
+
+	// Background Jobs (only the replica holding the leader lock runs them)
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	sched := scheduler.New(dbpool)
+	sched.Register("complete-past-conferences", time.Minute, jobs.CompletePastConferences)
+	sched.Register("deliver-notifications", 15*time.Second, jobs.DeliverNotifications(notify.NewSenderFromEnv()))
+	sched.Register("purge-deleted-records", time.Hour, jobs.PurgeDeletedRecords(time.Duration(retentionDays)*24*time.Hour))
+	sched.Register("process-refunds", 30*time.Second, jobs.ProcessRefunds(payments))
+	sched.Register("expire-pending-payments", time.Minute, jobs.ExpirePendingPayments(time.Duration(paymentWindowMinutes)*time.Minute))
+	sched.Register("release-expired-holds", 15*time.Second, jobs.ReleaseExpiredHolds)
+	sched.Register("promote-waitlist", 15*time.Second, jobs.PromoteWaitlist(time.Duration(waitlistOfferMinutes)*time.Minute))
+	sched.Register("recover-missing-tickets", 5*time.Minute, jobs.RecoverMissingTickets)
+	sched.Register("purge-idempotency-keys", time.Hour, jobs.PurgeIdempotencyKeys(idempotencyTTL))
+	if path := os.Getenv("EXCHANGE_RATES_FILE"); path != "" {
+		sched.Register("load-exchange-rates", 5*time.Minute, jobs.LoadExchangeRates(path))
+	}
+	sched.Start(jobCtx)
+
+	// Blob storage for uploaded media
+	store, err := blob.NewStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to configure blob storage: %v", err)
+	}
+
 	// Initialize Router
 	r := chi.NewRouter()
 
@@ -36,13 +124,18 @@ func main() {
 	r.Use(middleware.RequestIDMiddleware)
 	r.Use(middleware.CORSMiddleware)
 	r.Use(middleware.RateLimitMiddleware)
+	r.Use(middleware.IdempotencyMiddleware(dbpool, idempotencyTTL))
 
 	// Register Handlers
 	handler.NewUserHandler(dbpool).RegisterRoutes(r)
 	handler.NewAuthHandler(dbpool).RegisterRoutes(r)
 	handler.NewConferenceHandler(dbpool).RegisterRoutes(r)
-	handler.NewBookingHandler(dbpool).RegisterRoutes(r)
+	handler.NewBookingHandler(dbpool, payments, time.Duration(holdMinutes)*time.Minute).RegisterRoutes(r)
+	handler.NewPaymentHandler(dbpool, payments).RegisterRoutes(r)
+	handler.NewCartHandler(dbpool, payments).RegisterRoutes(r)
 	handler.NewTicketHandler(dbpool).RegisterRoutes(r)
+	handler.NewAdminHandler(dbpool, sched).RegisterRoutes(r)
+	handler.NewMediaHandler(dbpool, store).RegisterRoutes(r)
 
 	// Run Server with Graceful Shutdown
 	srv := &http.Server{
@@ -66,6 +159,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopJobs()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
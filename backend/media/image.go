@@ -0,0 +1,179 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// upload limits
+const (
+	MaxFileSize = 10 << 20 // bytes
+	maxPixels   = 50_000_000
+)
+
+var (
+	ErrTooLarge        = errors.New("image is larger than 10 MB")
+	ErrUnsupportedType = errors.New("unsupported image type: only jpeg and png are accepted")
+	ErrDimensions      = errors.New("image dimensions are too large")
+)
+
+// resized outputs, bounded by their longest side, smaller images are never upscaled
+var variantSizes = []struct {
+	name    string
+	longest int
+}{
+	{"original", 2560},
+	{"large", 1600},
+	{"medium", 800},
+	{"thumb", 320},
+}
+
+// one encoded rendition of an upload
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// processed upload ready to be stored
+type Image struct {
+	ContentType string
+	Ext         string
+	Variants    []Variant
+}
+
+// validates an uploaded image, applies its exif orientation and re-encodes it into
+// resized variants. re-encoding drops exif and every other metadata block
+func Process(data []byte) (*Image, error) {
+	if len(data) > MaxFileSize {
+		return nil, ErrTooLarge
+	}
+
+	// sniff content instead of trusting the client supplied type
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, ErrUnsupportedType
+	}
+
+	// reject decompression bombs before allocating pixels
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, ErrDimensions
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+
+	src := toRGBA(decoded)
+	if contentType == "image/jpeg" {
+		src = orient(src, exifOrientation(data))
+	}
+
+	img := &Image{ContentType: contentType, Ext: "png"}
+	if contentType == "image/jpeg" {
+		img.Ext = "jpg"
+	}
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	for _, size := range variantSizes {
+		w, h := fit(width, height, size.longest)
+
+		// skip variants identical to a larger one already produced
+		if len(img.Variants) > 0 {
+			last := img.Variants[len(img.Variants)-1]
+			if last.Width == w && last.Height == h {
+				continue
+			}
+		}
+
+		resized := src
+		if w != width || h != height {
+			resized = resize(src, w, h)
+		}
+
+		var buf bytes.Buffer
+		if contentType == "image/jpeg" {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		img.Variants = append(img.Variants, Variant{Name: size.name, Width: w, Height: h, Data: buf.Bytes()})
+	}
+
+	return img, nil
+}
+
+// dimensions bounded by longest side keeping aspect ratio
+func fit(width, height, longest int) (int, int) {
+	if width <= longest && height <= longest {
+		return width, height
+	}
+	if width >= height {
+		return longest, max(1, height*longest/width)
+	}
+	return max(1, width*longest/height), longest
+}
+
+// copies any image into a zero based rgba image
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// area averaging downscale, each destination pixel is the mean of the source pixels it covers
+func resize(src *image.RGBA, dw, dh int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, (dy+1)*sh/dh
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, (dx+1)*sw/dw
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[offset])
+					g += uint64(src.Pix[offset+1])
+					b += uint64(src.Pix[offset+2])
+					a += uint64(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+
+			offset := dst.PixOffset(dx, dy)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"backend/auth"
+	"backend/models"
+	"backend/query"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+	ReplayedHeader    = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBody       = 16 << 20 // bytes, above the largest media upload
+
+	// a processing key not renewed for this long is treated as abandoned by a crashed request
+	idempotencyLease     = 30 * time.Second
+	idempotencyHeartbeat = idempotencyLease / 3
+	idempotencyPoll      = 100 * time.Millisecond
+)
+
+// makes POST, PUT and DELETE requests carrying an Idempotency-Key safe to retry
+// the first request runs and its response is stored, retries get the stored response back
+// server errors are not stored, their retries run again
+// a key reused with another method, path, query or body is rejected
+// requests with the same key wait for the one in flight instead of running concurrently
+func IdempotencyMiddleware(db *pgxpool.Pool, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keyValue := r.Header.Get(IdempotencyHeader)
+			if keyValue == "" || !isMutating(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(keyValue) > maxIdempotencyKeyLength {
+				http.Error(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+				return
+			}
+
+			// keys are scoped to the caller, requests with a bad token fail later without a key
+			userID, ok := requestUserID(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if len(body) > maxIdempotentBody {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key := models.IdempotencyKey{
+				UserID:      userID,
+				Key:         keyValue,
+				Method:      r.Method,
+				Path:        r.URL.RequestURI(),
+				Fingerprint: fingerprint(r.Method, r.URL.RequestURI(), body),
+			}
+
+			// claim the key, waiting while another request holds it
+			wait, cancel := context.WithTimeout(r.Context(), idempotencyLease)
+			defer cancel()
+			for {
+				stored, err := query.ClaimIdempotencyKey(wait, db, &key, ttl, idempotencyLease)
+				if err == query.ErrIdempotencyKeyReused {
+					http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+					return
+				}
+				if err != nil {
+					if wait.Err() != nil {
+						http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+						return
+					}
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+
+				if stored == nil {
+					break
+				}
+				if stored.Status == query.IdempotencyCompleted {
+					replay(w, stored)
+					return
+				}
+
+				select {
+				case <-wait.Done():
+					http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+					return
+				case <-time.After(idempotencyPoll):
+				}
+			}
+
+			// storing must outlive a client that hung up, otherwise its retry would run twice
+			storeCtx := context.WithoutCancel(r.Context())
+			recorder := &responseRecorder{ResponseWriter: w}
+			defer func() {
+				if err := recover(); err != nil {
+					if releaseErr := query.ReleaseIdempotencyKey(storeCtx, db, key.ID); releaseErr != nil {
+						log.Printf("idempotency key %d: release after panic: %v", key.ID, releaseErr)
+					}
+					panic(err)
+				}
+			}()
+
+			// slow requests keep their lease while they run
+			heartbeatCtx, stopHeartbeat := context.WithCancel(storeCtx)
+			defer stopHeartbeat()
+			go renewLease(heartbeatCtx, db, key.ID)
+
+			next.ServeHTTP(recorder, r)
+			stopHeartbeat()
+
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+
+			// server errors are likely transient, a retry runs the request again instead of replaying them
+			if recorder.status >= http.StatusInternalServerError {
+				if err := query.ReleaseIdempotencyKey(storeCtx, db, key.ID); err != nil {
+					log.Printf("idempotency key %d: release after server error: %v", key.ID, err)
+				}
+				return
+			}
+
+			err = query.CompleteIdempotencyKey(storeCtx, db, key.ID, recorder.status, w.Header().Get("Content-Type"), recorder.body.Bytes())
+			if err != nil {
+				log.Printf("idempotency key %d: storing response: %v", key.ID, err)
+			}
+		})
+	}
+}
+
+// renews the lease of a claimed key until the context is cancelled
+func renewLease(ctx context.Context, db *pgxpool.Pool, keyID uint32) {
+	ticker := time.NewTicker(idempotencyHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := query.RenewIdempotencyKey(ctx, db, keyID); err != nil && ctx.Err() == nil {
+				log.Printf("idempotency key %d: renewing lease: %v", keyID, err)
+			}
+		}
+	}
+}
+
+func isMutating(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodDelete
+}
+
+// user of a bearer token, 0 for requests without one
+func requestUserID(r *http.Request) (uint32, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return 0, true
+	}
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return 0, false
+	}
+
+	token, err := auth.ValidateJWT(strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		return 0, false
+	}
+
+	userID, _, err := auth.ExtractClaims(token)
+	if err != nil {
+		return 0, false
+	}
+	return userID, true
+}
+
+// path includes the query string, the same key with other parameters is a different request
+func fingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// writes a stored response again
+func replay(w http.ResponseWriter, stored *models.IdempotencyKey) {
+	if stored.ContentType != nil && *stored.ContentType != "" {
+		w.Header().Set("Content-Type", *stored.ContentType)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+
+	statusCode := http.StatusOK
+	if stored.StatusCode != nil {
+		statusCode = *stored.StatusCode
+	}
+	w.WriteHeader(statusCode)
+	w.Write(stored.Body)
+}
+
+// passes the response through while keeping a copy to store
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if rec.status == 0 {
+		rec.status = statusCode
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -1,16 +1,21 @@
 package models
 
-import "time"
+import (
+	"backend/money"
+	"time"
+)
 
 // User Model
 type User struct {
-	ID           uint32    `json:"id"`
-	FirstName    string    `json:"first_name"`
-	LastName     string    `json:"last_name"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Role         string    `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           uint32 `json:"id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+	// indicative prices are shown in it, nil shows the conference currency
+	PreferredCurrency *string   `json:"preferred_currency"`
+	CreatedAt         time.Time `json:"created_at"`
 }
 
 // Conference Model
@@ -24,23 +29,497 @@ type Conference struct {
 	AvailableTickets uint32    `json:"available_tickets"`
 	OrganizerID      uint32    `json:"organizer_id"`
 	Status           string    `json:"status"`
+	Currency         string    `json:"currency"` // every ticket type is priced in it
 	CreatedAt        time.Time `json:"created_at"`
+
+	TicketTypes []TicketType `json:"ticket_types,omitempty"`
+}
+
+// Conference Summary Model (embedded in listings)
+type ConferenceSummary struct {
+	ID        uint32    `json:"id"`
+	Title     string    `json:"title"`
+	Location  string    `json:"location"`
+	EventTime time.Time `json:"event_time"`
+	Status    string    `json:"status"`
+}
+
+// Ticket Type Model
+type TicketType struct {
+	ID           uint32     `json:"id"`
+	ConferenceID uint32     `json:"conference_id"`
+	Name         string     `json:"name"`
+	Price        int64      `json:"price"` // minor units
+	Currency     string     `json:"currency"`
+	Quota        uint32     `json:"quota"`
+	Available    uint32     `json:"available"`
+	Held         uint32     `json:"held"` // in active holds, not available until confirmed or released
+	SalesStart   *time.Time `json:"sales_start"`
+	SalesEnd     *time.Time `json:"sales_end"`
+	MinPerOrder  uint32     `json:"min_per_order"`
+	MaxPerOrder  *uint32    `json:"max_per_order"`
+	Hidden       bool       `json:"hidden"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	CurrentPrice     int64         `json:"current_price"`
+	CurrentTier      string        `json:"current_tier,omitempty"`
+	NextPriceChanges []PriceChange `json:"next_price_changes,omitempty"`
+	Indicative       *Indicative   `json:"indicative,omitempty"`
+}
+
+// current price converted into the buyer's currency, informational only, charges stay in the ticket currency
+type Indicative struct {
+	Currency string     `json:"currency"`
+	Price    int64      `json:"price"` // minor units of currency
+	Rate     money.Rate `json:"rate"`
+	RateAt   time.Time  `json:"rate_at"`
+}
+
+// Exchange Rate Model
+type ExchangeRate struct {
+	Base      string     `json:"base"`
+	Quote     string     `json:"quote"`
+	Rate      money.Rate `json:"rate"` // one unit of base in quote
+	Source    string     `json:"source"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Promo Code Model
+type PromoCode struct {
+	ID            uint32     `json:"id"`
+	ConferenceID  uint32     `json:"conference_id"`
+	Code          string     `json:"code"`
+	DiscountType  string     `json:"discount_type"` // percent or fixed
+	Amount        int64      `json:"amount"`        // whole percent or minor units
+	MaxUses       *uint32    `json:"max_uses"`
+	PerUserLimit  *uint32    `json:"per_user_limit"`
+	Uses          uint32     `json:"uses"`
+	ValidFrom     *time.Time `json:"valid_from"`
+	ValidUntil    *time.Time `json:"valid_until"`
+	TicketTypeIDs []uint32   `json:"ticket_type_ids"` // empty means every visible type
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Price Tier Model
+type PriceTier struct {
+	ID           uint32     `json:"id"`
+	TicketTypeID uint32     `json:"ticket_type_id"`
+	Name         string     `json:"name"`
+	Price        int64      `json:"price"` // minor units
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	MaxSold      *uint32    `json:"max_sold"`
+	Position     int        `json:"position"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Registration Question Model
+type RegistrationQuestion struct {
+	ID               uint32    `json:"id"`
+	ConferenceID     uint32    `json:"conference_id"`
+	TicketTypeID     *uint32   `json:"ticket_type_id"` // nil asks every ticket type
+	Label            string    `json:"label"`
+	Kind             string    `json:"kind"` // text, choice, multi_choice, boolean or number
+	Options          []string  `json:"options"`
+	Required         bool      `json:"required"`
+	ShowIfQuestionID *uint32   `json:"show_if_question_id"` // asked only when that question was answered with show_if_answer
+	ShowIfAnswer     *string   `json:"show_if_answer"`
+	Position         int       `json:"position"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// upcoming price change, triggered by a date or by a sales milestone
+type PriceChange struct {
+	At        *time.Time `json:"at,omitempty"`
+	AfterSold *uint32    `json:"after_sold,omitempty"`
+	Price     int64      `json:"price"`
+	Tier      string     `json:"tier,omitempty"`
+}
+
+// Refund Rule Model
+type RefundRule struct {
+	ID            uint32 `json:"id"`
+	ConferenceID  uint32 `json:"conference_id"`
+	HoursBefore   uint32 `json:"hours_before"`
+	RefundPercent uint32 `json:"refund_percent"`
 }
 
 // Booking Model
 type Booking struct {
-	ID            uint32    `json:"id"`
-	UserID        uint32    `json:"user_id"`
-	ConferenceID  uint32    `json:"conference_id"`
-	TicketsBooked uint32    `json:"tickets_booked"`
-	Status        string    `json:"status"`
-	BookedAt      time.Time `json:"booked_at"`
+	ID             uint32     `json:"id"`
+	UserID         uint32     `json:"user_id"`
+	ConferenceID   uint32     `json:"conference_id"`
+	TicketsBooked  uint32     `json:"tickets_booked"`
+	Status         string     `json:"status"`
+	TicketTypeID   uint32     `json:"ticket_type_id"`
+	UnitPrice      int64      `json:"unit_price"`
+	TotalPrice     int64      `json:"total_price"`
+	Currency       string     `json:"currency"`
+	PriceTierID    *uint32    `json:"price_tier_id"`
+	PromoCodeID    *uint32    `json:"promo_code_id"`
+	Discount       int64      `json:"discount"`
+	RefundDue      int64      `json:"refund_due"`
+	RefundedAmount int64      `json:"refunded_amount"`
+	BookedAt       time.Time  `json:"booked_at"`
+	CancelledAt    *time.Time `json:"cancelled_at"`
+	BillingName    string     `json:"billing_name"`
+	BillingAddress string     `json:"billing_address"`
+	BillingTaxID   string     `json:"billing_tax_id"`
+	BillingCountry string     `json:"billing_country"`
+	NetAmount      int64      `json:"net_amount"`
+	TaxAmount      int64      `json:"tax_amount"`
+	TaxRateBP      uint32     `json:"tax_rate_bp"`
+	TaxCountry     string     `json:"tax_country"`
+	TaxInclusive   bool       `json:"tax_inclusive"`
+	ReverseCharge  bool       `json:"reverse_charge"`
+
+	HoldID  *string `json:"hold_id"`  // hold the booking was confirmed from
+	OrderID *uint32 `json:"order_id"` // checkout the booking was made in, shares its payment
+
+	Attendees []Attendee `json:"attendees"` // named when booking, given to tickets in order as they are issued
+
+	// indicative conversion snapshot for reporting, nil without a preferred currency or known rate
+	DisplayCurrency *string     `json:"display_currency"`
+	ExchangeRate    *money.Rate `json:"exchange_rate"`
+	ExchangeRateAt  *time.Time  `json:"exchange_rate_at"`
+	ConvertedTotal  *int64      `json:"converted_total"`
+}
+
+// Booking List Item Model (one row of a customer's bookings)
+type BookingListItem struct {
+	ID            uint32            `json:"id"`
+	TicketTypeID  uint32            `json:"ticket_type_id"`
+	TicketType    string            `json:"ticket_type"`
+	TicketsBooked uint32            `json:"tickets_booked"`
+	TotalPrice    int64             `json:"total_price"` // minor units
+	Currency      string            `json:"currency"`
+	Status        string            `json:"status"`
+	OrderID       *uint32           `json:"order_id"`
+	BookedAt      time.Time         `json:"booked_at"`
+	CancelledAt   *time.Time        `json:"cancelled_at"`
+	Conference    ConferenceSummary `json:"conference"`
+}
+
+// Waitlist Entry Model
+type WaitlistEntry struct {
+	ID             uint32     `json:"id"`
+	UserID         uint32     `json:"user_id"`
+	ConferenceID   uint32     `json:"conference_id"`
+	TicketTypeID   *uint32    `json:"ticket_type_id"` // nil takes any visible type
+	Quantity       uint32     `json:"quantity"`
+	Status         string     `json:"status"` // waiting, offered, claimed, expired, left or closed
+	HoldID         *string    `json:"hold_id"`
+	OfferedAt      *time.Time `json:"offered_at"`
+	OfferExpiresAt *time.Time `json:"offer_expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Position       *uint32    `json:"position,omitempty"` // place in line while waiting
+}
+
+// Cart Item Model
+type CartItem struct {
+	ID           uint32    `json:"id"`
+	UserID       uint32    `json:"user_id"`
+	ConferenceID uint32    `json:"conference_id"`
+	TicketTypeID uint32    `json:"ticket_type_id"`
+	Quantity     uint32    `json:"quantity"`
+	PromoCode    string    `json:"promo_code,omitempty"`
+	AddedAt      time.Time `json:"added_at"`
+
+	Conference string `json:"conference"`
+	TicketType string `json:"ticket_type"`
+	UnitPrice  int64  `json:"unit_price"` // list price, tiers and discounts apply at checkout
+	Currency   string `json:"currency"`
+}
+
+// Order Model
+type Order struct {
+	ID        uint32    `json:"id"`
+	UserID    uint32    `json:"user_id"`
+	Status    string    `json:"status"` // pending_payment, paid or failed
+	Total     int64     `json:"total"`  // minor units, sum of the booking totals
+	Currency  string    `json:"currency"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Bookings []Booking `json:"bookings,omitempty"`
+}
+
+// Hold Model
+type Hold struct {
+	ID           string    `json:"id"`
+	UserID       uint32    `json:"user_id"`
+	ConferenceID uint32    `json:"conference_id"`
+	TicketTypeID uint32    `json:"ticket_type_id"`
+	Quantity     uint32    `json:"quantity"`
+	PromoCode    string    `json:"promo_code,omitempty"`
+	Status       string    `json:"status"` // active, confirmed, released or expired
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	BookingID    *uint32   `json:"booking_id"`
+
+	GroupRequestID *uint32 `json:"group_request_id,omitempty"` // approved group booking, not bound by the order limits
+}
+
+// Group Booking Request Model
+type GroupBookingRequest struct {
+	ID           uint32     `json:"id"`
+	UserID       uint32     `json:"user_id"` // the group leader, books and pays for the group and names attendees later
+	ConferenceID uint32     `json:"conference_id"`
+	TicketTypeID uint32     `json:"ticket_type_id"`
+	Quantity     uint32     `json:"quantity"`
+	Note         string     `json:"note"`
+	Status       string     `json:"status"` // pending, approved, declined, cancelled, booked or expired
+	DecisionNote string     `json:"decision_note"`
+	HoldID       *string    `json:"hold_id"` // confirm it with POST /booking once approved
+	HoldExpires  *time.Time `json:"hold_expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DecidedAt    *time.Time `json:"decided_at"`
+	LeaderName   string     `json:"leader_name,omitempty"`
+	LeaderEmail  string     `json:"leader_email,omitempty"`
+}
+
+// Booking Limits Model
+type BookingLimits struct {
+	MaxPerOrder *uint32 `json:"max_per_order"` // nil means no limit
+	MaxPerUser  *uint32 `json:"max_per_user"`
+}
+
+// Idempotency Key Model
+type IdempotencyKey struct {
+	ID          uint32    `json:"id"`
+	UserID      uint32    `json:"user_id"`
+	Key         string    `json:"key"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Fingerprint string    `json:"fingerprint"`
+	Status      string    `json:"status"` // processing or completed
+	StatusCode  *int      `json:"status_code"`
+	ContentType *string   `json:"content_type"`
+	Body        []byte    `json:"-"`
+	LockedAt    time.Time `json:"locked_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Inventory Drift Model
+type InventoryDrift struct {
+	TicketTypeID uint32 `json:"ticket_type_id"`
+	ConferenceID uint32 `json:"conference_id"`
+	Conference   string `json:"conference"`
+	TicketType   string `json:"ticket_type"`
+	Quota        uint32 `json:"quota"`
+	Held         int64  `json:"held"`     // in active holds, expired ones included until released
+	Booked       int64  `json:"booked"`   // in pending or paid bookings
+	Stored       int64  `json:"stored"`   // available as recorded
+	Expected     int64  `json:"expected"` // quota minus held and booked
 }
 
 // Ticket Model
 type Ticket struct {
-	ID         uint32    `json:"id"`
-	BookingID  uint32    `json:"booking_id"`
-	TicketCode string    `json:"ticket_code"`
-	IssuedAt   time.Time `json:"issued_at"`
+	ID              uint32         `json:"id"`
+	BookingID       uint32         `json:"booking_id"`
+	TicketCode      string         `json:"ticket_code"`
+	Status          string         `json:"status"`
+	AttendeeName    *string        `json:"attendee_name"`
+	AttendeeEmail   *string        `json:"attendee_email"`
+	AssignedAt      *time.Time     `json:"assigned_at"`
+	Answers         map[uint32]any `json:"answers"`
+	HolderID        *uint32        `json:"holder_id"` // set when received by transfer, otherwise the buyer holds it
+	TransferredFrom *uint32        `json:"transferred_from"`
+	AccessToken     string         `json:"access_token,omitempty"` // shared with the attendee to view the ticket
+	IssuedAt        time.Time      `json:"issued_at"`
+	VoidedAt        *time.Time     `json:"voided_at"`
+}
+
+// Attendee Model
+type Attendee struct {
+	Name    string         `json:"name"`
+	Email   string         `json:"email"`
+	Answers map[uint32]any `json:"answers,omitempty"` // registration answers keyed by question id
+}
+
+// Ticket List Item Model (one ticket a customer holds)
+type TicketListItem struct {
+	Ticket
+	TicketType string            `json:"ticket_type"`
+	Conference ConferenceSummary `json:"conference"`
+}
+
+// Ticket Transfer Model
+type TicketTransfer struct {
+	ID           uint32     `json:"id"`
+	TicketID     uint32     `json:"ticket_id"`
+	TicketCode   string     `json:"ticket_code"`
+	ConferenceID uint32     `json:"conference_id"`
+	Conference   string     `json:"conference"`
+	FromUserID   *uint32    `json:"from_user_id"`
+	ToEmail      string     `json:"to_email"`
+	ToUserID     *uint32    `json:"to_user_id"`
+	NewTicketID  *uint32    `json:"new_ticket_id"`
+	Status       string     `json:"status"` // pending, accepted, declined, cancelled or expired
+	CreatedAt    time.Time  `json:"created_at"`
+	ResolvedAt   *time.Time `json:"resolved_at"`
+}
+
+// Transfer Policy Model
+type TransferPolicy struct {
+	Enabled     bool   `json:"enabled"`
+	CutoffHours uint32 `json:"cutoff_hours"` // transfers close this many hours before the event
+}
+
+// Ticket View Model (what an attendee sees without an account)
+type TicketView struct {
+	TicketCode   string    `json:"ticket_code"`
+	Status       string    `json:"status"`
+	AttendeeName *string   `json:"attendee_name"`
+	Conference   string    `json:"conference"`
+	Location     string    `json:"location"`
+	EventTime    time.Time `json:"event_time"`
+	TicketType   string    `json:"ticket_type"`
+}
+
+// Conference Attendee Model (one row per active ticket)
+type ConferenceAttendee struct {
+	TicketID      uint32         `json:"ticket_id"`
+	TicketCode    string         `json:"ticket_code"`
+	TicketType    string         `json:"ticket_type"`
+	AttendeeName  *string        `json:"attendee_name"` // nil until the buyer names the ticket
+	AttendeeEmail *string        `json:"attendee_email"`
+	AssignedAt    *time.Time     `json:"assigned_at"`
+	Answers       map[uint32]any `json:"answers"`
+	BookingID     uint32         `json:"booking_id"`
+	BuyerName     string         `json:"buyer_name"`
+	BuyerEmail    string         `json:"buyer_email"`
+}
+
+// Conference Transition Model
+type ConferenceTransition struct {
+	ID           uint32    `json:"id"`
+	ConferenceID uint32    `json:"conference_id"`
+	FromStatus   string    `json:"from_status"`
+	ToStatus     string    `json:"to_status"`
+	ChangedBy    *uint32   `json:"changed_by"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Job Run Model
+type JobRun struct {
+	ID         uint64    `json:"id"`
+	JobName    string    `json:"job_name"`
+	Instance   string    `json:"instance"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      *string   `json:"error"`
+}
+
+// Notification Model
+type Notification struct {
+	ID        uint64     `json:"id"`
+	UserID    *uint32    `json:"user_id"`
+	Email     string     `json:"email"`
+	Subject   string     `json:"subject"`
+	Body      string     `json:"body"`
+	Status    string     `json:"status"`
+	Attempts  uint32     `json:"attempts"`
+	LastError *string    `json:"last_error"`
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at"`
+}
+
+// Media Variant Model
+type MediaVariant struct {
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	URL    string `json:"url,omitempty"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Conference Media Model
+type ConferenceMedia struct {
+	ID           uint32         `json:"id"`
+	ConferenceID uint32         `json:"conference_id"`
+	Kind         string         `json:"kind"`
+	Caption      string         `json:"caption"`
+	ContentType  string         `json:"content_type"`
+	Variants     []MediaVariant `json:"variants"`
+	UploadedBy   *uint32        `json:"uploaded_by"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+// Payment Model
+type Payment struct {
+	ID            uint32    `json:"id"`
+	BookingID     *uint32   `json:"booking_id"` // nil when the payment is for an order
+	OrderID       *uint32   `json:"order_id"`
+	Provider      string    `json:"provider"`
+	IntentID      string    `json:"intent_id"`
+	Amount        int64     `json:"amount"`
+	Currency      string    `json:"currency"`
+	Status        string    `json:"status"`
+	FailureReason *string   `json:"failure_reason"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Refund Model
+type Refund struct {
+	ID               uint32     `json:"id"`
+	BookingID        uint32     `json:"booking_id"`
+	PaymentID        uint32     `json:"payment_id"`
+	IntentID         string     `json:"intent_id"`
+	Amount           int64      `json:"amount"`
+	Reason           string     `json:"reason"`
+	Status           string     `json:"status"`
+	ProviderRefundID *string    `json:"provider_refund_id"`
+	Attempts         uint32     `json:"attempts"`
+	LastError        *string    `json:"last_error"`
+	CreatedAt        time.Time  `json:"created_at"`
+	SettledAt        *time.Time `json:"settled_at"`
+}
+
+// Organizer Profile Model
+type OrganizerProfile struct {
+	OrganizerID      uint32    `json:"organizer_id"`
+	LegalName        string    `json:"legal_name"`
+	Address          string    `json:"address"`
+	TaxID            string    `json:"tax_id"`
+	InvoicePrefix    string    `json:"invoice_prefix"`
+	TaxCountry       *string   `json:"tax_country"`
+	ChargesTax       bool      `json:"charges_tax"`
+	PricesIncludeTax bool      `json:"prices_include_tax"`
+	TaxCategory      string    `json:"tax_category"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Invoice Model (also used for credit notes)
+type Invoice struct {
+	ID               uint32    `json:"id"`
+	BookingID        *uint32   `json:"booking_id"`
+	OrganizerID      *uint32   `json:"organizer_id"`
+	Kind             string    `json:"kind"`
+	Number           string    `json:"number"`
+	RelatedInvoiceID *uint32   `json:"related_invoice_id"`
+	Currency         string    `json:"currency"`
+	Subtotal         int64     `json:"subtotal"`
+	Tax              int64     `json:"tax"`
+	Total            int64     `json:"total"`
+	IssuedAt         time.Time `json:"issued_at"`
+}
+
+// Tax Country Model
+type TaxCountry struct {
+	Code         string `json:"code"`
+	Name         string `json:"name"`
+	VATArea      string `json:"vat_area"`
+	VATIDPattern string `json:"vat_id_pattern"`
+}
+
+// Tax Rate Model
+type TaxRate struct {
+	ID         uint32     `json:"id"`
+	Country    string     `json:"country"`
+	Category   string     `json:"category"`
+	RateBP     uint32     `json:"rate_bp"`
+	ValidFrom  time.Time  `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until"`
 }
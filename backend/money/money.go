@@ -0,0 +1,73 @@
+package money
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// currencies without minor units
+var zeroDecimal = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true, "KMF": true,
+	"KRW": true, "PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true,
+	"XOF": true, "XPF": true,
+}
+
+// currencies with three decimals
+var threeDecimal = map[string]bool{
+	"BHD": true, "IQD": true, "JOD": true, "KWD": true, "LYD": true, "OMR": true, "TND": true,
+}
+
+// checks a 3 letter ISO code
+func ValidCurrency(currency string) bool {
+	return currencyPattern.MatchString(currency)
+}
+
+// number of minor unit digits of a currency, e.g. 2 for USD, 0 for JPY
+func Exponent(currency string) int {
+	switch {
+	case zeroDecimal[currency]:
+		return 0
+	case threeDecimal[currency]:
+		return 3
+	}
+	return 2
+}
+
+// formats minor units with the decimals of the currency, e.g. 123456 USD => 1,234.56
+func Format(amount int64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	decimals := Exponent(currency)
+	unit := pow10(decimals)
+	major, minor := amount/unit, amount%unit
+
+	// thousands separators
+	digits := fmt.Sprint(major)
+	var grouped strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(d)
+	}
+
+	if decimals == 0 {
+		return sign + grouped.String()
+	}
+	return fmt.Sprintf("%s%s.%0*d", sign, grouped.String(), decimals, minor)
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for range n {
+		p *= 10
+	}
+	return p
+}
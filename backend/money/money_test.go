@@ -0,0 +1,51 @@
+package money
+
+import "testing"
+
+func TestExponent(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     int
+	}{
+		{"USD", 2},
+		{"EUR", 2},
+		{"JPY", 0},
+		{"KRW", 0},
+		{"KWD", 3},
+		{"BHD", 3},
+	}
+
+	for _, tt := range tests {
+		if got := Exponent(tt.currency); got != tt.want {
+			t.Errorf("Exponent(%s) = %d, want %d", tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{0, "USD", "0.00"},
+		{5, "USD", "0.05"},
+		{123456, "USD", "1,234.56"},
+		{100000000, "EUR", "1,000,000.00"},
+		{-5, "USD", "-0.05"},
+		{-123456, "USD", "-1,234.56"},
+		{0, "JPY", "0"},
+		{999, "JPY", "999"},
+		{1234567, "JPY", "1,234,567"},
+		{-1234567, "JPY", "-1,234,567"},
+		{1, "KWD", "0.001"},
+		{1234567, "KWD", "1,234.567"},
+		{-1500, "KWD", "-1.500"},
+	}
+
+	for _, tt := range tests {
+		if got := Format(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("Format(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// decimal places kept on exchange rates, matches numeric(20,10) in the database
+const RateScale = 10
+
+var ErrInvalidRate = errors.New("rate must be a positive decimal with at most 10 decimal places")
+
+// exchange rate as a fixed point decimal, never a float
+// serialised as a decimal string, e.g. "1.0845"
+type Rate struct {
+	scaled int64 // rate * 10^RateScale
+}
+
+// one unit of the base currency is worth Rate units of the quote currency
+type Pair struct {
+	Base  string `json:"base"`
+	Quote string `json:"quote"`
+	Rate  Rate   `json:"rate"`
+}
+
+// parses a decimal such as "0.92" or "157.3" without going through float
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > RateScale || !digitsOnly(whole) || !digitsOnly(fraction) {
+		return Rate{}, ErrInvalidRate
+	}
+
+	scaled, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", RateScale-len(fraction)), 10)
+	if !ok || !scaled.IsInt64() || scaled.Sign() <= 0 {
+		return Rate{}, ErrInvalidRate
+	}
+
+	return Rate{scaled: scaled.Int64()}, nil
+}
+
+func digitsOnly(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// rate of one unit, used when both currencies are the same
+func One() Rate {
+	return Rate{scaled: pow10(RateScale)}
+}
+
+func (r Rate) IsZero() bool {
+	return r.scaled == 0
+}
+
+// decimal form without trailing zeros
+func (r Rate) String() string {
+	unit := pow10(RateScale)
+	s := fmt.Sprintf("%d.%0*d", r.scaled/unit, RateScale, r.scaled%unit)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// accepts "1.08" as well as a bare 1.08, both parsed from their text
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseRate(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// implements sql scanning of numeric columns selected as text
+func (r *Rate) Scan(src any) error {
+	if src == nil {
+		*r = Rate{}
+		return nil
+	}
+	s, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into rate", src)
+	}
+	parsed, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// implements sql values, stored into numeric columns as text
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+// converts minor units of one currency into minor units of another, rounded half up
+// the exponents of both currencies are taken into account, e.g. 1000 USD cents at 150 => 1500 JPY
+func Convert(amount int64, from, to string, rate Rate) int64 {
+	numerator := new(big.Int).Mul(big.NewInt(amount), big.NewInt(rate.scaled))
+	denominator := big.NewInt(pow10(RateScale))
+
+	shift := Exponent(to) - Exponent(from)
+	if shift > 0 {
+		numerator.Mul(numerator, big.NewInt(pow10(shift)))
+	} else if shift < 0 {
+		denominator.Mul(denominator, big.NewInt(pow10(-shift)))
+	}
+
+	// half up away from zero
+	negative := numerator.Sign() < 0
+	numerator.Abs(numerator)
+	numerator.Add(numerator, new(big.Int).Rsh(denominator, 1))
+	numerator.Quo(numerator, denominator)
+	if negative {
+		numerator.Neg(numerator)
+	}
+
+	return numerator.Int64()
+}
+
+// reads rates from csv lines of base,quote,rate
+// a header line and lines starting with # are skipped
+func ReadCSV(r io.Reader) ([]Pair, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	pairs := []Pair{}
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		base := strings.ToUpper(strings.TrimSpace(record[0]))
+		quote := strings.ToUpper(strings.TrimSpace(record[1]))
+		if first && base == "BASE" {
+			continue
+		}
+
+		rate, err := ParseRate(record[2])
+		if err != nil {
+			line, _ := reader.FieldPos(2)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		pairs = append(pairs, Pair{Base: base, Quote: quote, Rate: rate})
+	}
+
+	return pairs, nil
+}
@@ -0,0 +1,103 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // String of the parsed rate, empty when invalid
+	}{
+		{"1", "1"},
+		{"1.0845", "1.0845"},
+		{"157.3", "157.3"},
+		{" 0.92 ", "0.92"},
+		{".5", "0.5"},
+		{"2.500", "2.5"},
+		{"0.0000000001", "0.0000000001"},
+		{"1.1234567891", "1.1234567891"},
+		{"1.12345678900", "1.123456789"},
+		{"0.00000000001", ""},
+		{"1.12345678912", ""},
+		{"0", ""},
+		{"0.0", ""},
+		{"", ""},
+		{"-1.5", ""},
+		{"1e3", ""},
+		{"1.2.3", ""},
+		{"abc", ""},
+		{"99999999999", ""},
+	}
+
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.input)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalidRate) {
+				t.Errorf("ParseRate(%q) = %s, %v, want ErrInvalidRate", tt.input, rate, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRate(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got := rate.String(); got != tt.want {
+			t.Errorf("ParseRate(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		from, to string
+		rate     string
+		want     int64
+	}{
+		// same exponent
+		{1000, "USD", "EUR", "0.92", 920},
+		{1, "USD", "EUR", "0.5", 1},
+		{1, "USD", "EUR", "0.4999999999", 0},
+		{3, "USD", "EUR", "0.5", 2},
+		{100000000, "USD", "EUR", "0.9234567891", 92345679},
+
+		// half up away from zero for negative amounts
+		{-1, "USD", "EUR", "0.5", -1},
+		{-3, "USD", "EUR", "0.5", -2},
+		{-1, "USD", "EUR", "0.4999999999", 0},
+		{-1000, "USD", "EUR", "0.92", -920},
+
+		// 2 => 0 decimals
+		{1000, "USD", "JPY", "150", 1500},
+		{1050, "USD", "JPY", "150.3", 1578},
+		{-1050, "USD", "JPY", "150.3", -1578},
+
+		// 0 => 2 decimals
+		{1000, "JPY", "USD", "0.0066666667", 667},
+		{1, "JPY", "USD", "0.0066666667", 1},
+
+		// 2 => 3 decimals
+		{1000, "USD", "KWD", "0.3075", 3075},
+		{1, "USD", "KWD", "0.3075", 3},
+
+		// 3 => 0 decimals
+		{1, "KWD", "JPY", "490.1234567891", 0},
+		{2, "KWD", "JPY", "250", 1},
+		{1000, "KWD", "JPY", "490.1234567891", 490},
+
+		// identity
+		{12345, "USD", "USD", "1", 12345},
+	}
+
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.rate)
+		if err != nil {
+			t.Fatalf("ParseRate(%q) failed: %v", tt.rate, err)
+		}
+		if got := Convert(tt.amount, tt.from, tt.to, rate); got != tt.want {
+			t.Errorf("Convert(%d %s => %s at %s) = %d, want %d", tt.amount, tt.from, tt.to, tt.rate, got, tt.want)
+		}
+	}
+}
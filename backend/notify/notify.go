@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// outgoing message to one recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// delivers messages to recipients
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// picks smtp when SMTP_ADDR is set, otherwise messages are only logged
+func NewSenderFromEnv() Sender {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return LogSender{}
+	}
+
+	return &SMTPSender{
+		Addr:     addr,
+		From:     os.Getenv("SMTP_FROM"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+}
+
+// writes messages to the server log => local development
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("notify: to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// sends plain text mail through an smtp relay
+type SMTPSender struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host := strings.Split(s.Addr, ":")[0]
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// header values come from user input, line breaks would let them add headers
+	to := headerValue(msg.To)
+	subject := mime.QEncoding.Encode("utf-8", headerValue(msg.Subject))
+	body := fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		headerValue(s.From), to, subject, msg.Body,
+	)
+
+	return smtp.SendMail(s.Addr, auth, s.From, []string{to}, []byte(body))
+}
+
+// drops carriage returns and line feeds from a header value
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
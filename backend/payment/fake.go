@@ -0,0 +1,146 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// payment method that makes the fake provider decline
+const FakeDeclinedMethod = "fake_declined"
+
+// header carrying the hex hmac-sha256 of the webhook body
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// in-memory provider for local development and tests, no money moves
+// confirming with FakeDeclinedMethod fails, any other method succeeds
+type FakeProvider struct {
+	secret []byte
+
+	mu         sync.Mutex
+	intents    map[string]*Intent
+	refunds    map[string]int64  // refunded amount per intent
+	references map[string]Refund // refund issued per idempotency reference
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		secret:     []byte(webhookSecret),
+		intents:    make(map[string]*Intent),
+		refunds:    make(map[string]int64),
+		references: make(map[string]Refund),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) CreateIntent(ctx context.Context, amount int64, currency, reference string) (*Intent, error) {
+	if amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+
+	intent := &Intent{
+		ID:           "pi_fake_" + uuid.New().String(),
+		Amount:       amount,
+		Currency:     currency,
+		Status:       IntentRequiresConfirmation,
+		ClientSecret: "secret_" + uuid.New().String(),
+	}
+
+	p.mu.Lock()
+	p.intents[intent.ID] = intent
+	p.mu.Unlock()
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (p *FakeProvider) Confirm(ctx context.Context, intentID, paymentMethod string) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, errors.New("payment intent not found")
+	}
+
+	if intent.Status == IntentRequiresConfirmation {
+		intent.Status = IntentSucceeded
+		if paymentMethod == FakeDeclinedMethod {
+			intent.Status = IntentFailed
+		}
+	}
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, intentID string, amount int64, reference string) (*Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if refund, ok := p.references[reference]; ok {
+		if refund.IntentID != intentID || refund.Amount != amount {
+			return nil, errors.New("refund reference reused with different parameters")
+		}
+		return &refund, nil
+	}
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, errors.New("payment intent not found")
+	}
+
+	if intent.Status != IntentSucceeded {
+		return nil, errors.New("only succeeded payments can be refunded")
+	}
+
+	if amount <= 0 || p.refunds[intentID]+amount > intent.Amount {
+		return nil, errors.New("refund exceeds captured amount")
+	}
+
+	p.refunds[intentID] += amount
+	refund := Refund{
+		ID:       "re_fake_" + uuid.New().String(),
+		IntentID: intentID,
+		Amount:   amount,
+		Status:   RefundSucceeded,
+	}
+	if reference != "" {
+		p.references[reference] = refund
+	}
+	return &refund, nil
+}
+
+func (p *FakeProvider) VerifyWebhook(payload []byte, header http.Header) (*Event, error) {
+	signature, err := hex.DecodeString(header.Get(FakeSignatureHeader))
+	if err != nil || !hmac.Equal(signature, p.sign(payload)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// signature for a webhook body => lets tests and scripts simulate provider callbacks
+func (p *FakeProvider) SignWebhook(payload []byte) string {
+	return hex.EncodeToString(p.sign(payload))
+}
+
+func (p *FakeProvider) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,81 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+)
+
+// intent statuses
+const (
+	IntentRequiresConfirmation = "requires_confirmation"
+	IntentSucceeded            = "succeeded"
+	IntentFailed               = "failed"
+)
+
+// refund statuses
+const (
+	RefundPending   = "pending" // provider settles later and reports through a webhook
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+// webhook event types
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+	EventRefundSucceeded  = "refund.succeeded"
+	EventRefundFailed     = "refund.failed"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// money collection attempt at the provider
+type Intent struct {
+	ID           string `json:"intent_id"`
+	Amount       int64  `json:"amount"` // minor units
+	Currency     string `json:"currency"`
+	Status       string `json:"status"`
+	ClientSecret string `json:"client_secret"` // handed to the client to complete payment
+}
+
+// money returned to the payer
+type Refund struct {
+	ID       string `json:"refund_id"`
+	IntentID string `json:"intent_id"`
+	Amount   int64  `json:"amount"`
+	Status   string `json:"status"`
+}
+
+// verified notification sent by the provider
+type Event struct {
+	Type     string `json:"type"`
+	IntentID string `json:"intent_id"`
+	RefundID string `json:"refund_id,omitempty"`
+	Amount   int64  `json:"amount"`
+}
+
+// provider agnostic payments interface
+type PaymentProvider interface {
+	Name() string
+	CreateIntent(ctx context.Context, amount int64, currency, reference string) (*Intent, error)
+	Confirm(ctx context.Context, intentID, paymentMethod string) (*Intent, error)
+	// reference is an idempotency key, retrying with it returns the first refund instead of refunding twice
+	Refund(ctx context.Context, intentID string, amount int64, reference string) (*Refund, error)
+	VerifyWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// picks the provider from PAYMENT_PROVIDER, only the fake provider ships today
+func NewProviderFromEnv() (PaymentProvider, error) {
+	switch os.Getenv("PAYMENT_PROVIDER") {
+	case "", "fake":
+		secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+		if secret == "" {
+			secret = "fake-webhook-secret"
+		}
+		return NewFakeProvider(secret), nil
+	default:
+		return nil, errors.New("unknown PAYMENT_PROVIDER")
+	}
+}
@@ -0,0 +1,149 @@
+package pricing
+
+import (
+	"backend/models"
+	"sort"
+	"time"
+)
+
+// price of one ticket and the tier that produced it
+type Quote struct {
+	Price int64
+	Tier  *models.PriceTier // nil when the ticket type base price applies
+}
+
+// reports whether a tier applies at the given time and sold count
+func active(tier models.PriceTier, sold uint32, now time.Time) bool {
+	if tier.StartsAt != nil && now.Before(*tier.StartsAt) {
+		return false
+	}
+	if tier.EndsAt != nil && !now.Before(*tier.EndsAt) {
+		return false
+	}
+	if tier.MaxSold != nil && sold >= *tier.MaxSold {
+		return false
+	}
+	return true
+}
+
+// picks the first active tier by position, falling back to the base price
+func Evaluate(basePrice int64, tiers []models.PriceTier, sold uint32, now time.Time) Quote {
+	ordered := sorted(tiers)
+	for i := range ordered {
+		if active(ordered[i], sold, now) {
+			return Quote{Price: ordered[i].Price, Tier: &ordered[i]}
+		}
+	}
+	return Quote{Price: basePrice}
+}
+
+// total for quantity tickets priced one by one, so an order crossing a
+// sales milestone pays each side of it at the right price
+func Total(basePrice int64, tiers []models.PriceTier, sold, quantity uint32, now time.Time) (int64, Quote) {
+	first := Evaluate(basePrice, tiers, sold, now)
+
+	total := first.Price
+	for i := uint32(1); i < quantity; i++ {
+		total += Evaluate(basePrice, tiers, sold+i, now).Price
+	}
+
+	return total, first
+}
+
+// next date based and next sales based price change, at most one of each
+func NextChanges(basePrice int64, tiers []models.PriceTier, sold uint32, now time.Time) []models.PriceChange {
+	current := Evaluate(basePrice, tiers, sold, now)
+	changes := []models.PriceChange{}
+
+	// date triggers: every tier start or end in the future
+	var instants []time.Time
+	for _, tier := range tiers {
+		if tier.StartsAt != nil && tier.StartsAt.After(now) {
+			instants = append(instants, *tier.StartsAt)
+		}
+		if tier.EndsAt != nil && tier.EndsAt.After(now) {
+			instants = append(instants, *tier.EndsAt)
+		}
+	}
+	sort.Slice(instants, func(i, j int) bool { return instants[i].Before(instants[j]) })
+
+	for _, at := range instants {
+		next := Evaluate(basePrice, tiers, sold, at)
+		if next.Price != current.Price || tierID(next) != tierID(current) {
+			changes = append(changes, change(next, &at, nil))
+			break
+		}
+	}
+
+	// sales triggers: every milestone not reached yet
+	var milestones []uint32
+	for _, tier := range tiers {
+		if tier.MaxSold != nil && *tier.MaxSold > sold {
+			milestones = append(milestones, *tier.MaxSold)
+		}
+	}
+	sort.Slice(milestones, func(i, j int) bool { return milestones[i] < milestones[j] })
+
+	for _, milestone := range milestones {
+		next := Evaluate(basePrice, tiers, milestone, now)
+		if next.Price != current.Price || tierID(next) != tierID(current) {
+			changes = append(changes, change(next, nil, &milestone))
+			break
+		}
+	}
+
+	return changes
+}
+
+func change(quote Quote, at *time.Time, afterSold *uint32) models.PriceChange {
+	c := models.PriceChange{At: at, AfterSold: afterSold, Price: quote.Price}
+	if quote.Tier != nil {
+		c.Tier = quote.Tier.Name
+	}
+	return c
+}
+
+func tierID(quote Quote) uint32 {
+	if quote.Tier == nil {
+		return 0
+	}
+	return quote.Tier.ID
+}
+
+// tiers ordered by position then id
+func sorted(tiers []models.PriceTier) []models.PriceTier {
+	ordered := append([]models.PriceTier(nil), tiers...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Position != ordered[j].Position {
+			return ordered[i].Position < ordered[j].Position
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+	return ordered
+}
+
+// fills current price, tier and next changes of a ticket type for display
+func Annotate(ticketType *models.TicketType, tiers []models.PriceTier, now time.Time) {
+	sold := ticketType.Quota - ticketType.Available
+	quote := Evaluate(ticketType.Price, tiers, sold, now)
+
+	ticketType.CurrentPrice = quote.Price
+	ticketType.CurrentTier = ""
+	if quote.Tier != nil {
+		ticketType.CurrentTier = quote.Tier.Name
+	}
+	ticketType.NextPriceChanges = NextChanges(ticketType.Price, tiers, sold, now)
+}
+
+// discount of a promo code on an order total, never more than the total
+// percent amounts are whole percents rounded down, fixed amounts are minor units per order
+func Discount(discountType string, amount, total int64) int64 {
+	var discount int64
+	switch discountType {
+	case "percent":
+		discount = total * amount / 100
+	case "fixed":
+		discount = amount
+	}
+	return min(discount, total)
+}
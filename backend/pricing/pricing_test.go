@@ -0,0 +1,89 @@
+package pricing
+
+import (
+	"backend/models"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+	hundred := uint32(100)
+
+	earlyBird := models.PriceTier{ID: 1, Name: "early bird", Price: 5000, EndsAt: &after, Position: 1}
+	firstHundred := models.PriceTier{ID: 2, Name: "first 100", Price: 7500, MaxSold: &hundred, Position: 2}
+	ended := models.PriceTier{ID: 3, Name: "ended", Price: 1000, EndsAt: &before, Position: 0}
+	upcoming := models.PriceTier{ID: 4, Name: "upcoming", Price: 2000, StartsAt: &after, Position: 0}
+
+	tests := []struct {
+		name  string
+		tiers []models.PriceTier
+		sold  uint32
+		now   time.Time
+		price int64
+		tier  uint32 // 0 when the base price applies
+	}{
+		{"no tiers", nil, 0, now, 10000, 0},
+		{"first active tier by position", []models.PriceTier{firstHundred, earlyBird}, 0, now, 5000, 1},
+		{"tier ends at its end time", []models.PriceTier{earlyBird, firstHundred}, 0, after, 7500, 2},
+		{"sales milestone reached", []models.PriceTier{firstHundred}, 100, now, 10000, 0},
+		{"below sales milestone", []models.PriceTier{firstHundred}, 99, now, 7500, 2},
+		{"ended and upcoming tiers skipped", []models.PriceTier{ended, upcoming}, 0, now, 10000, 0},
+		{"tier starts at its start time", []models.PriceTier{upcoming}, 0, after, 2000, 4},
+	}
+
+	for _, tt := range tests {
+		quote := Evaluate(10000, tt.tiers, tt.sold, tt.now)
+		if quote.Price != tt.price || tierID(quote) != tt.tier {
+			t.Errorf("%s: Evaluate = %d tier %d, want %d tier %d", tt.name, quote.Price, tierID(quote), tt.price, tt.tier)
+		}
+	}
+}
+
+func TestTotal(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	ten := uint32(10)
+	tiers := []models.PriceTier{{ID: 1, Price: 500, MaxSold: &ten}}
+
+	tests := []struct {
+		name      string
+		sold      uint32
+		quantity  uint32
+		total     int64
+		firstTier uint32
+	}{
+		{"single ticket in tier", 0, 1, 500, 1},
+		{"order inside the tier", 0, 10, 5000, 1},
+		{"order crossing the milestone", 8, 4, 500*2 + 1000*2, 1},
+		{"order after the milestone", 10, 3, 3000, 0},
+	}
+
+	for _, tt := range tests {
+		total, first := Total(1000, tiers, tt.sold, tt.quantity, now)
+		if total != tt.total || tierID(first) != tt.firstTier {
+			t.Errorf("%s: Total = %d first tier %d, want %d first tier %d", tt.name, total, tierID(first), tt.total, tt.firstTier)
+		}
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	tests := []struct {
+		discountType  string
+		amount, total int64
+		want          int64
+	}{
+		{"percent", 10, 10000, 1000},
+		{"percent", 15, 999, 149}, // rounded down
+		{"percent", 100, 4321, 4321},
+		{"fixed", 500, 10000, 500},
+		{"fixed", 500, 300, 300}, // never more than the total
+		{"unknown", 500, 10000, 0},
+	}
+
+	for _, tt := range tests {
+		if got := Discount(tt.discountType, tt.amount, tt.total); got != tt.want {
+			t.Errorf("Discount(%s, %d, %d) = %d, want %d", tt.discountType, tt.amount, tt.total, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package pricing
+
+import (
+	"backend/models"
+	"time"
+)
+
+// percent refunded when cancelling at now, from the rule with the largest
+// hours_before still ahead of the event
+// without rules the full amount is refunded until the event starts
+// reports false once the event has started, when bookings cannot be cancelled
+func RefundPercent(rules []models.RefundRule, eventTime, now time.Time) (uint32, bool) {
+	if !now.Before(eventTime) {
+		return 0, false
+	}
+	if len(rules) == 0 {
+		return 100, true
+	}
+
+	hoursLeft := eventTime.Sub(now).Hours()
+
+	var matched *models.RefundRule
+	for i := range rules {
+		if float64(rules[i].HoursBefore) > hoursLeft {
+			continue
+		}
+		if matched == nil || rules[i].HoursBefore > matched.HoursBefore {
+			matched = &rules[i]
+		}
+	}
+
+	// inside the last window => nothing back
+	if matched == nil {
+		return 0, true
+	}
+	return matched.RefundPercent, true
+}
+
+// amount refunded from what is still held, whole percents rounded down
+func Refund(percent uint32, held int64) int64 {
+	if held <= 0 {
+		return 0
+	}
+	return held * int64(percent) / 100
+}
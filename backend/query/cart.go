@@ -0,0 +1,302 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// fetches the cart of a user with list prices
+func GetCart(ctx context.Context, db *pgxpool.Pool, userID uint32) ([]models.CartItem, error) {
+	getQuery := `
+		SELECT ci.id, ci.user_id, ci.conference_id, ci.ticket_type_id, ci.quantity, ci.promo_code, ci.added_at,
+			c.title, t.name, t.price, t.currency
+		FROM cart_items ci
+		JOIN conferences c ON c.id = ci.conference_id
+		JOIN ticket_types t ON t.id = ci.ticket_type_id
+		WHERE ci.user_id = $1
+		ORDER BY ci.added_at, ci.id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.CartItem])
+}
+
+// performed by customer
+// adds tickets to the cart, adding a ticket type again raises its quantity
+// nothing is reserved until checkout
+func AddCartItem(ctx context.Context, db *pgxpool.Pool, item *models.CartItem) (uint32, error) {
+	// queries
+	getQuery := `
+		SELECT 1 FROM ticket_types t
+		JOIN conferences c ON c.id = t.conference_id
+		WHERE t.id = $1 AND c.id = $2 AND c.deleted_at IS NULL;
+	`
+	upsertQuery := `
+		INSERT INTO cart_items (user_id, conference_id, ticket_type_id, quantity, promo_code)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, ticket_type_id) DO UPDATE
+		SET quantity = cart_items.quantity + EXCLUDED.quantity,
+			promo_code = CASE WHEN EXCLUDED.promo_code = '' THEN cart_items.promo_code ELSE EXCLUDED.promo_code END
+		RETURNING id;
+	`
+
+	// validate input
+	item.PromoCode = strings.ToUpper(strings.TrimSpace(item.PromoCode))
+	if item.Quantity == 0 {
+		return 0, errors.New("quantity should be greater than 0")
+	}
+
+	if item.TicketTypeID == 0 {
+		return 0, errors.New("ticket type is required")
+	}
+
+	var exists int
+	err := db.QueryRow(ctx, getQuery, item.TicketTypeID, item.ConferenceID).Scan(&exists)
+	if err != nil {
+		return 0, errors.New("ticket type not found for this conference")
+	}
+
+	var itemID uint32
+	err = db.QueryRow(ctx, upsertQuery,
+		item.UserID,
+		item.ConferenceID,
+		item.TicketTypeID,
+		item.Quantity,
+		item.PromoCode,
+	).Scan(&itemID)
+
+	return itemID, err
+}
+
+// performed by customer
+func UpdateCartItem(ctx context.Context, db *pgxpool.Pool, itemID, userID, quantity uint32) error {
+	updateQuery := `
+		UPDATE cart_items SET quantity = $1
+		WHERE id = $2 AND user_id = $3;
+	`
+
+	if quantity == 0 {
+		return errors.New("quantity should be greater than 0")
+	}
+
+	cmdTag, err := db.Exec(ctx, updateQuery, quantity, itemID, userID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("cart item not found")
+	}
+
+	return nil
+}
+
+// performed by customer
+func DeleteCartItem(ctx context.Context, db *pgxpool.Pool, itemID, userID uint32) error {
+	deleteQuery := `
+		DELETE FROM cart_items WHERE id = $1 AND user_id = $2;
+	`
+
+	cmdTag, err := db.Exec(ctx, deleteQuery, itemID, userID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("cart item not found")
+	}
+
+	return nil
+}
+
+// performed by customer
+func ClearCart(ctx context.Context, db *pgxpool.Pool, userID uint32) error {
+	deleteQuery := `
+		DELETE FROM cart_items WHERE user_id = $1;
+	`
+
+	_, err := db.Exec(ctx, deleteQuery, userID)
+	return err
+}
+
+// performed by customer
+// books every cart item under one order or none at all, the cart is emptied on success
+// the billing details and display currency of the template apply to every booking
+// items must share one currency since the order is paid with a single payment
+func Checkout(ctx context.Context, db Querier, template models.Booking) (uint32, error) {
+	// queries
+	getQuery := `
+		SELECT ci.id, ci.conference_id, ci.ticket_type_id, ci.quantity, ci.promo_code, t.currency
+		FROM cart_items ci
+		JOIN ticket_types t ON t.id = ci.ticket_type_id
+		WHERE ci.user_id = $1
+		ORDER BY ci.ticket_type_id
+		FOR UPDATE OF ci;
+	`
+	insertQuery := `
+		INSERT INTO orders (user_id, currency)
+		VALUES ($1, $2)
+		RETURNING id;
+	`
+	totalQuery := `
+		UPDATE orders o
+		SET total = b.total,
+			status = CASE WHEN b.total = 0 THEN 'paid' ELSE 'pending_payment' END
+		FROM (
+			SELECT COALESCE(SUM(total_price), 0) AS total FROM bookings
+			WHERE order_id = $1 AND status = 'pending_payment'
+		) b
+		WHERE o.id = $1;
+	`
+	clearQuery := `
+		DELETE FROM cart_items WHERE user_id = $1;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the cart, ticket type order keeps concurrent checkouts from deadlocking
+	type cartLine struct {
+		id, conferenceID, ticketTypeID, quantity uint32
+		promoCode, currency                      string
+	}
+	rows, err := tx.Query(ctx, getQuery, template.UserID)
+	if err != nil {
+		return 0, err
+	}
+	lines, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (cartLine, error) {
+		var line cartLine
+		err := row.Scan(&line.id, &line.conferenceID, &line.ticketTypeID, &line.quantity, &line.promoCode, &line.currency)
+		return line, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(lines) == 0 {
+		return 0, errors.New("cart is empty")
+	}
+
+	for _, line := range lines[1:] {
+		if line.currency != lines[0].currency {
+			return 0, errors.New("cart items must share one currency to be paid together")
+		}
+	}
+
+	// the per-order limit covers every item of a conference together
+	perConference := make(map[uint32]uint32)
+	for _, line := range lines {
+		perConference[line.conferenceID] += line.quantity
+	}
+	for conferenceID, quantity := range perConference {
+		if err := checkBookingLimits(ctx, tx, template.UserID, conferenceID, 0, quantity); err != nil {
+			return 0, err
+		}
+	}
+
+	var orderID uint32
+	err = tx.QueryRow(ctx, insertQuery, template.UserID, lines[0].currency).Scan(&orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	// hold and confirm every item, any failure rolls back the whole order
+	now := time.Now()
+	for _, line := range lines {
+		hold := models.Hold{
+			UserID:       template.UserID,
+			ConferenceID: line.conferenceID,
+			TicketTypeID: line.ticketTypeID,
+			Quantity:     line.quantity,
+		}
+		err = holdTicketsTx(ctx, tx, &hold, line.promoCode, false, directHoldTTL, now)
+		if err != nil {
+			return 0, fmt.Errorf("cart item %d: %w", line.id, err)
+		}
+
+		booking := template
+		booking.HoldID = &hold.ID
+		booking.OrderID = &orderID
+		if _, err := confirmHoldTx(ctx, tx, booking, "", now); err != nil {
+			return 0, fmt.Errorf("cart item %d: %w", line.id, err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, totalQuery, orderID); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, clearQuery, template.UserID); err != nil {
+		return 0, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return orderID, nil
+}
+
+// fetches an order with its bookings
+func GetOrder(ctx context.Context, db Querier, orderID uint32) (*models.Order, error) {
+	// queries
+	getQuery := `
+		SELECT id, user_id, status, total, currency, created_at
+		FROM orders
+		WHERE id = $1;
+	`
+	bookingsQuery := `
+		SELECT id FROM bookings
+		WHERE order_id = $1 AND deleted_at IS NULL
+		ORDER BY id;
+	`
+
+	var order models.Order
+	err := db.QueryRow(ctx, getQuery, orderID).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Status,
+		&order.Total,
+		&order.Currency,
+		&order.CreatedAt,
+	)
+	if err != nil {
+		return nil, errors.New("order not found")
+	}
+
+	rows, err := db.Query(ctx, bookingsQuery, orderID)
+	if err != nil {
+		return nil, err
+	}
+	bookingIDs, err := pgx.CollectRows(rows, pgx.RowTo[uint32])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bookingID := range bookingIDs {
+		booking, err := GetBookingByID(ctx, db, bookingID)
+		if err != nil {
+			return nil, err
+		}
+		order.Bookings = append(order.Bookings, *booking)
+	}
+
+	return &order, nil
+}
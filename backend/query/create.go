@@ -2,10 +2,13 @@ package query
 
 import (
 	"backend/models"
+	"backend/money"
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -38,87 +41,100 @@ func CreateUser(ctx context.Context, db *pgxpool.Pool, user models.User, rawPass
 }
 
 // only performed by organizer
+// without explicit ticket types a single free "General Admission" type holds the total tickets
 func CreateConference(ctx context.Context, db *pgxpool.Pool, conference *models.Conference) (uint32, error) {
 	query := `
 		INSERT INTO conferences (
-			title, description, location, event_time,
-			total_tickets, available_tickets, organizer_id, status
+			title, description, location, event_time, organizer_id, status, currency
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id;
 	`
 
+	conference.Currency = strings.ToUpper(strings.TrimSpace(conference.Currency))
+	if conference.Currency == "" {
+		conference.Currency = "USD"
+	}
+	if !money.ValidCurrency(conference.Currency) {
+		return 0, fmt.Errorf("currency must be a 3 letter ISO code")
+	}
+
+	ticketTypes := conference.TicketTypes
+	if len(ticketTypes) == 0 {
+		ticketTypes = []models.TicketType{{
+			Name:  "General Admission",
+			Quota: conference.TotalTickets,
+		}}
+	}
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
 	var conferenceID uint32
-	err := db.QueryRow(ctx, query,
+	err = tx.QueryRow(ctx, query,
 		conference.Title,
 		conference.Description,
 		conference.Location,
 		conference.EventTime,
-		conference.TotalTickets,
-		conference.AvailableTickets,
 		conference.OrganizerID,
 		conference.Status,
+		conference.Currency,
 	).Scan(&conferenceID)
-
-	return conferenceID, err
-}
-
-// performed by customer
-func CreateBooking(ctx context.Context, db *pgxpool.Pool, booking models.Booking) (uint32, error) {
-	// queries
-	getQuery := `
-		SELECT available_tickets, status FROM conferences
-		WHERE id = $1
-	`
-	insertQuery := `
-		INSERT INTO bookings (user_id, conference_id, tickets_booked, status)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id;
-	`
-	updateQuery := `
-		UPDATE conferences
-		SET available_tickets = available_tickets - $1
-		WHERE id = $2
-	`
-
-	// transaction phase
-	tx, err := db.Begin(ctx)
 	if err != nil {
 		return 0, err
 	}
-	defer tx.Rollback(ctx)
 
-	// check conference exists and has enough tickets
-	var availableTickets uint32
-	var status string
+	// insert ticket types
+	for i := range ticketTypes {
+		ticketTypes[i].ConferenceID = conferenceID
+		if _, err := insertTicketType(ctx, tx, &ticketTypes[i], conference.Currency); err != nil {
+			return 0, err
+		}
+	}
 
-	err = tx.QueryRow(ctx, getQuery, booking.ConferenceID).Scan(&availableTickets, &status)
+	// commit transaction
+	err = tx.Commit(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	if status != "ongoing" {
-		return 0, fmt.Errorf("conference is not available for booking")
-	}
-
-	if booking.TicketsBooked > availableTickets {
-		return 0, fmt.Errorf("not enough tickets available")
-	}
+	return conferenceID, nil
+}
 
-	// insert into bookings
-	var bookingID uint32
-	err = tx.QueryRow(ctx, insertQuery,
-		booking.UserID,
-		booking.ConferenceID,
-		booking.TicketsBooked,
-		"completed",
-	).Scan(&bookingID)
+// performed by customer
+// confirms a hold into a booking, without a hold the tickets are held and confirmed in one go
+// an optional promo code discounts the order, the one given with the hold is used when omitted
+// the booking waits for payment holding its tickets, free orders are paid right away
+// tax is added to or taken out of the price depending on the organizer settings
+func CreateBooking(ctx context.Context, db Querier, booking models.Booking, promoCode string) (uint32, error) {
+	// transaction phase
+	tx, err := db.Begin(ctx)
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+
+	if booking.HoldID == nil {
+		hold := models.Hold{
+			UserID:       booking.UserID,
+			ConferenceID: booking.ConferenceID,
+			TicketTypeID: booking.TicketTypeID,
+			Quantity:     booking.TicketsBooked,
+		}
+		err = holdTicketsTx(ctx, tx, &hold, promoCode, false, directHoldTTL, now)
+		if err != nil {
+			return 0, err
+		}
+		booking.HoldID = &hold.ID
+	}
 
-	// update available tickets
-	_, err = tx.Exec(ctx, updateQuery, booking.TicketsBooked, booking.ConferenceID)
+	bookingID, err := confirmHoldTx(ctx, tx, booking, promoCode, now)
 	if err != nil {
 		return 0, err
 	}
@@ -133,14 +149,21 @@ func CreateBooking(ctx context.Context, db *pgxpool.Pool, booking models.Booking
 }
 
 // service method
-func GenerateTickets(ctx context.Context, db *pgxpool.Pool, bookingID uint32) error {
+// issues the tickets a paid booking is still missing, so running it again never duplicates them
+func GenerateTickets(ctx context.Context, db Querier, bookingID uint32) error {
 	// queries
 	getQuery := `
-		SELECT tickets_booked FROM bookings WHERE id = $1
+		SELECT b.status, b.tickets_booked,
+			(SELECT COUNT(*) FROM tickets t WHERE t.booking_id = b.id AND t.status = 'active')::int,
+			b.attendees
+		FROM bookings b
+		WHERE b.id = $1 AND b.deleted_at IS NULL
+		FOR UPDATE;
 	`
 	insertQuery := `
-		INSERT INTO tickets (booking_id, ticket_code)
-		VALUES ($1, $2)
+		INSERT INTO tickets (booking_id, ticket_code, attendee_name, attendee_email, assigned_at, answers)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6::jsonb, '{}'))
+		RETURNING id;
 	`
 
 	// begin transaction
@@ -150,20 +173,43 @@ func GenerateTickets(ctx context.Context, db *pgxpool.Pool, bookingID uint32) er
 	}
 	defer tx.Rollback(ctx)
 
-	// fetch ticket count
-	var ticketCount uint32
-	err = tx.QueryRow(ctx, getQuery, bookingID).Scan(&ticketCount)
+	// fetch missing ticket count
+	var status string
+	var booked, active int
+	var attendees []models.Attendee
+	err = tx.QueryRow(ctx, getQuery, bookingID).Scan(&status, &booked, &active, &attendees)
 	if err != nil {
 		return err
 	}
 
-	// insert tickets
-	for i := 0; i < int(ticketCount); i++ {
+	if status != BookingPaid {
+		return fmt.Errorf("booking %d is not paid", bookingID)
+	}
+
+	// insert tickets, named attendees are taken in the order the buyer gave them
+	for i := active; i < booked; i++ {
 		ticketCode := fmt.Sprintf("TCKT-%d-%d", bookingID, time.Now().UnixNano()+int64(i))
-		_, err = tx.Exec(ctx, insertQuery, bookingID, ticketCode)
+
+		var name, email *string
+		var assignedAt *time.Time
+		var answers map[uint32]any
+		if i < len(attendees) {
+			now := time.Now()
+			name, email, assignedAt = &attendees[i].Name, &attendees[i].Email, &now
+			answers = attendees[i].Answers
+		}
+
+		var ticketID uint32
+		err = tx.QueryRow(ctx, insertQuery, bookingID, ticketCode, name, email, assignedAt, answers).Scan(&ticketID)
 		if err != nil {
 			return err
 		}
+
+		if name != nil {
+			if _, err := tx.Exec(ctx, ticketEmailQuery, ticketID, publicURL()); err != nil {
+				return err
+			}
+		}
 	}
 
 	// commit transaction
@@ -173,3 +219,47 @@ func GenerateTickets(ctx context.Context, db *pgxpool.Pool, bookingID uint32) er
 	}
 	return nil
 }
+
+// sets the conversion snapshot of a booking, the display currency defaults to the user's preference
+// a missing rate only leaves the snapshot empty, it never blocks the booking
+func snapshotExchangeRate(ctx context.Context, tx pgx.Tx, booking *models.Booking, currency string, total int64) error {
+	preferenceQuery := `
+		SELECT preferred_currency FROM users WHERE id = $1;
+	`
+
+	if booking.DisplayCurrency == nil {
+		err := tx.QueryRow(ctx, preferenceQuery, booking.UserID).Scan(&booking.DisplayCurrency)
+		if err != nil {
+			return err
+		}
+		if booking.DisplayCurrency == nil {
+			return nil
+		}
+	}
+
+	display := strings.ToUpper(strings.TrimSpace(*booking.DisplayCurrency))
+	if !money.ValidCurrency(display) {
+		return fmt.Errorf("display currency must be a 3 letter ISO code")
+	}
+	booking.DisplayCurrency = &display
+
+	rate := money.One()
+	rateAt := time.Now()
+	if display != currency {
+		stored, err := scanExchangeRate(tx.QueryRow(ctx, exchangeRateQuery, currency, display))
+		if err == pgx.ErrNoRows {
+			booking.DisplayCurrency = nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rate, rateAt = stored.Rate, stored.UpdatedAt
+	}
+
+	converted := money.Convert(total, currency, display, rate)
+	booking.ExchangeRate = &rate
+	booking.ExchangeRateAt = &rateAt
+	booking.ConvertedTotal = &converted
+	return nil
+}
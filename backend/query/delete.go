@@ -11,7 +11,8 @@ import (
 // universal method
 func DeleteUser(ctx context.Context, db *pgxpool.Pool, userID uint32) error {
 	deleteQuery := `
-		DELETE FROM users WHERE id = $1;
+		UPDATE users SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL;
 	`
 
 	cmdTag, err := db.Exec(ctx, deleteQuery, userID)
@@ -27,22 +28,32 @@ func DeleteUser(ctx context.Context, db *pgxpool.Pool, userID uint32) error {
 }
 
 // performed by customers
+// an active booking is cancelled under the conference refund policy before it is hidden
 func DeleteBooking(ctx context.Context, db *pgxpool.Pool, bookingID, userID uint32) error {
 	// queries
 	getQuery := `
-		SELECT user_id, booked_at
+		SELECT user_id, status
 		FROM bookings
-		WHERE id = $1;
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE;
 	`
 	deleteQuery := `
-		DELETE FROM bookings WHERE id = $1;
+		UPDATE bookings SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL;
 	`
 
-	// validate user id and booked time
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// validate user id
 	var bookingUserID uint32
-	var bookedAt time.Time
+	var status string
 
-	err := db.QueryRow(ctx, getQuery, bookingID).Scan(&bookingUserID, &bookedAt)
+	err = tx.QueryRow(ctx, getQuery, bookingID).Scan(&bookingUserID, &status)
 	if err != nil {
 		return errors.New("booking not found")
 	}
@@ -51,12 +62,15 @@ func DeleteBooking(ctx context.Context, db *pgxpool.Pool, bookingID, userID uint
 		return errors.New("unauthorized: not your booking")
 	}
 
-	if time.Since(bookedAt) > 4*time.Hour {
-		return errors.New("deletion window expired: can only delete within 4 hours of booking")
+	if status == BookingPendingPayment || status == BookingPaid {
+		err = cancelBookingTx(ctx, tx, bookingID, "booking deleted by customer", time.Now())
+		if err != nil {
+			return err
+		}
 	}
 
 	// delete booking
-	cmdTag, err := db.Exec(ctx, deleteQuery, bookingID)
+	cmdTag, err := tx.Exec(ctx, deleteQuery, bookingID)
 	if err != nil {
 		return err
 	}
@@ -65,7 +79,8 @@ func DeleteBooking(ctx context.Context, db *pgxpool.Pool, bookingID, userID uint
 		return errors.New("booking is not deleted")
 	}
 
-	return nil
+	// commit transaction
+	return tx.Commit(ctx)
 }
 
 // only performed by organizer
@@ -73,10 +88,17 @@ func DeleteConference(ctx context.Context, db *pgxpool.Pool, conferenceID, organ
 	// queries
 	getQuery := `
 		SELECT organizer_id FROM conferences
-		WHERE id = $1;
+		WHERE id = $1 AND deleted_at IS NULL;
+	`
+	bookingsQuery := `
+		SELECT EXISTS (
+			SELECT 1 FROM bookings
+			WHERE conference_id = $1 AND status IN ('pending_payment', 'paid') AND deleted_at IS NULL
+		);
 	`
 	deleteQuery := `
-		DELETE FROM conferences WHERE id = $1;
+		UPDATE conferences SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL;
 	`
 
 	// validate organizer
@@ -90,6 +112,17 @@ func DeleteConference(ctx context.Context, db *pgxpool.Pool, conferenceID, organ
 		return errors.New("unauthorized: you are not the correct organizer")
 	}
 
+	// deleting would cascade to bookings and tickets without telling attendees
+	var hasBookings bool
+	err = db.QueryRow(ctx, bookingsQuery, conferenceID).Scan(&hasBookings)
+	if err != nil {
+		return err
+	}
+
+	if hasBookings {
+		return errors.New("conference has active bookings: cancel it instead")
+	}
+
 	// deleting conference
 	cmdTag, err := db.Exec(ctx, deleteQuery, conferenceID)
 	if err != nil {
@@ -102,3 +135,55 @@ func DeleteConference(ctx context.Context, db *pgxpool.Pool, conferenceID, organ
 
 	return nil
 }
+
+// retention service => hard deletes rows soft deleted before the cutoff
+// bookings, orders and payments cascade from their parents, so rows still referenced
+// by booking or payment history are kept, as are users organizing live conferences
+func PurgeDeletedRecords(ctx context.Context, db *pgxpool.Pool, retention time.Duration) (int64, error) {
+	// queries, children first so counts reflect what was actually purged
+	purgeQueries := []string{
+		`DELETE FROM bookings b
+		WHERE b.deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.booking_id = b.id);`,
+		`DELETE FROM conferences c
+		WHERE c.deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM bookings b WHERE b.conference_id = c.id);`,
+		`DELETE FROM users u
+		WHERE u.deleted_at < $1
+			AND NOT EXISTS (
+				SELECT 1 FROM conferences c
+				WHERE c.organizer_id = u.id AND c.deleted_at IS NULL
+			)
+			AND NOT EXISTS (SELECT 1 FROM bookings b WHERE b.user_id = u.id)
+			AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id);`,
+	}
+
+	if retention <= 0 {
+		return 0, errors.New("retention period must be positive")
+	}
+	cutoff := time.Now().Add(-retention)
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var purged int64
+	for _, purgeQuery := range purgeQueries {
+		cmdTag, err := tx.Exec(ctx, purgeQuery, cutoff)
+		if err != nil {
+			return 0, err
+		}
+		purged += cmdTag.RowsAffected()
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
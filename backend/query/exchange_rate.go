@@ -0,0 +1,117 @@
+package query
+
+import (
+	"backend/models"
+	"backend/money"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// fetches every stored rate => admin
+func GetExchangeRates(ctx context.Context, db *pgxpool.Pool) ([]models.ExchangeRate, error) {
+	getQuery := `
+		SELECT base, quote, rate::text, source, updated_at
+		FROM exchange_rates
+		ORDER BY base, quote;
+	`
+
+	rows, err := db.Query(ctx, getQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.ExchangeRate])
+}
+
+// creates or replaces rates in one go, e.g. a daily file from the bank => admin
+func SaveExchangeRates(ctx context.Context, db *pgxpool.Pool, pairs []money.Pair, source string) (int, error) {
+	upsertQuery := `
+		INSERT INTO exchange_rates (base, quote, rate, source, updated_at)
+		VALUES ($1, $2, $3::numeric, $4, NOW())
+		ON CONFLICT (base, quote) DO UPDATE
+		SET rate = EXCLUDED.rate,
+			source = EXCLUDED.source,
+			updated_at = EXCLUDED.updated_at;
+	`
+
+	// validate input
+	if len(pairs) == 0 {
+		return 0, errors.New("no exchange rates given")
+	}
+
+	for i := range pairs {
+		pairs[i].Base = strings.ToUpper(strings.TrimSpace(pairs[i].Base))
+		pairs[i].Quote = strings.ToUpper(strings.TrimSpace(pairs[i].Quote))
+		if !money.ValidCurrency(pairs[i].Base) || !money.ValidCurrency(pairs[i].Quote) {
+			return 0, fmt.Errorf("rate %d: currency must be a 3 letter ISO code", i+1)
+		}
+		if pairs[i].Base == pairs[i].Quote {
+			return 0, fmt.Errorf("rate %d: base and quote must differ", i+1)
+		}
+		if pairs[i].Rate.IsZero() {
+			return 0, fmt.Errorf("rate %d: %w", i+1, money.ErrInvalidRate)
+		}
+	}
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, pair := range pairs {
+		_, err = tx.Exec(ctx, upsertQuery, pair.Base, pair.Quote, pair.Rate, strings.TrimSpace(source))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(pairs), nil
+}
+
+// rate from one currency to another, pgx.ErrNoRows when none is known
+// uses the stored pair, its inverse, or a cross rate over a shared base
+func GetExchangeRate(ctx context.Context, db *pgxpool.Pool, from, to string) (*models.ExchangeRate, error) {
+	return scanExchangeRate(db.QueryRow(ctx, exchangeRateQuery, from, to))
+}
+
+const exchangeRateQuery = `
+	SELECT $1::text, $2::text, rate::text, source, updated_at
+	FROM (
+		SELECT 1 AS priority, rate, source, updated_at
+		FROM exchange_rates WHERE base = $1 AND quote = $2
+		UNION ALL
+		SELECT 2, round(1 / rate, 10), 'inverse of ' || source, updated_at
+		FROM exchange_rates WHERE base = $2 AND quote = $1
+		UNION ALL
+		SELECT 3, round(b.rate / a.rate, 10), 'cross via ' || a.base, LEAST(a.updated_at, b.updated_at)
+		FROM exchange_rates a
+		JOIN exchange_rates b ON b.base = a.base
+		WHERE a.quote = $1 AND b.quote = $2
+	) r
+	WHERE rate > 0
+	ORDER BY priority
+	LIMIT 1;
+`
+
+func scanExchangeRate(row pgx.Row) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := row.Scan(&rate.Base, &rate.Quote, &rate.Rate, &rate.Source, &rate.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rate, nil
+}
@@ -0,0 +1,396 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// group booking request statuses, approved requests whose hold ran out are reported as expired
+const (
+	GroupPending   = "pending"
+	GroupApproved  = "approved"
+	GroupDeclined  = "declined"
+	GroupCancelled = "cancelled"
+	GroupBooked    = "booked"
+)
+
+// ErrBookingLimit is returned when an order goes over the limits the organizer set
+var ErrBookingLimit = errors.New("booking limit reached")
+
+// checks an order against the per-order and per-user limits of the conference
+// adding is the number of tickets the user takes on top of what they already hold and booked
+// the user row lock keeps parallel orders of one account from both passing the per-user limit
+// approved group bookings are counted on their own and never here
+func checkBookingLimits(ctx context.Context, db Querier, userID, conferenceID, adding, orderQuantity uint32) error {
+	// queries
+	limitsQuery := `
+		SELECT max_tickets_per_order, max_tickets_per_user FROM conferences
+		WHERE id = $1;
+	`
+	lockQuery := `
+		SELECT id FROM users WHERE id = $1 FOR UPDATE;
+	`
+	countQuery := `
+		SELECT (
+			COALESCE((
+				SELECT SUM(quantity) FROM holds
+				WHERE user_id = $1 AND conference_id = $2 AND status = 'active'
+					AND expires_at > $3 AND group_request_id IS NULL
+			), 0) +
+			COALESCE((
+				SELECT SUM(b.tickets_booked) FROM bookings b
+				LEFT JOIN holds h ON h.id = b.hold_id
+				WHERE b.user_id = $1 AND b.conference_id = $2 AND b.deleted_at IS NULL
+					AND b.status IN ('pending_payment', 'paid') AND h.group_request_id IS NULL
+			), 0)
+		)::int;
+	`
+
+	var maxPerOrder, maxPerUser *uint32
+	if err := db.QueryRow(ctx, limitsQuery, conferenceID).Scan(&maxPerOrder, &maxPerUser); err != nil {
+		return err
+	}
+
+	if maxPerOrder != nil && orderQuantity > *maxPerOrder {
+		return fmt.Errorf("%w: at most %d tickets per order, request a group booking for more", ErrBookingLimit, *maxPerOrder)
+	}
+
+	if maxPerUser == nil || adding == 0 {
+		return nil
+	}
+
+	var locked uint32
+	if err := db.QueryRow(ctx, lockQuery, userID).Scan(&locked); err != nil {
+		return err
+	}
+
+	var owned uint32
+	if err := db.QueryRow(ctx, countQuery, userID, conferenceID, time.Now()).Scan(&owned); err != nil {
+		return err
+	}
+
+	if owned+adding > *maxPerUser {
+		return fmt.Errorf("%w: at most %d tickets per account, you have %d", ErrBookingLimit, *maxPerUser, owned)
+	}
+
+	return nil
+}
+
+// fetches the order limits of a conference
+func GetBookingLimits(ctx context.Context, db *pgxpool.Pool, conferenceID uint32) (*models.BookingLimits, error) {
+	getQuery := `
+		SELECT max_tickets_per_order, max_tickets_per_user FROM conferences
+		WHERE id = $1 AND deleted_at IS NULL;
+	`
+
+	var limits models.BookingLimits
+	err := db.QueryRow(ctx, getQuery, conferenceID).Scan(&limits.MaxPerOrder, &limits.MaxPerUser)
+	if err != nil {
+		return nil, errors.New("conference not found")
+	}
+
+	return &limits, nil
+}
+
+// only performed by organizer
+// limits apply to new orders, tickets already booked are kept
+func SetBookingLimits(ctx context.Context, db *pgxpool.Pool, conferenceID, organizerID uint32, limits models.BookingLimits) error {
+	updateQuery := `
+		UPDATE conferences SET max_tickets_per_order = $1, max_tickets_per_user = $2
+		WHERE id = $3 AND organizer_id = $4 AND deleted_at IS NULL;
+	`
+
+	if (limits.MaxPerOrder != nil && *limits.MaxPerOrder == 0) || (limits.MaxPerUser != nil && *limits.MaxPerUser == 0) {
+		return errors.New("limits should be greater than 0, leave them empty for no limit")
+	}
+
+	if limits.MaxPerOrder != nil && limits.MaxPerUser != nil && *limits.MaxPerOrder > *limits.MaxPerUser {
+		return errors.New("per-order limit cannot be above the per-user limit")
+	}
+
+	cmdTag, err := db.Exec(ctx, updateQuery, limits.MaxPerOrder, limits.MaxPerUser, conferenceID, organizerID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("conference not found or not your conference")
+	}
+
+	return nil
+}
+
+// performed by customer
+// asks the organizer for more tickets than a normal order allows, the leader names attendees after booking
+func CreateGroupRequest(ctx context.Context, db *pgxpool.Pool, request *models.GroupBookingRequest) error {
+	// queries
+	conferenceQuery := `
+		SELECT status, event_time FROM conferences
+		WHERE id = $1 AND deleted_at IS NULL;
+	`
+	defaultTypeQuery := `
+		SELECT MIN(id), COUNT(*) FROM ticket_types
+		WHERE conference_id = $1 AND NOT hidden;
+	`
+	typeQuery := `
+		SELECT 1 FROM ticket_types
+		WHERE id = $1 AND conference_id = $2 AND NOT hidden;
+	`
+	insertQuery := `
+		INSERT INTO group_booking_requests (user_id, conference_id, ticket_type_id, quantity, note)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at;
+	`
+
+	if request.Quantity == 0 {
+		return errors.New("quantity should be greater than 0")
+	}
+	request.Note = strings.TrimSpace(request.Note)
+
+	var status string
+	var eventTime time.Time
+	err := db.QueryRow(ctx, conferenceQuery, request.ConferenceID).Scan(&status, &eventTime)
+	if err != nil {
+		return errors.New("conference not found")
+	}
+
+	if status != "ongoing" || !eventTime.After(time.Now()) {
+		return errors.New("conference is not available for booking")
+	}
+
+	if request.TicketTypeID == 0 {
+		var defaultTypeID *uint32
+		var typeCount int
+		err = db.QueryRow(ctx, defaultTypeQuery, request.ConferenceID).Scan(&defaultTypeID, &typeCount)
+		if err != nil {
+			return err
+		}
+		if typeCount != 1 {
+			return errors.New("ticket type is required for this conference")
+		}
+		request.TicketTypeID = *defaultTypeID
+	} else {
+		var exists int
+		err = db.QueryRow(ctx, typeQuery, request.TicketTypeID, request.ConferenceID).Scan(&exists)
+		if err != nil {
+			return errors.New("ticket type not found for this conference")
+		}
+	}
+
+	return db.QueryRow(ctx, insertQuery,
+		request.UserID,
+		request.ConferenceID,
+		request.TicketTypeID,
+		request.Quantity,
+		request.Note,
+	).Scan(&request.ID, &request.Status, &request.CreatedAt)
+}
+
+// shared select of group requests with the state of their hold, $1 now
+const groupRequestSelect = `
+	SELECT g.id, g.user_id, g.conference_id, g.ticket_type_id, g.quantity, g.note,
+		CASE WHEN g.status = 'approved' AND (h.id IS NULL OR h.status <> 'active' OR h.expires_at <= $1)
+			THEN 'expired' ELSE g.status END,
+		g.decision_note, h.id::text, h.expires_at, g.created_at, g.decided_at,
+		u.first_name || ' ' || u.last_name, u.email
+	FROM group_booking_requests g
+	JOIN users u ON u.id = g.user_id
+	LEFT JOIN holds h ON h.group_request_id = g.id
+`
+
+// fetches the group booking requests of a leader
+func GetGroupRequests(ctx context.Context, db *pgxpool.Pool, userID uint32) ([]models.GroupBookingRequest, error) {
+	getQuery := groupRequestSelect + `
+		WHERE g.user_id = $2
+		ORDER BY g.created_at DESC, g.id DESC;
+	`
+
+	rows, err := db.Query(ctx, getQuery, time.Now(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.GroupBookingRequest])
+}
+
+// fetches the group booking requests of a conference => organizer
+func GetConferenceGroupRequests(ctx context.Context, db *pgxpool.Pool, conferenceID, organizerID uint32) ([]models.GroupBookingRequest, error) {
+	getQuery := groupRequestSelect + `
+		JOIN conferences c ON c.id = g.conference_id
+		WHERE g.conference_id = $2 AND c.organizer_id = $3
+		ORDER BY g.created_at, g.id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, time.Now(), conferenceID, organizerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.GroupBookingRequest])
+}
+
+// only performed by organizer
+// approval holds the tickets for the leader for holdTTL, confirming the hold books them without the order limits
+func ApproveGroupRequest(ctx context.Context, db *pgxpool.Pool, requestID, conferenceID, organizerID uint32, holdTTL time.Duration, decisionNote string) (*models.Hold, error) {
+	// queries
+	getQuery := `
+		SELECT g.user_id, g.ticket_type_id, g.quantity, g.status
+		FROM group_booking_requests g
+		JOIN conferences c ON c.id = g.conference_id
+		WHERE g.id = $1 AND g.conference_id = $2 AND c.organizer_id = $3
+		FOR UPDATE OF g;
+	`
+	updateQuery := `
+		UPDATE group_booking_requests
+		SET status = 'approved', decision_note = $1, decided_at = $2
+		WHERE id = $3;
+	`
+	notifyQuery := `
+		INSERT INTO notifications (user_id, email, subject, body)
+		SELECT u.id, u.email, 'Group booking approved: ' || c.title,
+			format(E'Your request for %s tickets to %s is approved. They are held for you until %s.\n\nConfirm hold %s to book them, then name each attendee on their ticket.%s',
+				$3::int, c.title, to_char($4::timestamptz, 'YYYY-MM-DD HH24:MI TZ'), $5::text,
+				CASE WHEN $6 = '' THEN '' ELSE E'\n\nNote from the organizer: ' || $6 END)
+		FROM users u
+		JOIN conferences c ON c.id = $2
+		WHERE u.id = $1;
+	`
+
+	if holdTTL <= 0 {
+		return nil, errors.New("hold window must be positive")
+	}
+	decisionNote = strings.TrimSpace(decisionNote)
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	hold := models.Hold{ConferenceID: conferenceID, GroupRequestID: &requestID}
+	var status string
+	err = tx.QueryRow(ctx, getQuery, requestID, conferenceID, organizerID).Scan(&hold.UserID, &hold.TicketTypeID, &hold.Quantity, &status)
+	if err != nil {
+		return nil, errors.New("group request not found or not your conference")
+	}
+
+	if status != GroupPending {
+		return nil, errors.New("group request is " + status)
+	}
+
+	now := time.Now()
+	if err := holdTicketsTx(ctx, tx, &hold, "", false, holdTTL, now); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, updateQuery, decisionNote, now, requestID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, notifyQuery, hold.UserID, conferenceID, hold.Quantity, hold.ExpiresAt, hold.ID, decisionNote)
+	if err != nil {
+		return nil, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// only performed by organizer
+func DeclineGroupRequest(ctx context.Context, db *pgxpool.Pool, requestID, conferenceID, organizerID uint32, decisionNote string) error {
+	// queries
+	updateQuery := `
+		UPDATE group_booking_requests g
+		SET status = 'declined', decision_note = $1, decided_at = $2
+		FROM conferences c
+		WHERE g.id = $3 AND g.conference_id = $4 AND c.id = g.conference_id
+			AND c.organizer_id = $5 AND g.status = 'pending'
+		RETURNING g.user_id;
+	`
+	notifyQuery := `
+		INSERT INTO notifications (user_id, email, subject, body)
+		SELECT u.id, u.email, 'Group booking declined: ' || c.title,
+			format(E'Your request for a group booking to %s was declined.%s', c.title,
+				CASE WHEN $3 = '' THEN '' ELSE E'\n\nNote from the organizer: ' || $3 END)
+		FROM users u
+		JOIN conferences c ON c.id = $2
+		WHERE u.id = $1;
+	`
+
+	decisionNote = strings.TrimSpace(decisionNote)
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var leaderID uint32
+	err = tx.QueryRow(ctx, updateQuery, decisionNote, time.Now(), requestID, conferenceID, organizerID).Scan(&leaderID)
+	if err != nil {
+		return errors.New("no pending group request found")
+	}
+
+	if _, err := tx.Exec(ctx, notifyQuery, leaderID, conferenceID, decisionNote); err != nil {
+		return err
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
+
+// performed by customer
+// withdraws a pending request, or gives up an approved one and its held tickets
+func CancelGroupRequest(ctx context.Context, db *pgxpool.Pool, requestID, userID uint32) error {
+	// queries
+	updateQuery := `
+		UPDATE group_booking_requests SET status = 'cancelled', decided_at = COALESCE(decided_at, $1)
+		WHERE id = $2 AND user_id = $3 AND status IN ('pending', 'approved');
+	`
+	releaseQuery := `
+		WITH released AS (
+			UPDATE holds SET status = 'released'
+			WHERE group_request_id = $1 AND status = 'active'
+			RETURNING ticket_type_id, quantity
+		)
+		UPDATE ticket_types t SET available = t.available + r.quantity
+		FROM released r
+		WHERE t.id = r.ticket_type_id;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	cmdTag, err := tx.Exec(ctx, updateQuery, time.Now(), requestID, userID)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("no open group request found")
+	}
+
+	if _, err := tx.Exec(ctx, releaseQuery, requestID); err != nil {
+		return err
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
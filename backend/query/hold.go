@@ -0,0 +1,517 @@
+package query
+
+import (
+	"backend/models"
+	"backend/pricing"
+	"backend/tax"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// hold statuses
+const (
+	HoldActive    = "active"
+	HoldConfirmed = "confirmed"
+	HoldReleased  = "released"
+	HoldExpired   = "expired"
+)
+
+// lifetime of the hold behind a booking made without one, it is confirmed in the same transaction
+const directHoldTTL = time.Minute
+
+// performed by customer
+// reserves tickets for a limited time, the hold is confirmed into a booking or released
+func CreateHold(ctx context.Context, db *pgxpool.Pool, hold *models.Hold, promoCode string, ttl time.Duration) error {
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = holdTicketsTx(ctx, tx, hold, promoCode, false, ttl, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
+
+// fetches a hold of a user with the booking it was confirmed into
+func GetHold(ctx context.Context, db *pgxpool.Pool, holdID string, userID uint32) (*models.Hold, error) {
+	getQuery := `
+		SELECT h.id, h.user_id, h.conference_id, h.ticket_type_id, h.quantity, h.promo_code,
+			CASE WHEN h.status = 'active' AND h.expires_at <= NOW() THEN 'expired' ELSE h.status END,
+			h.expires_at, h.created_at, b.id, h.group_request_id
+		FROM holds h
+		LEFT JOIN bookings b ON b.hold_id = h.id
+		WHERE h.id = $1 AND h.user_id = $2;
+	`
+
+	var hold models.Hold
+	err := db.QueryRow(ctx, getQuery, holdID, userID).Scan(
+		&hold.ID,
+		&hold.UserID,
+		&hold.ConferenceID,
+		&hold.TicketTypeID,
+		&hold.Quantity,
+		&hold.PromoCode,
+		&hold.Status,
+		&hold.ExpiresAt,
+		&hold.CreatedAt,
+		&hold.BookingID,
+		&hold.GroupRequestID,
+	)
+	if err != nil {
+		return nil, errors.New("hold not found")
+	}
+
+	return &hold, nil
+}
+
+// performed by customer
+// gives the tickets of an active hold back before it expires
+func ReleaseHold(ctx context.Context, db *pgxpool.Pool, holdID string, userID uint32) error {
+	// queries
+	releaseQuery := `
+		UPDATE holds SET status = 'released'
+		WHERE id = $1 AND user_id = $2 AND status = 'active'
+		RETURNING ticket_type_id, quantity;
+	`
+	restoreQuery := `
+		UPDATE ticket_types SET available = available + $1
+		WHERE id = $2;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var ticketTypeID, quantity uint32
+	err = tx.QueryRow(ctx, releaseQuery, holdID, userID).Scan(&ticketTypeID, &quantity)
+	if err != nil {
+		return errors.New("no active hold found")
+	}
+
+	_, err = tx.Exec(ctx, restoreQuery, quantity, ticketTypeID)
+	if err != nil {
+		return err
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
+
+// returns the tickets of every expired hold to its ticket type, counts the tickets released
+func ReleaseExpiredHolds(ctx context.Context, db *pgxpool.Pool) (int64, error) {
+	var released int64
+	err := db.QueryRow(ctx, releaseExpiredHoldsQuery, time.Now(), nil).Scan(&released)
+	return released, err
+}
+
+// expires active holds past their time, of one ticket type or of all when $2 is null
+const releaseExpiredHoldsQuery = `
+	WITH expired AS (
+		UPDATE holds SET status = 'expired'
+		WHERE status = 'active' AND expires_at <= $1
+			AND ($2::int IS NULL OR ticket_type_id = $2)
+		RETURNING ticket_type_id, quantity
+	),
+	restored AS (
+		UPDATE ticket_types t SET available = t.available + r.quantity
+		FROM (
+			SELECT ticket_type_id, SUM(quantity) AS quantity
+			FROM expired GROUP BY ticket_type_id
+		) r
+		WHERE t.id = r.ticket_type_id
+		RETURNING r.quantity
+	)
+	SELECT COALESCE(SUM(quantity), 0)::bigint FROM restored;
+`
+
+// tickets of a ticket type set aside for customers waiting on the waitlist, $1 ticket type id
+// freed tickets that fit a waiting entry stay off general sale until PromoteWaitlist offers them
+const waitlistReservedQuery = `
+	SELECT COALESCE(MAX(reserved), 0) FROM waitlist_reservations
+	WHERE ticket_type_id = $1;
+`
+
+// returned when a ticket type has fewer tickets left than requested
+var ErrSoldOut = errors.New("sold out: not enough tickets available")
+
+// ticket type and conference state a hold or booking is checked against
+type bookable struct {
+	ticketTypeID uint32
+	status       string
+	eventTime    time.Time
+	organizerID  uint32
+	basePrice    int64
+	currency     string
+	quota        uint32
+	available    uint32
+	minPerOrder  uint32
+	maxPerOrder  *uint32
+	salesStart   *time.Time
+	salesEnd     *time.Time
+	hidden       bool
+	promo        *models.PromoCode
+}
+
+// checks a ticket type can be booked in the given quantity, without looking at availability
+// the ticket type defaults to the single visible type of the conference
+// an optional promo code is locked for the rest of the transaction and may unlock hidden types
+func checkBookableTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID, conferenceID, ticketTypeID, quantity uint32,
+	promoCode string,
+	group bool,
+	now time.Time,
+) (*bookable, error) {
+	// queries
+	defaultTypeQuery := `
+		SELECT MIN(id), COUNT(*) FROM ticket_types
+		WHERE conference_id = $1 AND NOT hidden;
+	`
+	getQuery := `
+		SELECT c.status, c.event_time, c.organizer_id, t.price, t.currency, t.quota, t.available,
+			t.sales_start, t.sales_end, t.min_per_order, t.max_per_order, t.hidden
+		FROM ticket_types t
+		JOIN conferences c ON c.id = t.conference_id
+		WHERE t.id = $1 AND c.id = $2 AND c.deleted_at IS NULL
+	`
+
+	if quantity == 0 {
+		return nil, fmt.Errorf("number of tickets booked should be greater than 0")
+	}
+
+	// resolve ticket type
+	if ticketTypeID == 0 {
+		var defaultTypeID *uint32
+		var typeCount int
+		err := tx.QueryRow(ctx, defaultTypeQuery, conferenceID).Scan(&defaultTypeID, &typeCount)
+		if err != nil {
+			return nil, err
+		}
+		if typeCount != 1 {
+			return nil, fmt.Errorf("ticket type is required for this conference")
+		}
+		ticketTypeID = *defaultTypeID
+	}
+
+	// check conference and ticket type are on sale
+	b := bookable{ticketTypeID: ticketTypeID}
+	err := tx.QueryRow(ctx, getQuery, ticketTypeID, conferenceID).Scan(
+		&b.status,
+		&b.eventTime,
+		&b.organizerID,
+		&b.basePrice,
+		&b.currency,
+		&b.quota,
+		&b.available,
+		&b.salesStart,
+		&b.salesEnd,
+		&b.minPerOrder,
+		&b.maxPerOrder,
+		&b.hidden,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ticket type not found for this conference")
+	}
+
+	if strings.TrimSpace(promoCode) != "" {
+		b.promo, err = lockPromoCode(ctx, tx, conferenceID, ticketTypeID, userID, promoCode, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// hidden types are only bookable with a code restricted to them
+	if b.hidden && (b.promo == nil || !slices.Contains(b.promo.TicketTypeIDs, ticketTypeID)) {
+		return nil, fmt.Errorf("ticket type not found for this conference")
+	}
+	if b.status != "ongoing" || !b.eventTime.After(now) {
+		return nil, fmt.Errorf("conference is not available for booking")
+	}
+
+	if (b.salesStart != nil && now.Before(*b.salesStart)) || (b.salesEnd != nil && !now.Before(*b.salesEnd)) {
+		return nil, fmt.Errorf("ticket type is not on sale")
+	}
+
+	// approved group bookings are sized by the organizer
+	if !group && (quantity < b.minPerOrder || (b.maxPerOrder != nil && quantity > *b.maxPerOrder)) {
+		return nil, fmt.Errorf("number of tickets is outside the allowed range per order")
+	}
+
+	return &b, nil
+}
+
+// takes tickets out of availability for the lifetime of a new hold
+// expired holds of the ticket type are released first so their tickets can be held again
+// only waitlist offers may take the tickets reserved for waiting customers
+func holdTicketsTx(ctx context.Context, tx pgx.Tx, hold *models.Hold, promoCode string, waitlist bool, ttl time.Duration, now time.Time) error {
+	// queries
+	insertQuery := `
+		INSERT INTO holds (user_id, conference_id, ticket_type_id, quantity, promo_code, expires_at, group_request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, status, created_at;
+	`
+	// the row lock serializes concurrent holds, each sees the availability left by the one before
+	updateQuery := `
+		UPDATE ticket_types
+		SET available = available - $1
+		WHERE id = $2 AND available >= $1 + $3
+		RETURNING available;
+	`
+
+	group := hold.GroupRequestID != nil
+	b, err := checkBookableTx(ctx, tx, hold.UserID, hold.ConferenceID, hold.TicketTypeID, hold.Quantity, promoCode, group, now)
+	if err != nil {
+		return err
+	}
+
+	if !group {
+		if err := checkBookingLimits(ctx, tx, hold.UserID, hold.ConferenceID, hold.Quantity, hold.Quantity); err != nil {
+			return err
+		}
+	}
+
+	// tickets of expired holds are free again
+	var released uint32
+	err = tx.QueryRow(ctx, releaseExpiredHoldsQuery, now, b.ticketTypeID).Scan(&released)
+	if err != nil {
+		return err
+	}
+
+	var reserved uint32
+	if !waitlist {
+		if err := tx.QueryRow(ctx, waitlistReservedQuery, b.ticketTypeID).Scan(&reserved); err != nil {
+			return err
+		}
+	}
+
+	// take the tickets only if enough are left
+	var remaining uint32
+	err = tx.QueryRow(ctx, updateQuery, hold.Quantity, b.ticketTypeID, reserved).Scan(&remaining)
+	if err == pgx.ErrNoRows {
+		return ErrSoldOut
+	}
+	if err != nil {
+		return err
+	}
+
+	hold.TicketTypeID = b.ticketTypeID
+	hold.PromoCode = strings.ToUpper(strings.TrimSpace(promoCode))
+	hold.ExpiresAt = now.Add(ttl)
+
+	err = tx.QueryRow(ctx, insertQuery,
+		hold.UserID,
+		hold.ConferenceID,
+		hold.TicketTypeID,
+		hold.Quantity,
+		hold.PromoCode,
+		hold.ExpiresAt,
+		hold.GroupRequestID,
+	).Scan(&hold.ID, &hold.Status, &hold.CreatedAt)
+	return err
+}
+
+// turns an active hold into a booking priced at confirmation time
+// the held tickets move to the booking, availability does not change again
+func confirmHoldTx(ctx context.Context, tx pgx.Tx, booking models.Booking, promoCode string, now time.Time) (uint32, error) {
+	// queries
+	getQuery := `
+		SELECT conference_id, ticket_type_id, quantity, promo_code, status, expires_at, group_request_id
+		FROM holds
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE;
+	`
+	insertQuery := `
+		INSERT INTO bookings (
+			user_id, conference_id, ticket_type_id, tickets_booked,
+			unit_price, total_price, currency, price_tier_id,
+			promo_code_id, discount, status,
+			billing_name, billing_address, billing_tax_id, billing_country,
+			subtotal, net_amount, tax_amount, tax_rate_bp, tax_country, tax_inclusive, reverse_charge,
+			display_currency, exchange_rate, exchange_rate_at, converted_total, hold_id, order_id, attendees
+		)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11,
+			COALESCE(NULLIF($12, ''), (SELECT first_name || ' ' || last_name FROM users WHERE id = $1)),
+			$13, $14, $15, $16, $17, $18, $19, $20, $21, $22,
+			$23, $24::numeric, $25, $26, $27, $28, $29::jsonb
+		)
+		RETURNING id;
+	`
+	confirmQuery := `
+		UPDATE holds SET status = 'confirmed'
+		WHERE id = $1;
+	`
+	groupQuery := `
+		UPDATE group_booking_requests SET status = 'booked'
+		WHERE id = $1;
+	`
+
+	// lock the hold so it is confirmed once
+	var holdStatus, heldCode string
+	var expiresAt time.Time
+	var groupRequestID *uint32
+	err := tx.QueryRow(ctx, getQuery, *booking.HoldID, booking.UserID).Scan(
+		&booking.ConferenceID,
+		&booking.TicketTypeID,
+		&booking.TicketsBooked,
+		&heldCode,
+		&holdStatus,
+		&expiresAt,
+		&groupRequestID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("hold not found")
+	}
+
+	if holdStatus == HoldConfirmed {
+		return 0, fmt.Errorf("hold was already confirmed")
+	}
+	if holdStatus != HoldActive || !expiresAt.After(now) {
+		return 0, fmt.Errorf("hold has expired or was released")
+	}
+
+	if strings.TrimSpace(promoCode) == "" {
+		promoCode = heldCode
+	}
+
+	// attendees are optional, at most one per ticket
+	if len(booking.Attendees) > int(booking.TicketsBooked) {
+		return 0, fmt.Errorf("more attendees than tickets booked")
+	}
+	if booking.Attendees == nil {
+		booking.Attendees = []models.Attendee{}
+	}
+	for i := range booking.Attendees {
+		if err := validateAttendee(&booking.Attendees[i]); err != nil {
+			return 0, fmt.Errorf("attendee %d: %w", i+1, err)
+		}
+		answers, err := validateAnswers(ctx, tx, booking.ConferenceID, booking.TicketTypeID, booking.Attendees[i].Answers)
+		if err != nil {
+			return 0, fmt.Errorf("attendee %d: %w", i+1, err)
+		}
+		booking.Attendees[i].Answers = answers
+	}
+
+	b, err := checkBookableTx(ctx, tx, booking.UserID, booking.ConferenceID, booking.TicketTypeID, booking.TicketsBooked, promoCode, groupRequestID != nil, now)
+	if err != nil {
+		return 0, err
+	}
+
+	// price at confirmation time from the active tiers, the held tickets are not sold yet
+	tiers, err := getPriceTiersTx(ctx, tx, booking.TicketTypeID)
+	if err != nil {
+		return 0, err
+	}
+
+	sold := b.quota - b.available - booking.TicketsBooked
+	totalPrice, quote := pricing.Total(b.basePrice, tiers, sold, booking.TicketsBooked, now)
+	var priceTierID *uint32
+	if quote.Tier != nil {
+		priceTierID = &quote.Tier.ID
+	}
+
+	var promoCodeID *uint32
+	var discount int64
+	if b.promo != nil {
+		promoCodeID = &b.promo.ID
+		discount = pricing.Discount(b.promo.DiscountType, b.promo.Amount, totalPrice)
+	}
+
+	// tax on the discounted amount from the organizer settings and billing country
+	booking.BillingCountry = strings.ToUpper(strings.TrimSpace(booking.BillingCountry))
+	booking.BillingTaxID = tax.NormalizeVATID(booking.BillingTaxID)
+	if booking.BillingCountry != "" && !countryPattern.MatchString(booking.BillingCountry) {
+		return 0, fmt.Errorf("billing country must be a 2 letter ISO code")
+	}
+
+	breakdown, err := calculateBookingTax(ctx, tx, b.organizerID, booking.BillingCountry, booking.BillingTaxID, totalPrice-discount, now)
+	if err != nil {
+		return 0, err
+	}
+
+	bookingStatus := BookingPendingPayment
+	if breakdown.Gross == 0 {
+		bookingStatus = BookingPaid
+	}
+
+	// snapshot of the rate into the buyer's currency, kept for reporting
+	err = snapshotExchangeRate(ctx, tx, &booking, b.currency, breakdown.Gross)
+	if err != nil {
+		return 0, err
+	}
+
+	// insert into bookings
+	var bookingID uint32
+	err = tx.QueryRow(ctx, insertQuery,
+		booking.UserID,
+		booking.ConferenceID,
+		booking.TicketTypeID,
+		booking.TicketsBooked,
+		quote.Price,
+		breakdown.Gross,
+		b.currency,
+		priceTierID,
+		promoCodeID,
+		discount,
+		bookingStatus,
+		strings.TrimSpace(booking.BillingName),
+		strings.TrimSpace(booking.BillingAddress),
+		booking.BillingTaxID,
+		booking.BillingCountry,
+		totalPrice-discount,
+		breakdown.Net,
+		breakdown.Tax,
+		breakdown.RateBP,
+		breakdown.Country,
+		breakdown.Inclusive,
+		breakdown.ReverseCharge,
+		booking.DisplayCurrency,
+		booking.ExchangeRate,
+		booking.ExchangeRateAt,
+		booking.ConvertedTotal,
+		booking.HoldID,
+		booking.OrderID,
+		booking.Attendees,
+	).Scan(&bookingID)
+	if err != nil {
+		return 0, err
+	}
+
+	// count promo code use
+	if b.promo != nil {
+		err = redeemPromoCode(ctx, tx, b.promo.ID, bookingID, booking.UserID, discount)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, confirmQuery, *booking.HoldID)
+	if err != nil {
+		return 0, err
+	}
+
+	if groupRequestID != nil {
+		if _, err := tx.Exec(ctx, groupQuery, *groupRequestID); err != nil {
+			return 0, err
+		}
+	}
+
+	return bookingID, nil
+}
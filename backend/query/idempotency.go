@@ -0,0 +1,158 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// idempotency key statuses
+const (
+	IdempotencyProcessing = "processing"
+	IdempotencyCompleted  = "completed"
+)
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
+// claims a key for the request, returns nil when the caller owns it and should run the request
+// otherwise the stored key is returned, still processing or completed with its response
+// expired keys are claimed again, as are abandoned ones of the same request once their lease ran out
+func ClaimIdempotencyKey(ctx context.Context, db *pgxpool.Pool, key *models.IdempotencyKey, ttl, lease time.Duration) (*models.IdempotencyKey, error) {
+	// queries
+	insertQuery := `
+		INSERT INTO idempotency_keys (user_id, key, method, path, fingerprint, locked_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET method = EXCLUDED.method,
+			path = EXCLUDED.path,
+			fingerprint = EXCLUDED.fingerprint,
+			status = 'processing',
+			status_code = NULL,
+			content_type = NULL,
+			body = NULL,
+			locked_at = EXCLUDED.locked_at,
+			created_at = EXCLUDED.created_at
+		WHERE idempotency_keys.created_at < $7
+			OR (idempotency_keys.status = 'processing'
+				AND idempotency_keys.locked_at < $8
+				AND idempotency_keys.fingerprint = EXCLUDED.fingerprint)
+		RETURNING id;
+	`
+	getQuery := `
+		SELECT id, user_id, key, method, path, fingerprint, status, status_code, content_type, body, locked_at, created_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2;
+	`
+
+	now := time.Now()
+	err := db.QueryRow(ctx, insertQuery,
+		key.UserID,
+		key.Key,
+		key.Method,
+		key.Path,
+		key.Fingerprint,
+		now,
+		now.Add(-ttl),
+		now.Add(-lease),
+	).Scan(&key.ID)
+	if err == nil {
+		key.Status = IdempotencyProcessing
+		key.LockedAt, key.CreatedAt = now, now
+		return nil, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, err
+	}
+
+	var stored models.IdempotencyKey
+	err = db.QueryRow(ctx, getQuery, key.UserID, key.Key).Scan(
+		&stored.ID,
+		&stored.UserID,
+		&stored.Key,
+		&stored.Method,
+		&stored.Path,
+		&stored.Fingerprint,
+		&stored.Status,
+		&stored.StatusCode,
+		&stored.ContentType,
+		&stored.Body,
+		&stored.LockedAt,
+		&stored.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		// released between both queries, the caller claims again
+		return &models.IdempotencyKey{Status: IdempotencyProcessing, Fingerprint: key.Fingerprint}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.Fingerprint != key.Fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	return &stored, nil
+}
+
+// stores the response of a claimed key so retries replay it
+func CompleteIdempotencyKey(ctx context.Context, db *pgxpool.Pool, keyID uint32, statusCode int, contentType string, body []byte) error {
+	updateQuery := `
+		UPDATE idempotency_keys
+		SET status = 'completed', status_code = $1, content_type = $2, body = $3
+		WHERE id = $4 AND status = 'processing';
+	`
+
+	cmdTag, err := db.Exec(ctx, updateQuery, statusCode, contentType, body, keyID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("idempotency key is no longer processing")
+	}
+
+	return nil
+}
+
+// extends the lease of a claimed key still in flight so it is not taken over as abandoned
+func RenewIdempotencyKey(ctx context.Context, db *pgxpool.Pool, keyID uint32) error {
+	updateQuery := `
+		UPDATE idempotency_keys SET locked_at = $1
+		WHERE id = $2 AND status = 'processing';
+	`
+
+	_, err := db.Exec(ctx, updateQuery, time.Now(), keyID)
+	return err
+}
+
+// gives up a claimed key without a response, a retry runs the request again
+func ReleaseIdempotencyKey(ctx context.Context, db *pgxpool.Pool, keyID uint32) error {
+	deleteQuery := `
+		DELETE FROM idempotency_keys WHERE id = $1 AND status = 'processing';
+	`
+
+	_, err := db.Exec(ctx, deleteQuery, keyID)
+	return err
+}
+
+// retention service => deletes keys older than ttl, their requests can no longer be replayed
+func PurgeIdempotencyKeys(ctx context.Context, db *pgxpool.Pool, ttl time.Duration) (int64, error) {
+	deleteQuery := `
+		DELETE FROM idempotency_keys WHERE created_at < $1;
+	`
+
+	if ttl <= 0 {
+		return 0, errors.New("idempotency key lifetime must be positive")
+	}
+
+	cmdTag, err := db.Exec(ctx, deleteQuery, time.Now().Add(-ttl))
+	if err != nil {
+		return 0, err
+	}
+
+	return cmdTag.RowsAffected(), nil
+}
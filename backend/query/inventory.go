@@ -0,0 +1,85 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// administration service
+// recomputes availability of ticket types from holds and bookings and returns the ones that drifted
+// with fix the recomputed value is stored, clamped to the range the schema allows
+// a zero conference id checks every conference
+func ReconcileInventory(ctx context.Context, db *pgxpool.Pool, conferenceID uint32, fix bool) ([]models.InventoryDrift, error) {
+	// queries
+	lockQuery := `
+		SELECT id FROM ticket_types
+		WHERE $1::int = 0 OR conference_id = $1
+		ORDER BY id
+		FOR UPDATE;
+	`
+	getQuery := `
+		SELECT t.id, t.conference_id, c.title, t.name, t.quota,
+			COALESCE(h.quantity, 0)::bigint, COALESCE(b.quantity, 0)::bigint, t.available::bigint,
+			(t.quota - COALESCE(h.quantity, 0) - COALESCE(b.quantity, 0))::bigint
+		FROM ticket_types t
+		JOIN conferences c ON c.id = t.conference_id
+		LEFT JOIN (
+			SELECT ticket_type_id, SUM(quantity) AS quantity FROM holds
+			WHERE status = 'active'
+			GROUP BY ticket_type_id
+		) h ON h.ticket_type_id = t.id
+		LEFT JOIN (
+			SELECT ticket_type_id, SUM(tickets_booked) AS quantity FROM bookings
+			WHERE status IN ('pending_payment', 'paid')
+			GROUP BY ticket_type_id
+		) b ON b.ticket_type_id = t.id
+		WHERE ($1::int = 0 OR t.conference_id = $1)
+			AND t.available <> t.quota - COALESCE(h.quantity, 0) - COALESCE(b.quantity, 0)
+		ORDER BY t.conference_id, t.id;
+	`
+	updateQuery := `
+		UPDATE ticket_types SET available = GREATEST(0, LEAST(quota, $1::int))
+		WHERE id = $2;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// every inventory change holds the ticket type lock until commit,
+	// so counting after taking the locks sees no change half applied
+	if _, err := tx.Exec(ctx, lockQuery, conferenceID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, getQuery, conferenceID)
+	if err != nil {
+		return nil, err
+	}
+	drifts, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.InventoryDrift])
+	if err != nil {
+		return nil, err
+	}
+
+	if fix {
+		for _, drift := range drifts {
+			if _, err := tx.Exec(ctx, updateQuery, drift.Expected, drift.TicketTypeID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return drifts, nil
+}
@@ -0,0 +1,381 @@
+package query
+
+import (
+	"backend/invoice"
+	"backend/models"
+	"backend/tax"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// columns of an invoice row without the document itself
+const invoiceColumns = `
+	id, booking_id, organizer_id, kind, number, related_invoice_id,
+	currency, subtotal, tax, total, issued_at
+`
+
+// issues the invoice of a paid booking, or returns the one already issued
+func IssueInvoice(ctx context.Context, db *pgxpool.Pool, bookingID uint32) (*models.Invoice, error) {
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	issued, err := issueInvoiceTx(ctx, tx, bookingID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return issued, nil
+}
+
+// fetches credit notes issued against a booking, oldest first
+func GetCreditNotesByBookingID(ctx context.Context, db *pgxpool.Pool, bookingID uint32) ([]models.Invoice, error) {
+	getQuery := `
+		SELECT` + invoiceColumns + `
+		FROM invoices
+		WHERE booking_id = $1 AND kind = 'credit_note'
+		ORDER BY issued_at, id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []models.Invoice{}
+	for rows.Next() {
+		note, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, *note)
+	}
+
+	return notes, rows.Err()
+}
+
+// fetches the stored PDF of a document issued for a booking
+func GetInvoicePDF(ctx context.Context, db *pgxpool.Pool, bookingID, invoiceID uint32) (*models.Invoice, []byte, error) {
+	getQuery := `
+		SELECT` + invoiceColumns + `, pdf
+		FROM invoices
+		WHERE id = $1 AND booking_id = $2;
+	`
+
+	var issued models.Invoice
+	var pdf []byte
+	err := db.QueryRow(ctx, getQuery, invoiceID, bookingID).Scan(
+		&issued.ID,
+		&issued.BookingID,
+		&issued.OrganizerID,
+		&issued.Kind,
+		&issued.Number,
+		&issued.RelatedInvoiceID,
+		&issued.Currency,
+		&issued.Subtotal,
+		&issued.Tax,
+		&issued.Total,
+		&issued.IssuedAt,
+		&pdf,
+	)
+	if err != nil {
+		return nil, nil, errors.New("document not found")
+	}
+
+	return &issued, pdf, nil
+}
+
+// issues the invoice of a booking inside a transaction, idempotent per booking
+// only bookings with a succeeded payment are invoiced, free orders have nothing to bill
+func issueInvoiceTx(ctx context.Context, tx pgx.Tx, bookingID uint32, now time.Time) (*models.Invoice, error) {
+	// queries
+	getQuery := `
+		SELECT b.total_price, b.discount, b.currency, b.tickets_booked, b.unit_price,
+			b.subtotal, b.net_amount, b.tax_amount, b.tax_rate_bp, b.tax_inclusive, b.reverse_charge,
+			b.billing_name, b.billing_address, b.billing_tax_id,
+			c.title, c.event_time, c.organizer_id, t.name,
+			COALESCE(op.legal_name, u.first_name || ' ' || u.last_name),
+			COALESCE(op.address, ''), COALESCE(op.tax_id, ''), COALESCE(op.invoice_prefix, 'INV'),
+			EXISTS (SELECT 1 FROM payments p WHERE (p.booking_id = b.id OR p.order_id = b.order_id) AND p.status = 'succeeded')
+		FROM bookings b
+		JOIN conferences c ON c.id = b.conference_id
+		JOIN ticket_types t ON t.id = b.ticket_type_id
+		JOIN users u ON u.id = c.organizer_id
+		LEFT JOIN organizer_profiles op ON op.organizer_id = c.organizer_id
+		WHERE b.id = $1
+		FOR UPDATE OF b;
+	`
+	existingQuery := `
+		SELECT` + invoiceColumns + `
+		FROM invoices
+		WHERE booking_id = $1 AND kind = 'invoice';
+	`
+
+	// booking lock serializes concurrent requests for the same invoice
+	var total, discount, unitPrice, subtotal, net, taxAmount int64
+	var taxRateBP uint32
+	var inclusive, reverseCharge bool
+	var currency, title, ticketType, prefix string
+	var quantity, organizerID uint32
+	var eventTime time.Time
+	var buyer, seller invoice.Party
+	var paid bool
+	err := tx.QueryRow(ctx, getQuery, bookingID).Scan(
+		&total,
+		&discount,
+		&currency,
+		&quantity,
+		&unitPrice,
+		&subtotal,
+		&net,
+		&taxAmount,
+		&taxRateBP,
+		&inclusive,
+		&reverseCharge,
+		&buyer.Name,
+		&buyer.Address,
+		&buyer.TaxID,
+		&title,
+		&eventTime,
+		&organizerID,
+		&ticketType,
+		&seller.Name,
+		&seller.Address,
+		&seller.TaxID,
+		&prefix,
+		&paid,
+	)
+	if err != nil {
+		return nil, errors.New("booking not found")
+	}
+
+	existing, err := scanInvoice(tx.QueryRow(ctx, existingQuery, bookingID))
+	if err == nil {
+		return existing, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, err
+	}
+
+	if !paid || total <= 0 {
+		return nil, errors.New("booking has no payment to invoice")
+	}
+
+	// line items at ticket prices, the discount and any tax taken out of inclusive prices
+	line := invoice.Line{
+		Description: fmt.Sprintf("%s - %s", title, ticketType),
+		Quantity:    quantity,
+		Amount:      subtotal + discount,
+	}
+	if unitPrice*int64(quantity) == line.Amount {
+		line.UnitPrice = &unitPrice
+	}
+	lines := []invoice.Line{line}
+	if discount > 0 {
+		lines = append(lines, invoice.Line{Description: "Promo code discount", Quantity: 1, Amount: -discount})
+	}
+	if reverseCharge && subtotal > net {
+		lines = append(lines, invoice.Line{Description: "Tax not charged (reverse charge)", Quantity: 1, Amount: net - subtotal})
+	}
+
+	note := fmt.Sprintf("Paid in full. Booking #%d for the event on %s.",
+		bookingID, eventTime.UTC().Format("2006-01-02 15:04 MST"))
+	if reverseCharge {
+		note += "\nReverse charge: tax is to be accounted for by the recipient."
+	}
+
+	doc := invoice.Document{
+		Kind:      invoice.KindInvoice,
+		IssuedAt:  now,
+		Seller:    seller,
+		Buyer:     buyer,
+		Currency:  currency,
+		Lines:     lines,
+		Taxes:     []invoice.TaxLine{},
+		Inclusive: inclusive && !reverseCharge,
+		Subtotal:  net,
+		Tax:       taxAmount,
+		Total:     total,
+		Note:      note,
+	}
+	if doc.Inclusive {
+		doc.Subtotal = total
+	}
+	if taxAmount > 0 {
+		doc.Taxes = append(doc.Taxes, invoice.TaxLine{Label: "Tax", RateBP: taxRateBP, Base: net, Amount: taxAmount})
+	}
+
+	return insertInvoice(ctx, tx, bookingID, organizerID, nil, prefix, doc)
+}
+
+// issues a credit note for a settled refund inside a transaction
+// bookings that were never invoiced get no credit note
+func issueCreditNoteTx(ctx context.Context, tx pgx.Tx, bookingID uint32, amount int64, reason string, now time.Time) error {
+	getQuery := `
+		SELECT i.id, i.organizer_id, i.number, i.document, COALESCE(op.invoice_prefix, 'INV')
+		FROM invoices i
+		LEFT JOIN organizer_profiles op ON op.organizer_id = i.organizer_id
+		WHERE i.booking_id = $1 AND i.kind = 'invoice';
+	`
+	creditedQuery := `
+		SELECT COALESCE(-SUM(total), 0)::bigint FROM invoices
+		WHERE related_invoice_id = $1 AND kind = 'credit_note';
+	`
+
+	var invoiceID uint32
+	var organizerID *uint32
+	var number, prefix string
+	var original invoice.Document
+	err := tx.QueryRow(ctx, getQuery, bookingID).Scan(&invoiceID, &organizerID, &number, &original, &prefix)
+	if err == pgx.ErrNoRows || (err == nil && organizerID == nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		reason = "refund"
+	}
+
+	// tax is returned in proportion to the refunded share of the invoice
+	var credited int64
+	if err := tx.QueryRow(ctx, creditedQuery, invoiceID).Scan(&credited); err != nil {
+		return err
+	}
+	refundTax := tax.Prorate(credited, amount, original.Total, original.Tax)
+
+	doc := invoice.Document{
+		Kind:      invoice.KindCreditNote,
+		IssuedAt:  now,
+		Reference: number,
+		Seller:    original.Seller,
+		Buyer:     original.Buyer,
+		Currency:  original.Currency,
+		Lines: []invoice.Line{{
+			Description: "Refund: " + reason,
+			Quantity:    1,
+			Amount:      -(amount - refundTax),
+		}},
+		Taxes:     []invoice.TaxLine{},
+		Inclusive: original.Inclusive,
+		Subtotal:  -(amount - refundTax),
+		Tax:       -refundTax,
+		Total:     -amount,
+		Note:      fmt.Sprintf("Refunded to the original payment method. Booking #%d.", bookingID),
+	}
+	if original.Inclusive {
+		doc.Lines[0].Amount = -amount
+		doc.Subtotal = -amount
+	}
+	for _, taxLine := range original.Taxes {
+		doc.Taxes = append(doc.Taxes, invoice.TaxLine{
+			Label:  taxLine.Label,
+			RateBP: taxLine.RateBP,
+			Base:   -(amount - refundTax),
+			Amount: -refundTax,
+		})
+	}
+
+	_, err = insertInvoice(ctx, tx, bookingID, *organizerID, &invoiceID, prefix, doc)
+	return err
+}
+
+// numbers, renders and stores a document
+// the sequence row stays locked until the transaction ends, so a rollback never leaves a gap
+func insertInvoice(
+	ctx context.Context,
+	tx pgx.Tx,
+	bookingID, organizerID uint32,
+	relatedInvoiceID *uint32,
+	prefix string,
+	doc invoice.Document,
+) (*models.Invoice, error) {
+	// queries
+	sequenceQuery := `
+		INSERT INTO invoice_sequences (organizer_id, kind, last_number)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (organizer_id, kind) DO UPDATE
+		SET last_number = invoice_sequences.last_number + 1
+		RETURNING last_number;
+	`
+	insertQuery := `
+		INSERT INTO invoices (
+			booking_id, organizer_id, kind, sequence, number, related_invoice_id,
+			currency, subtotal, tax, total, document, pdf, issued_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING` + invoiceColumns + `;
+	`
+
+	var sequence int64
+	err := tx.QueryRow(ctx, sequenceQuery, organizerID, doc.Kind).Scan(&sequence)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.Number = fmt.Sprintf("%s-%06d", prefix, sequence)
+	if doc.Kind == invoice.KindCreditNote {
+		doc.Number = fmt.Sprintf("%s-CN-%06d", prefix, sequence)
+	}
+
+	document, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanInvoice(tx.QueryRow(ctx, insertQuery,
+		bookingID,
+		organizerID,
+		doc.Kind,
+		sequence,
+		doc.Number,
+		relatedInvoiceID,
+		doc.Currency,
+		doc.Subtotal,
+		doc.Tax,
+		doc.Total,
+		document,
+		invoice.Render(doc),
+		doc.IssuedAt,
+	))
+}
+
+// scans a row selected with invoiceColumns
+func scanInvoice(row pgx.Row) (*models.Invoice, error) {
+	var issued models.Invoice
+	err := row.Scan(
+		&issued.ID,
+		&issued.BookingID,
+		&issued.OrganizerID,
+		&issued.Kind,
+		&issued.Number,
+		&issued.RelatedInvoiceID,
+		&issued.Currency,
+		&issued.Subtotal,
+		&issued.Tax,
+		&issued.Total,
+		&issued.IssuedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &issued, nil
+}
@@ -0,0 +1,160 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// only performed by organizer
+// a conference has one cover, uploading a new cover replaces the old one which is returned
+// so its blobs can be removed
+func CreateConferenceMedia(ctx context.Context, db *pgxpool.Pool, media *models.ConferenceMedia) (uint32, []models.ConferenceMedia, error) {
+	// queries
+	getQuery := `
+		SELECT organizer_id FROM conferences
+		WHERE id = $1 AND deleted_at IS NULL;
+	`
+	replaceQuery := `
+		DELETE FROM conference_media
+		WHERE conference_id = $1 AND kind = 'cover'
+		RETURNING id, conference_id, kind, caption, content_type, variants, uploaded_by, created_at;
+	`
+	insertQuery := `
+		INSERT INTO conference_media (conference_id, kind, caption, content_type, variants, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id;
+	`
+
+	if media.Kind != "cover" && media.Kind != "speaker" && media.Kind != "venue" {
+		return 0, nil, errors.New("invalid kind, must be 'cover', 'speaker' or 'venue'")
+	}
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// validate organizer
+	var organizerID uint32
+	err = tx.QueryRow(ctx, getQuery, media.ConferenceID).Scan(&organizerID)
+	if err != nil {
+		return 0, nil, errors.New("conference not found")
+	}
+
+	if media.UploadedBy == nil || *media.UploadedBy != organizerID {
+		return 0, nil, errors.New("unauthorized: you are not the correct organizer")
+	}
+
+	// replace existing cover
+	replaced := []models.ConferenceMedia{}
+	if media.Kind == "cover" {
+		rows, err := tx.Query(ctx, replaceQuery, media.ConferenceID)
+		if err != nil {
+			return 0, nil, err
+		}
+		replaced, err = scanConferenceMedia(rows)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// insert media
+	var mediaID uint32
+	err = tx.QueryRow(ctx, insertQuery,
+		media.ConferenceID,
+		media.Kind,
+		media.Caption,
+		media.ContentType,
+		media.Variants,
+		media.UploadedBy,
+	).Scan(&mediaID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return mediaID, replaced, nil
+}
+
+// fetches media of a conference, covers first
+func GetConferenceMedia(ctx context.Context, db *pgxpool.Pool, conferenceID uint32) ([]models.ConferenceMedia, error) {
+	// query
+	getQuery := `
+		SELECT m.id, m.conference_id, m.kind, m.caption, m.content_type, m.variants, m.uploaded_by, m.created_at
+		FROM conference_media m
+		JOIN conferences c ON c.id = m.conference_id
+		WHERE m.conference_id = $1 AND c.deleted_at IS NULL
+		ORDER BY m.kind = 'cover' DESC, m.created_at, m.id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, conferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanConferenceMedia(rows)
+}
+
+// only performed by organizer, returns the deleted row so its blobs can be removed
+func DeleteConferenceMedia(ctx context.Context, db *pgxpool.Pool, mediaID, organizerID uint32) (*models.ConferenceMedia, error) {
+	// query
+	deleteQuery := `
+		DELETE FROM conference_media m
+		USING conferences c
+		WHERE m.id = $1 AND c.id = m.conference_id AND c.organizer_id = $2
+		RETURNING m.id, m.conference_id, m.kind, m.caption, m.content_type, m.variants, m.uploaded_by, m.created_at;
+	`
+
+	rows, err := db.Query(ctx, deleteQuery, mediaID, organizerID)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := scanConferenceMedia(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deleted) == 0 {
+		return nil, errors.New("media not found or not your conference")
+	}
+
+	return &deleted[0], nil
+}
+
+// creates array of media from rows
+func scanConferenceMedia(rows pgx.Rows) ([]models.ConferenceMedia, error) {
+	defer rows.Close()
+
+	mediaList := []models.ConferenceMedia{}
+	for rows.Next() {
+		var media models.ConferenceMedia
+		err := rows.Scan(
+			&media.ID,
+			&media.ConferenceID,
+			&media.Kind,
+			&media.Caption,
+			&media.ContentType,
+			&media.Variants,
+			&media.UploadedBy,
+			&media.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mediaList = append(mediaList, media)
+	}
+
+	return mediaList, rows.Err()
+}
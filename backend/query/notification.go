@@ -0,0 +1,84 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// delivery attempts before a notification is marked failed
+const maxNotificationAttempts = 5
+
+// fetches queued notifications in creation order
+func GetQueuedNotifications(ctx context.Context, db *pgxpool.Pool, limit int) ([]models.Notification, error) {
+	// limit validate
+	if limit <= 0 {
+		return nil, errors.New("invalid limit")
+	}
+
+	// query
+	getQuery := `
+		SELECT id, user_id, email, subject, body, status, attempts, last_error, created_at, sent_at
+		FROM notifications
+		WHERE status = 'queued'
+		ORDER BY created_at, id
+		LIMIT $1;
+	`
+
+	rows, err := db.Query(ctx, getQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.Email,
+			&n.Subject,
+			&n.Body,
+			&n.Status,
+			&n.Attempts,
+			&n.LastError,
+			&n.CreatedAt,
+			&n.SentAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+// marks a notification as delivered
+func MarkNotificationSent(ctx context.Context, db *pgxpool.Pool, notificationID uint64) error {
+	updateQuery := `
+		UPDATE notifications
+		SET status = 'sent', attempts = attempts + 1, last_error = NULL, sent_at = NOW()
+		WHERE id = $1;
+	`
+
+	_, err := db.Exec(ctx, updateQuery, notificationID)
+	return err
+}
+
+// records a failed delivery, gives up after maxNotificationAttempts
+func MarkNotificationFailed(ctx context.Context, db *pgxpool.Pool, notificationID uint64, sendErr error) error {
+	updateQuery := `
+		UPDATE notifications
+		SET attempts = attempts + 1,
+			last_error = $1,
+			status = CASE WHEN attempts + 1 >= $2 THEN 'failed' ELSE 'queued' END
+		WHERE id = $3;
+	`
+
+	_, err := db.Exec(ctx, updateQuery, sendErr.Error(), maxNotificationAttempts, notificationID)
+	return err
+}
@@ -0,0 +1,112 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var invoicePrefixPattern = regexp.MustCompile(`^[A-Z0-9]{1,10}$`)
+
+// fetches seller details printed on invoices => organizer
+func GetOrganizerProfile(ctx context.Context, db *pgxpool.Pool, organizerID uint32) (*models.OrganizerProfile, error) {
+	getQuery := `
+		SELECT organizer_id, legal_name, address, tax_id, invoice_prefix,
+			tax_country, charges_tax, prices_include_tax, tax_category, updated_at
+		FROM organizer_profiles
+		WHERE organizer_id = $1;
+	`
+
+	var profile models.OrganizerProfile
+	err := db.QueryRow(ctx, getQuery, organizerID).Scan(
+		&profile.OrganizerID,
+		&profile.LegalName,
+		&profile.Address,
+		&profile.TaxID,
+		&profile.InvoicePrefix,
+		&profile.TaxCountry,
+		&profile.ChargesTax,
+		&profile.PricesIncludeTax,
+		&profile.TaxCategory,
+		&profile.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// creates or replaces seller details and tax settings => organizer
+// issued invoices and past bookings keep the details they were made with
+func SaveOrganizerProfile(ctx context.Context, db *pgxpool.Pool, profile *models.OrganizerProfile) error {
+	upsertQuery := `
+		INSERT INTO organizer_profiles (
+			organizer_id, legal_name, address, tax_id, invoice_prefix,
+			tax_country, charges_tax, prices_include_tax, tax_category
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (organizer_id) DO UPDATE
+		SET legal_name = EXCLUDED.legal_name,
+			address = EXCLUDED.address,
+			tax_id = EXCLUDED.tax_id,
+			invoice_prefix = EXCLUDED.invoice_prefix,
+			tax_country = EXCLUDED.tax_country,
+			charges_tax = EXCLUDED.charges_tax,
+			prices_include_tax = EXCLUDED.prices_include_tax,
+			tax_category = EXCLUDED.tax_category,
+			updated_at = NOW();
+	`
+
+	// validate input
+	profile.LegalName = strings.TrimSpace(profile.LegalName)
+	profile.Address = strings.TrimSpace(profile.Address)
+	profile.TaxID = strings.ToUpper(strings.TrimSpace(profile.TaxID))
+	profile.InvoicePrefix = strings.ToUpper(strings.TrimSpace(profile.InvoicePrefix))
+	if profile.InvoicePrefix == "" {
+		profile.InvoicePrefix = "INV"
+	}
+	profile.TaxCategory = strings.ToLower(strings.TrimSpace(profile.TaxCategory))
+	if profile.TaxCategory == "" {
+		profile.TaxCategory = "standard"
+	}
+	if profile.TaxCountry != nil {
+		country := strings.ToUpper(strings.TrimSpace(*profile.TaxCountry))
+		profile.TaxCountry = &country
+		if country == "" {
+			profile.TaxCountry = nil
+		}
+	}
+
+	if profile.LegalName == "" {
+		return errors.New("legal name cannot be empty")
+	}
+
+	if !invoicePrefixPattern.MatchString(profile.InvoicePrefix) {
+		return errors.New("invoice prefix must be 1 to 10 letters or digits")
+	}
+
+	if profile.ChargesTax && profile.TaxCountry == nil {
+		return errors.New("tax country is required to charge tax")
+	}
+
+	_, err := db.Exec(ctx, upsertQuery,
+		profile.OrganizerID,
+		profile.LegalName,
+		profile.Address,
+		profile.TaxID,
+		profile.InvoicePrefix,
+		profile.TaxCountry,
+		profile.ChargesTax,
+		profile.PricesIncludeTax,
+		profile.TaxCategory,
+	)
+	if err != nil {
+		return errors.New("unknown tax country")
+	}
+	return nil
+}
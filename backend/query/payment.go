@@ -0,0 +1,542 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// booking statuses => only paid bookings hold tickets
+const (
+	BookingPendingPayment = "pending_payment"
+	BookingPaid           = "paid"
+	BookingFailed         = "failed"
+	BookingRefunded       = "refunded"
+	BookingCancelled      = "cancelled"
+)
+
+// provider calls before a refund is marked failed
+const maxRefundAttempts = 5
+
+// records the provider intent created for a pending booking or order
+func CreatePayment(ctx context.Context, db *pgxpool.Pool, payment *models.Payment) (uint32, error) {
+	insertQuery := `
+		INSERT INTO payments (booking_id, order_id, provider, intent_id, amount, currency, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id;
+	`
+
+	var paymentID uint32
+	err := db.QueryRow(ctx, insertQuery,
+		payment.BookingID,
+		payment.OrderID,
+		payment.Provider,
+		payment.IntentID,
+		payment.Amount,
+		payment.Currency,
+		payment.Status,
+	).Scan(&paymentID)
+
+	return paymentID, err
+}
+
+// fetches the latest payment of a booking, which is the payment of its order when it has one
+func GetPaymentByBookingID(ctx context.Context, db *pgxpool.Pool, bookingID uint32) (*models.Payment, error) {
+	getQuery := `
+		SELECT id, booking_id, order_id, provider, intent_id, amount, currency, status,
+			failure_reason, created_at, updated_at
+		FROM payments
+		WHERE booking_id = $1 OR order_id = (SELECT order_id FROM bookings WHERE id = $1)
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1;
+	`
+
+	return scanPayment(db.QueryRow(ctx, getQuery, bookingID))
+}
+
+// fetches the latest payment of an order
+func GetPaymentByOrderID(ctx context.Context, db *pgxpool.Pool, orderID uint32) (*models.Payment, error) {
+	getQuery := `
+		SELECT id, booking_id, order_id, provider, intent_id, amount, currency, status,
+			failure_reason, created_at, updated_at
+		FROM payments
+		WHERE order_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1;
+	`
+
+	return scanPayment(db.QueryRow(ctx, getQuery, orderID))
+}
+
+func scanPayment(row pgx.Row) (*models.Payment, error) {
+	var payment models.Payment
+	err := row.Scan(
+		&payment.ID,
+		&payment.BookingID,
+		&payment.OrderID,
+		&payment.Provider,
+		&payment.IntentID,
+		&payment.Amount,
+		&payment.Currency,
+		&payment.Status,
+		&payment.FailureReason,
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+	)
+	if err != nil {
+		return nil, errors.New("payment not found")
+	}
+
+	return &payment, nil
+}
+
+// records a succeeded intent and marks its booking, or every booking of its order, paid
+// returns the bookings paid by this call, so tickets are generated once
+// money arriving for a booking that failed or was cancelled meanwhile is queued for refund
+func CompletePayment(ctx context.Context, db Querier, intentID string) ([]uint32, error) {
+	// queries
+	updatePaymentQuery := `
+		UPDATE payments SET status = 'succeeded', failure_reason = NULL, updated_at = NOW()
+		WHERE intent_id = $1 AND status <> 'succeeded'
+		RETURNING id, booking_id, order_id;
+	`
+	updateBookingQuery := `
+		UPDATE bookings SET status = 'paid'
+		WHERE id = $1 AND status = 'pending_payment';
+	`
+	updateOrderQuery := `
+		UPDATE orders SET status = CASE WHEN $2 THEN 'paid' ELSE 'failed' END
+		WHERE id = $1;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var paymentID uint32
+	var bookingID, orderID *uint32
+	err = tx.QueryRow(ctx, updatePaymentQuery, intentID).Scan(&paymentID, &bookingID, &orderID)
+	if err == pgx.ErrNoRows {
+		// already recorded => repeated webhook or confirm
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bookings, err := lockPaymentBookings(ctx, tx, bookingID, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	paid := []uint32{}
+	for _, booking := range bookings {
+		cmdTag, err := tx.Exec(ctx, updateBookingQuery, booking.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if cmdTag.RowsAffected() == 1 {
+			if _, err := issueInvoiceTx(ctx, tx, booking.ID, time.Now()); err != nil {
+				return nil, err
+			}
+			paid = append(paid, booking.ID)
+			continue
+		}
+
+		// free bookings of an order were never part of the payment
+		if booking.Status == BookingPaid && booking.TotalPrice == 0 {
+			continue
+		}
+
+		err = queueRefund(ctx, tx, booking.ID, paymentID, booking.TotalPrice, "payment received after the booking was closed")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if orderID != nil {
+		if _, err := tx.Exec(ctx, updateOrderQuery, *orderID, len(paid) > 0); err != nil {
+			return nil, err
+		}
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return paid, nil
+}
+
+// records a declined intent, the booking or order fails and its tickets go back on sale
+func FailPayment(ctx context.Context, db *pgxpool.Pool, intentID, reason string) error {
+	updateQuery := `
+		UPDATE payments SET status = 'failed', failure_reason = $2, updated_at = NOW()
+		WHERE intent_id = $1 AND status = 'requires_confirmation'
+		RETURNING booking_id, order_id;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var bookingID, orderID *uint32
+	err = tx.QueryRow(ctx, updateQuery, intentID, reason).Scan(&bookingID, &orderID)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := failPaymentBookings(ctx, tx, bookingID, orderID); err != nil {
+		return err
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
+
+// fails a pending booking and any open intents, used when payment cannot start or never completes
+// a booking of an order fails with the whole order, they share one payment
+func FailBooking(ctx context.Context, db *pgxpool.Pool, bookingID uint32, reason string) error {
+	// queries
+	getQuery := `
+		SELECT order_id FROM bookings WHERE id = $1;
+	`
+	updateQuery := `
+		UPDATE payments SET status = 'failed', failure_reason = $3, updated_at = NOW()
+		WHERE (booking_id = $1 OR order_id = $2) AND status = 'requires_confirmation';
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var orderID *uint32
+	if err := tx.QueryRow(ctx, getQuery, bookingID).Scan(&orderID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, updateQuery, bookingID, orderID, reason); err != nil {
+		return err
+	}
+
+	if orderID != nil {
+		err = failPaymentBookings(ctx, tx, nil, orderID)
+	} else {
+		err = failPaymentBookings(ctx, tx, &bookingID, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
+
+// fails an order and its pending bookings, used when its payment cannot start
+func FailOrder(ctx context.Context, db *pgxpool.Pool, orderID uint32, reason string) error {
+	updateQuery := `
+		UPDATE payments SET status = 'failed', failure_reason = $2, updated_at = NOW()
+		WHERE order_id = $1 AND status = 'requires_confirmation';
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, updateQuery, orderID, reason); err != nil {
+		return err
+	}
+
+	if err := failPaymentBookings(ctx, tx, nil, &orderID); err != nil {
+		return err
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
+
+// locks the bookings a payment is for, the single booking or every booking of the order
+func lockPaymentBookings(ctx context.Context, tx pgx.Tx, bookingID, orderID *uint32) ([]models.Booking, error) {
+	getQuery := `
+		SELECT id, status, total_price FROM bookings
+		WHERE id = $1 OR order_id = $2
+		ORDER BY id
+		FOR UPDATE;
+	`
+
+	rows, err := tx.Query(ctx, getQuery, bookingID, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Booking, error) {
+		var booking models.Booking
+		err := row.Scan(&booking.ID, &booking.Status, &booking.TotalPrice)
+		return booking, err
+	})
+}
+
+// releases the pending bookings of a failed payment, an order fails unless some booking was already paid
+func failPaymentBookings(ctx context.Context, tx pgx.Tx, bookingID, orderID *uint32) error {
+	orderQuery := `
+		UPDATE orders SET status = 'failed'
+		WHERE id = $1 AND status = 'pending_payment';
+	`
+
+	bookings, err := lockPaymentBookings(ctx, tx, bookingID, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, booking := range bookings {
+		if _, err := releasePendingBooking(ctx, tx, booking.ID, BookingFailed); err != nil {
+			return err
+		}
+	}
+
+	if orderID != nil {
+		_, err = tx.Exec(ctx, orderQuery, *orderID)
+	}
+	return err
+}
+
+// fails bookings left unpaid longer than ttl => expiry job
+func ExpirePendingBookings(ctx context.Context, db *pgxpool.Pool, ttl time.Duration) (int64, error) {
+	getQuery := `
+		SELECT id FROM bookings
+		WHERE status = 'pending_payment' AND booked_at < $1
+		ORDER BY id;
+	`
+
+	if ttl <= 0 {
+		return 0, errors.New("payment window must be positive")
+	}
+
+	rows, err := db.Query(ctx, getQuery, time.Now().Add(-ttl))
+	if err != nil {
+		return 0, err
+	}
+	bookingIDs, err := pgx.CollectRows(rows, pgx.RowTo[uint32])
+	if err != nil {
+		return 0, err
+	}
+
+	for _, bookingID := range bookingIDs {
+		if err := FailBooking(ctx, db, bookingID, "payment window expired"); err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(bookingIDs)), nil
+}
+
+// moves a pending booking to a closed status inside a transaction
+// tickets return to the ticket type and a promo code use is given back
+func releasePendingBooking(ctx context.Context, tx pgx.Tx, bookingID uint32, status string) (bool, error) {
+	// queries
+	updateQuery := `
+		UPDATE bookings SET status = $2
+		WHERE id = $1 AND status = 'pending_payment'
+		RETURNING ticket_type_id, tickets_booked, promo_code_id;
+	`
+	inventoryQuery := `
+		UPDATE ticket_types SET available = available + $1
+		WHERE id = $2;
+	`
+	redemptionQuery := `
+		DELETE FROM promo_redemptions WHERE booking_id = $1;
+	`
+	promoQuery := `
+		UPDATE promo_codes SET uses = uses - 1
+		WHERE id = $1 AND uses > 0;
+	`
+
+	var ticketTypeID, ticketsBooked uint32
+	var promoCodeID *uint32
+	err := tx.QueryRow(ctx, updateQuery, bookingID, status).Scan(&ticketTypeID, &ticketsBooked, &promoCodeID)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(ctx, inventoryQuery, ticketsBooked, ticketTypeID); err != nil {
+		return false, err
+	}
+
+	if promoCodeID != nil {
+		if _, err := tx.Exec(ctx, redemptionQuery, bookingID); err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec(ctx, promoQuery, *promoCodeID); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// queues a refund inside a transaction, submitted later by the refund job
+func queueRefund(ctx context.Context, tx pgx.Tx, bookingID, paymentID uint32, amount int64, reason string) error {
+	insertQuery := `
+		INSERT INTO refunds (booking_id, payment_id, amount, reason)
+		VALUES ($1, $2, $3, $4);
+	`
+
+	if amount <= 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, insertQuery, bookingID, paymentID, amount, reason)
+	return err
+}
+
+// fetches queued refunds with the intent they return money from
+func GetQueuedRefunds(ctx context.Context, db *pgxpool.Pool, limit int) ([]models.Refund, error) {
+	// limit validate
+	if limit <= 0 {
+		return nil, errors.New("invalid limit")
+	}
+
+	// query
+	getQuery := `
+		SELECT r.id, r.booking_id, r.payment_id, p.intent_id, r.amount, r.reason, r.status,
+			r.provider_refund_id, r.attempts, r.last_error, r.created_at, r.settled_at
+		FROM refunds r
+		JOIN payments p ON p.id = r.payment_id
+		WHERE r.status = 'queued'
+		ORDER BY r.created_at, r.id
+		LIMIT $1;
+	`
+
+	rows, err := db.Query(ctx, getQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refunds := []models.Refund{}
+	for rows.Next() {
+		var refund models.Refund
+		err := rows.Scan(
+			&refund.ID,
+			&refund.BookingID,
+			&refund.PaymentID,
+			&refund.IntentID,
+			&refund.Amount,
+			&refund.Reason,
+			&refund.Status,
+			&refund.ProviderRefundID,
+			&refund.Attempts,
+			&refund.LastError,
+			&refund.CreatedAt,
+			&refund.SettledAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, rows.Err()
+}
+
+// records the provider reference of a submitted refund, it settles through SettleRefund
+func MarkRefundSubmitted(ctx context.Context, db *pgxpool.Pool, refundID uint32, providerRefundID string) error {
+	updateQuery := `
+		UPDATE refunds
+		SET status = 'pending', provider_refund_id = $1, attempts = attempts + 1, last_error = NULL
+		WHERE id = $2 AND status = 'queued';
+	`
+
+	_, err := db.Exec(ctx, updateQuery, providerRefundID, refundID)
+	return err
+}
+
+// records a failed provider call, gives up after maxRefundAttempts
+func MarkRefundFailed(ctx context.Context, db *pgxpool.Pool, refundID uint32, refundErr error) error {
+	updateQuery := `
+		UPDATE refunds
+		SET attempts = attempts + 1,
+			last_error = $1,
+			status = CASE WHEN attempts + 1 >= $2 THEN 'failed' ELSE 'queued' END
+		WHERE id = $3 AND status = 'queued';
+	`
+
+	_, err := db.Exec(ctx, updateQuery, refundErr.Error(), maxRefundAttempts, refundID)
+	return err
+}
+
+// records the outcome of a submitted refund
+// a succeeded refund is added to the booking, which becomes refunded once fully paid back,
+// and a credit note is issued against its invoice
+func SettleRefund(ctx context.Context, db *pgxpool.Pool, providerRefundID string, succeeded bool, reason string) error {
+	// queries
+	updateQuery := `
+		UPDATE refunds
+		SET status = CASE WHEN $2 THEN 'succeeded' ELSE 'failed' END,
+			last_error = NULLIF($3, ''),
+			settled_at = NOW()
+		WHERE provider_refund_id = $1 AND status = 'pending'
+		RETURNING booking_id, amount, reason;
+	`
+	bookingQuery := `
+		UPDATE bookings
+		SET refunded_amount = refunded_amount + $1,
+			status = CASE WHEN refunded_amount + $1 >= total_price THEN 'refunded' ELSE status END
+		WHERE id = $2;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var bookingID uint32
+	var amount int64
+	var refundReason string
+	err = tx.QueryRow(ctx, updateQuery, providerRefundID, succeeded, reason).Scan(&bookingID, &amount, &refundReason)
+	if err == pgx.ErrNoRows {
+		// unknown or already settled
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if succeeded {
+		if _, err := tx.Exec(ctx, bookingQuery, amount, bookingID); err != nil {
+			return err
+		}
+		if err := issueCreditNoteTx(ctx, tx, bookingID, amount, refundReason, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
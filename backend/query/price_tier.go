@@ -0,0 +1,167 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// only performed by organizer
+func CreatePriceTier(ctx context.Context, db *pgxpool.Pool, tier *models.PriceTier, conferenceID, organizerID uint32) (uint32, error) {
+	// queries
+	getQuery := `
+		SELECT c.organizer_id
+		FROM ticket_types t
+		JOIN conferences c ON c.id = t.conference_id
+		WHERE t.id = $1 AND c.id = $2 AND c.deleted_at IS NULL;
+	`
+	insertQuery := `
+		INSERT INTO price_tiers (ticket_type_id, name, price, starts_at, ends_at, max_sold, position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id;
+	`
+
+	// validate input
+	tier.Name = strings.TrimSpace(tier.Name)
+	if tier.Name == "" {
+		return 0, errors.New("tier name cannot be empty")
+	}
+
+	if tier.Price < 0 {
+		return 0, errors.New("price cannot be negative")
+	}
+
+	if tier.StartsAt == nil && tier.EndsAt == nil && tier.MaxSold == nil {
+		return 0, errors.New("tier needs a start, an end or a sold limit")
+	}
+
+	if tier.StartsAt != nil && tier.EndsAt != nil && !tier.EndsAt.After(*tier.StartsAt) {
+		return 0, errors.New("tier end must be after its start")
+	}
+
+	if tier.MaxSold != nil && *tier.MaxSold == 0 {
+		return 0, errors.New("max sold should be greater than 0")
+	}
+
+	// validate organizer
+	var existingOrganizerID uint32
+	err := db.QueryRow(ctx, getQuery, tier.TicketTypeID, conferenceID).Scan(&existingOrganizerID)
+	if err != nil {
+		return 0, errors.New("ticket type not found")
+	}
+
+	if existingOrganizerID != organizerID {
+		return 0, errors.New("unauthorized: you are not the correct organizer")
+	}
+
+	var tierID uint32
+	err = db.QueryRow(ctx, insertQuery,
+		tier.TicketTypeID,
+		tier.Name,
+		tier.Price,
+		tier.StartsAt,
+		tier.EndsAt,
+		tier.MaxSold,
+		tier.Position,
+	).Scan(&tierID)
+
+	return tierID, err
+}
+
+// fetches price tiers of every ticket type of a conference keyed by ticket type id
+func GetPriceTiersByConferenceID(ctx context.Context, db *pgxpool.Pool, conferenceID uint32) (map[uint32][]models.PriceTier, error) {
+	// query
+	getQuery := `
+		SELECT p.id, p.ticket_type_id, p.name, p.price, p.starts_at, p.ends_at, p.max_sold, p.position, p.created_at
+		FROM price_tiers p
+		JOIN ticket_types t ON t.id = p.ticket_type_id
+		WHERE t.conference_id = $1
+		ORDER BY p.position, p.id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, conferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	tiers, err := scanPriceTiers(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	byType := make(map[uint32][]models.PriceTier)
+	for _, tier := range tiers {
+		byType[tier.TicketTypeID] = append(byType[tier.TicketTypeID], tier)
+	}
+
+	return byType, nil
+}
+
+// fetches price tiers of one ticket type inside a transaction => booking time pricing
+func getPriceTiersTx(ctx context.Context, tx pgx.Tx, ticketTypeID uint32) ([]models.PriceTier, error) {
+	getQuery := `
+		SELECT id, ticket_type_id, name, price, starts_at, ends_at, max_sold, position, created_at
+		FROM price_tiers
+		WHERE ticket_type_id = $1
+		ORDER BY position, id;
+	`
+
+	rows, err := tx.Query(ctx, getQuery, ticketTypeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPriceTiers(rows)
+}
+
+// only performed by organizer
+func DeletePriceTier(ctx context.Context, db *pgxpool.Pool, tierID, conferenceID, organizerID uint32) error {
+	deleteQuery := `
+		DELETE FROM price_tiers p
+		USING ticket_types t, conferences c
+		WHERE p.id = $1 AND t.id = p.ticket_type_id AND c.id = t.conference_id
+			AND c.id = $2 AND c.organizer_id = $3;
+	`
+
+	cmdTag, err := db.Exec(ctx, deleteQuery, tierID, conferenceID, organizerID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("price tier not found or not your conference")
+	}
+
+	return nil
+}
+
+// creates array of price tiers from rows
+func scanPriceTiers(rows pgx.Rows) ([]models.PriceTier, error) {
+	defer rows.Close()
+
+	tiers := []models.PriceTier{}
+	for rows.Next() {
+		var tier models.PriceTier
+		err := rows.Scan(
+			&tier.ID,
+			&tier.TicketTypeID,
+			&tier.Name,
+			&tier.Price,
+			&tier.StartsAt,
+			&tier.EndsAt,
+			&tier.MaxSold,
+			&tier.Position,
+			&tier.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, tier)
+	}
+
+	return tiers, rows.Err()
+}
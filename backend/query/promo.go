@@ -0,0 +1,284 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// only performed by organizer
+func CreatePromoCode(ctx context.Context, db *pgxpool.Pool, promo *models.PromoCode, organizerID uint32) (uint32, error) {
+	// queries
+	getQuery := `
+		SELECT organizer_id FROM conferences
+		WHERE id = $1 AND deleted_at IS NULL;
+	`
+	typesQuery := `
+		SELECT COUNT(*) FROM ticket_types
+		WHERE conference_id = $1 AND id = ANY($2);
+	`
+	insertQuery := `
+		INSERT INTO promo_codes (
+			conference_id, code, discount_type, amount,
+			max_uses, per_user_limit, valid_from, valid_until
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id;
+	`
+	restrictQuery := `
+		INSERT INTO promo_code_ticket_types (promo_code_id, ticket_type_id)
+		SELECT $1, unnest($2::int[]);
+	`
+
+	// validate input
+	promo.Code = strings.ToUpper(strings.TrimSpace(promo.Code))
+	promo.DiscountType = strings.ToLower(strings.TrimSpace(promo.DiscountType))
+
+	if promo.Code == "" || strings.ContainsAny(promo.Code, " \t\n") {
+		return 0, errors.New("code cannot be empty or contain spaces")
+	}
+
+	if promo.DiscountType != "percent" && promo.DiscountType != "fixed" {
+		return 0, errors.New("invalid discount type, must be 'percent' or 'fixed'")
+	}
+
+	if promo.Amount <= 0 || (promo.DiscountType == "percent" && promo.Amount > 100) {
+		return 0, errors.New("invalid discount amount")
+	}
+
+	if promo.ValidFrom != nil && promo.ValidUntil != nil && !promo.ValidUntil.After(*promo.ValidFrom) {
+		return 0, errors.New("valid until must be after valid from")
+	}
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// validate organizer
+	var existingOrganizerID uint32
+	err = tx.QueryRow(ctx, getQuery, promo.ConferenceID).Scan(&existingOrganizerID)
+	if err != nil {
+		return 0, errors.New("conference not found")
+	}
+
+	if existingOrganizerID != organizerID {
+		return 0, errors.New("unauthorized: you are not the correct organizer")
+	}
+
+	// restricted ticket types must belong to the conference
+	ticketTypeIDs := make([]int32, 0, len(promo.TicketTypeIDs))
+	for _, id := range promo.TicketTypeIDs {
+		if !slices.Contains(ticketTypeIDs, int32(id)) {
+			ticketTypeIDs = append(ticketTypeIDs, int32(id))
+		}
+	}
+
+	var matching int
+	err = tx.QueryRow(ctx, typesQuery, promo.ConferenceID, ticketTypeIDs).Scan(&matching)
+	if err != nil {
+		return 0, err
+	}
+
+	if matching != len(ticketTypeIDs) {
+		return 0, errors.New("ticket types must belong to the conference")
+	}
+
+	// insert promo code
+	var promoID uint32
+	err = tx.QueryRow(ctx, insertQuery,
+		promo.ConferenceID,
+		promo.Code,
+		promo.DiscountType,
+		promo.Amount,
+		promo.MaxUses,
+		promo.PerUserLimit,
+		promo.ValidFrom,
+		promo.ValidUntil,
+	).Scan(&promoID)
+	if err != nil {
+		return 0, errors.New("code already exists for this conference")
+	}
+
+	if len(ticketTypeIDs) > 0 {
+		_, err = tx.Exec(ctx, restrictQuery, promoID, ticketTypeIDs)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return promoID, nil
+}
+
+// fetches promo codes of a conference => organizer
+func GetPromoCodesByConferenceID(ctx context.Context, db *pgxpool.Pool, conferenceID, organizerID uint32) ([]models.PromoCode, error) {
+	// query
+	getQuery := `
+		SELECT p.id, p.conference_id, p.code, p.discount_type, p.amount, p.max_uses,
+			p.per_user_limit, p.uses, p.valid_from, p.valid_until,
+			COALESCE(array_agg(pt.ticket_type_id) FILTER (WHERE pt.ticket_type_id IS NOT NULL), '{}'),
+			p.created_at
+		FROM promo_codes p
+		JOIN conferences c ON c.id = p.conference_id
+		LEFT JOIN promo_code_ticket_types pt ON pt.promo_code_id = p.id
+		WHERE p.conference_id = $1 AND c.organizer_id = $2
+		GROUP BY p.id
+		ORDER BY p.created_at, p.id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, conferenceID, organizerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promos := []models.PromoCode{}
+	for rows.Next() {
+		var promo models.PromoCode
+		err := rows.Scan(
+			&promo.ID,
+			&promo.ConferenceID,
+			&promo.Code,
+			&promo.DiscountType,
+			&promo.Amount,
+			&promo.MaxUses,
+			&promo.PerUserLimit,
+			&promo.Uses,
+			&promo.ValidFrom,
+			&promo.ValidUntil,
+			&promo.TicketTypeIDs,
+			&promo.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		promos = append(promos, promo)
+	}
+
+	return promos, rows.Err()
+}
+
+// only performed by organizer, past redemptions keep their discount
+func DeletePromoCode(ctx context.Context, db *pgxpool.Pool, promoID, conferenceID, organizerID uint32) error {
+	deleteQuery := `
+		DELETE FROM promo_codes p
+		USING conferences c
+		WHERE p.id = $1 AND c.id = p.conference_id AND c.id = $2 AND c.organizer_id = $3;
+	`
+
+	cmdTag, err := db.Exec(ctx, deleteQuery, promoID, conferenceID, organizerID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("promo code not found or not your conference")
+	}
+
+	return nil
+}
+
+// locks and validates a promo code for a booking inside the booking transaction
+// the row lock serializes concurrent redemptions so usage limits hold
+func lockPromoCode(ctx context.Context, tx pgx.Tx, conferenceID, ticketTypeID, userID uint32, code string, now time.Time) (*models.PromoCode, error) {
+	// queries
+	getQuery := `
+		SELECT id, discount_type, amount, max_uses, per_user_limit, uses, valid_from, valid_until
+		FROM promo_codes
+		WHERE conference_id = $1 AND code = upper($2)
+		FOR UPDATE;
+	`
+	typesQuery := `
+		SELECT ticket_type_id FROM promo_code_ticket_types
+		WHERE promo_code_id = $1;
+	`
+	userUsesQuery := `
+		SELECT COUNT(*) FROM promo_redemptions
+		WHERE promo_code_id = $1 AND user_id = $2;
+	`
+
+	promo := models.PromoCode{ConferenceID: conferenceID, Code: code}
+	err := tx.QueryRow(ctx, getQuery, conferenceID, strings.TrimSpace(code)).Scan(
+		&promo.ID,
+		&promo.DiscountType,
+		&promo.Amount,
+		&promo.MaxUses,
+		&promo.PerUserLimit,
+		&promo.Uses,
+		&promo.ValidFrom,
+		&promo.ValidUntil,
+	)
+	if err != nil {
+		return nil, errors.New("invalid promo code")
+	}
+
+	if (promo.ValidFrom != nil && now.Before(*promo.ValidFrom)) || (promo.ValidUntil != nil && !now.Before(*promo.ValidUntil)) {
+		return nil, errors.New("promo code is not valid at this time")
+	}
+
+	if promo.MaxUses != nil && promo.Uses >= *promo.MaxUses {
+		return nil, errors.New("promo code has been used up")
+	}
+
+	// ticket type restriction
+	rows, err := tx.Query(ctx, typesQuery, promo.ID)
+	if err != nil {
+		return nil, err
+	}
+	promo.TicketTypeIDs, err = pgx.CollectRows(rows, pgx.RowTo[uint32])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(promo.TicketTypeIDs) > 0 && !slices.Contains(promo.TicketTypeIDs, ticketTypeID) {
+		return nil, errors.New("promo code does not apply to this ticket type")
+	}
+
+	// per user limit
+	if promo.PerUserLimit != nil {
+		var userUses uint32
+		err = tx.QueryRow(ctx, userUsesQuery, promo.ID, userID).Scan(&userUses)
+		if err != nil {
+			return nil, err
+		}
+		if userUses >= *promo.PerUserLimit {
+			return nil, errors.New("you have already used this promo code")
+		}
+	}
+
+	return &promo, nil
+}
+
+// records a redemption and counts the use inside the booking transaction
+func redeemPromoCode(ctx context.Context, tx pgx.Tx, promoID, bookingID, userID uint32, discount int64) error {
+	insertQuery := `
+		INSERT INTO promo_redemptions (promo_code_id, booking_id, user_id, discount)
+		VALUES ($1, $2, $3, $4);
+	`
+	updateQuery := `
+		UPDATE promo_codes SET uses = uses + 1
+		WHERE id = $1;
+	`
+
+	_, err := tx.Exec(ctx, insertQuery, promoID, bookingID, userID, discount)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, updateQuery, promoID)
+	return err
+}
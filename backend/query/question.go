@@ -0,0 +1,320 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// registration question kinds
+const (
+	QuestionText        = "text"
+	QuestionChoice      = "choice"
+	QuestionMultiChoice = "multi_choice"
+	QuestionBoolean     = "boolean"
+	QuestionNumber      = "number"
+)
+
+// only performed by organizer
+// a conditional question follows a choice or boolean question asked of the same tickets
+func CreateRegistrationQuestion(ctx context.Context, db *pgxpool.Pool, question *models.RegistrationQuestion, organizerID uint32) (uint32, error) {
+	// queries
+	getQuery := `
+		SELECT organizer_id FROM conferences
+		WHERE id = $1 AND deleted_at IS NULL;
+	`
+	typeQuery := `
+		SELECT 1 FROM ticket_types
+		WHERE id = $1 AND conference_id = $2;
+	`
+	parentQuery := `
+		SELECT ticket_type_id, kind, options FROM registration_questions
+		WHERE id = $1 AND conference_id = $2;
+	`
+	insertQuery := `
+		INSERT INTO registration_questions (
+			conference_id, ticket_type_id, label, kind, options, required,
+			show_if_question_id, show_if_answer, position
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id;
+	`
+
+	// validate input
+	question.Label = strings.TrimSpace(question.Label)
+	if question.Label == "" {
+		return 0, errors.New("question label cannot be empty")
+	}
+
+	switch question.Kind {
+	case QuestionChoice, QuestionMultiChoice:
+		options := []string{}
+		for _, option := range question.Options {
+			option = strings.TrimSpace(option)
+			if option == "" || slices.Contains(options, option) {
+				return 0, errors.New("options must be unique and not empty")
+			}
+			options = append(options, option)
+		}
+		if len(options) < 2 {
+			return 0, errors.New("choice questions need at least 2 options")
+		}
+		question.Options = options
+	case QuestionText, QuestionBoolean, QuestionNumber:
+		if len(question.Options) > 0 {
+			return 0, errors.New("only choice questions take options")
+		}
+		question.Options = []string{}
+	default:
+		return 0, errors.New("kind must be text, choice, multi_choice, boolean or number")
+	}
+
+	if (question.ShowIfQuestionID == nil) != (question.ShowIfAnswer == nil) {
+		return 0, errors.New("show_if_question_id and show_if_answer go together")
+	}
+
+	// validate organizer
+	var existingOrganizerID uint32
+	err := db.QueryRow(ctx, getQuery, question.ConferenceID).Scan(&existingOrganizerID)
+	if err != nil {
+		return 0, errors.New("conference not found")
+	}
+
+	if existingOrganizerID != organizerID {
+		return 0, errors.New("unauthorized: you are not the correct organizer")
+	}
+
+	if question.TicketTypeID != nil {
+		var exists int
+		err = db.QueryRow(ctx, typeQuery, *question.TicketTypeID, question.ConferenceID).Scan(&exists)
+		if err != nil {
+			return 0, errors.New("ticket type not found for this conference")
+		}
+	}
+
+	// the question it depends on must be asked whenever this one could be
+	if question.ShowIfQuestionID != nil {
+		var parentTypeID *uint32
+		var parentKind string
+		var parentOptions []string
+		err = db.QueryRow(ctx, parentQuery, *question.ShowIfQuestionID, question.ConferenceID).Scan(&parentTypeID, &parentKind, &parentOptions)
+		if err != nil {
+			return 0, errors.New("show_if question not found for this conference")
+		}
+
+		if parentTypeID != nil && (question.TicketTypeID == nil || *parentTypeID != *question.TicketTypeID) {
+			return 0, errors.New("show_if question is not asked of the same ticket types")
+		}
+
+		switch parentKind {
+		case QuestionChoice, QuestionMultiChoice:
+			if !slices.Contains(parentOptions, *question.ShowIfAnswer) {
+				return 0, errors.New("show_if answer is not an option of that question")
+			}
+		case QuestionBoolean:
+			if *question.ShowIfAnswer != "true" && *question.ShowIfAnswer != "false" {
+				return 0, errors.New("show_if answer of a boolean question must be true or false")
+			}
+		default:
+			return 0, errors.New("only choice and boolean questions can show other questions")
+		}
+	}
+
+	var questionID uint32
+	err = db.QueryRow(ctx, insertQuery,
+		question.ConferenceID,
+		question.TicketTypeID,
+		question.Label,
+		question.Kind,
+		question.Options,
+		question.Required,
+		question.ShowIfQuestionID,
+		question.ShowIfAnswer,
+		question.Position,
+	).Scan(&questionID)
+
+	return questionID, err
+}
+
+// fetches the registration form of a conference, every ticket type included
+func GetRegistrationQuestions(ctx context.Context, db Querier, conferenceID uint32) ([]models.RegistrationQuestion, error) {
+	getQuery := `
+		SELECT id, conference_id, ticket_type_id, label, kind, options, required,
+			show_if_question_id, show_if_answer, position, created_at
+		FROM registration_questions
+		WHERE conference_id = $1
+		ORDER BY position, id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, conferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.RegistrationQuestion])
+}
+
+// only performed by organizer
+// answers already given stay on the tickets but are no longer exported
+func DeleteRegistrationQuestion(ctx context.Context, db *pgxpool.Pool, questionID, conferenceID, organizerID uint32) error {
+	deleteQuery := `
+		DELETE FROM registration_questions q
+		USING conferences c
+		WHERE q.id = $1 AND c.id = q.conference_id AND c.id = $2 AND c.organizer_id = $3;
+	`
+
+	cmdTag, err := db.Exec(ctx, deleteQuery, questionID, conferenceID, organizerID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("question not found or not your conference")
+	}
+
+	return nil
+}
+
+// checks the answers of one attendee against the form of their ticket type and normalizes them
+// answers to questions not shown are dropped, required booleans are consent boxes and must be true
+func validateAnswers(ctx context.Context, db Querier, conferenceID, ticketTypeID uint32, answers map[uint32]any) (map[uint32]any, error) {
+	questions, err := GetRegistrationQuestions(ctx, db, conferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	asked := make(map[uint32]models.RegistrationQuestion)
+	for _, question := range questions {
+		if question.TicketTypeID == nil || *question.TicketTypeID == ticketTypeID {
+			asked[question.ID] = question
+		}
+	}
+
+	for questionID := range answers {
+		if _, ok := asked[questionID]; !ok {
+			return nil, fmt.Errorf("question %d is not part of this registration form", questionID)
+		}
+	}
+
+	// walk by id so a conditional question sees the answer it depends on
+	byID := slices.Clone(questions)
+	slices.SortFunc(byID, func(a, b models.RegistrationQuestion) int {
+		return int(a.ID) - int(b.ID)
+	})
+
+	normalized := make(map[uint32]any)
+	for _, question := range byID {
+		if _, ok := asked[question.ID]; !ok || !questionShown(question, asked, normalized) {
+			continue
+		}
+
+		answer, err := normalizeAnswer(question, answers[question.ID])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", question.Label, err)
+		}
+		if answer == nil {
+			if question.Required {
+				return nil, fmt.Errorf("%s: an answer is required", question.Label)
+			}
+			continue
+		}
+		normalized[question.ID] = answer
+	}
+
+	return normalized, nil
+}
+
+// a conditional question is shown when the question it depends on is shown and answered with the trigger
+// the question it depends on always has a lower id, so its answer is settled first
+func questionShown(question models.RegistrationQuestion, asked map[uint32]models.RegistrationQuestion, answers map[uint32]any) bool {
+	if question.ShowIfQuestionID == nil {
+		return true
+	}
+
+	parent, ok := asked[*question.ShowIfQuestionID]
+	if !ok || !questionShown(parent, asked, answers) {
+		return false
+	}
+
+	switch answer := answers[parent.ID].(type) {
+	case string:
+		return answer == *question.ShowIfAnswer
+	case []string:
+		return slices.Contains(answer, *question.ShowIfAnswer)
+	case bool:
+		return strconv.FormatBool(answer) == *question.ShowIfAnswer
+	}
+	return false
+}
+
+// converts a decoded json answer into the stored form of its kind, nil when unanswered
+func normalizeAnswer(question models.RegistrationQuestion, raw any) (any, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	switch question.Kind {
+	case QuestionText:
+		text, ok := raw.(string)
+		if !ok {
+			return nil, errors.New("answer must be text")
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			return nil, nil
+		}
+		return text, nil
+
+	case QuestionChoice:
+		choice, ok := raw.(string)
+		if !ok || !slices.Contains(question.Options, choice) {
+			return nil, errors.New("answer must be one of the options")
+		}
+		return choice, nil
+
+	case QuestionMultiChoice:
+		list, ok := raw.([]any)
+		if !ok {
+			return nil, errors.New("answer must be a list of options")
+		}
+		choices := []string{}
+		for _, item := range list {
+			choice, ok := item.(string)
+			if !ok || !slices.Contains(question.Options, choice) {
+				return nil, errors.New("every answer must be one of the options")
+			}
+			if !slices.Contains(choices, choice) {
+				choices = append(choices, choice)
+			}
+		}
+		if len(choices) == 0 {
+			return nil, nil
+		}
+		return choices, nil
+
+	case QuestionBoolean:
+		checked, ok := raw.(bool)
+		if !ok {
+			return nil, errors.New("answer must be true or false")
+		}
+		if question.Required && !checked {
+			return nil, errors.New("must be accepted")
+		}
+		return checked, nil
+
+	case QuestionNumber:
+		number, ok := raw.(float64)
+		if !ok {
+			return nil, errors.New("answer must be a number")
+		}
+		return number, nil
+	}
+
+	return nil, fmt.Errorf("unknown question kind %s", question.Kind)
+}
@@ -4,7 +4,10 @@ import (
 	"backend/models"
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -12,9 +15,9 @@ import (
 func GetUserByID(ctx context.Context, db *pgxpool.Pool, userID uint32) (*models.User, error) {
 	// query
 	getQuery := `
-		SELECT id, first_name, last_name, email, role, created_at
+		SELECT id, first_name, last_name, email, role, preferred_currency, created_at
 		FROM users
-		WHERE id = $1;
+		WHERE id = $1 AND deleted_at IS NULL;
 	`
 
 	// fetches user details
@@ -25,6 +28,7 @@ func GetUserByID(ctx context.Context, db *pgxpool.Pool, userID uint32) (*models.
 		&user.LastName,
 		&user.Email,
 		&user.Role,
+		&user.PreferredCurrency,
 		&user.CreatedAt,
 	)
 	if err != nil {
@@ -40,7 +44,7 @@ func GetUserByEmail(ctx context.Context, db *pgxpool.Pool, email string) (*model
 	getQuery := `
 		SELECT id, first_name, last_name, email, role, password_hash, created_at
 		FROM users
-		WHERE email = $1;
+		WHERE email = $1 AND deleted_at IS NULL;
 	`
 
 	// fetches from DB
@@ -65,9 +69,17 @@ func GetUserByEmail(ctx context.Context, db *pgxpool.Pool, email string) (*model
 func GetConferenceByID(ctx context.Context, db *pgxpool.Pool, conferenceID uint32) (*models.Conference, error) {
 	// query
 	getQuery := `
-		SELECT id, title, description, location, event_time, total_tickets, available_tickets, organizer_id, status, created_at
-		FROM conferences
-		WHERE id = $1;
+		SELECT c.id, c.title, c.description, c.location, c.event_time,
+			COALESCE(t.total, 0)::int, COALESCE(t.available, 0)::int,
+			c.organizer_id, c.status, c.currency, c.created_at
+		FROM conferences c
+		LEFT JOIN LATERAL (
+			SELECT SUM(tt.quota) AS total, SUM(a.available) AS available
+			FROM ticket_types tt
+			JOIN ticket_availability a ON a.ticket_type_id = tt.id
+			WHERE tt.conference_id = c.id
+		) t ON true
+		WHERE c.id = $1 AND c.deleted_at IS NULL;
 	`
 
 	// fetches conference details
@@ -82,6 +94,7 @@ func GetConferenceByID(ctx context.Context, db *pgxpool.Pool, conferenceID uint3
 		&conf.AvailableTickets,
 		&conf.OrganizerID,
 		&conf.Status,
+		&conf.Currency,
 		&conf.CreatedAt,
 	)
 	if err != nil {
@@ -92,12 +105,16 @@ func GetConferenceByID(ctx context.Context, db *pgxpool.Pool, conferenceID uint3
 }
 
 // fetchs booking details from booking id
-func GetBookingByID(ctx context.Context, db *pgxpool.Pool, bookingID uint32) (*models.Booking, error) {
+func GetBookingByID(ctx context.Context, db Querier, bookingID uint32) (*models.Booking, error) {
 	// query
 	getQuery := `
-		SELECT id, user_id, conference_id, tickets_booked, status, booked_at
+		SELECT id, user_id, conference_id, ticket_type_id, tickets_booked,
+			unit_price, total_price, currency, price_tier_id, promo_code_id, discount, refund_due, refunded_amount,
+			status, booked_at, cancelled_at, billing_name, billing_address, billing_tax_id,
+			billing_country, net_amount, tax_amount, tax_rate_bp, tax_country, tax_inclusive, reverse_charge,
+			hold_id, order_id, attendees, display_currency, exchange_rate::text, exchange_rate_at, converted_total
 		FROM bookings
-		WHERE id = $1;
+		WHERE id = $1 AND deleted_at IS NULL;
 	`
 
 	// fetchs booking details
@@ -106,9 +123,36 @@ func GetBookingByID(ctx context.Context, db *pgxpool.Pool, bookingID uint32) (*m
 		&booking.ID,
 		&booking.UserID,
 		&booking.ConferenceID,
+		&booking.TicketTypeID,
 		&booking.TicketsBooked,
+		&booking.UnitPrice,
+		&booking.TotalPrice,
+		&booking.Currency,
+		&booking.PriceTierID,
+		&booking.PromoCodeID,
+		&booking.Discount,
+		&booking.RefundDue,
+		&booking.RefundedAmount,
 		&booking.Status,
 		&booking.BookedAt,
+		&booking.CancelledAt,
+		&booking.BillingName,
+		&booking.BillingAddress,
+		&booking.BillingTaxID,
+		&booking.BillingCountry,
+		&booking.NetAmount,
+		&booking.TaxAmount,
+		&booking.TaxRateBP,
+		&booking.TaxCountry,
+		&booking.TaxInclusive,
+		&booking.ReverseCharge,
+		&booking.HoldID,
+		&booking.OrderID,
+		&booking.Attendees,
+		&booking.DisplayCurrency,
+		&booking.ExchangeRate,
+		&booking.ExchangeRateAt,
+		&booking.ConvertedTotal,
 	)
 	if err != nil {
 		return nil, err
@@ -118,12 +162,19 @@ func GetBookingByID(ctx context.Context, db *pgxpool.Pool, bookingID uint32) (*m
 }
 
 // fetches array of tickets from booking id
+// tickets transferred to someone else keep their code and attendee details hidden from the buyer
 func GetTicketsByBookingID(ctx context.Context, db *pgxpool.Pool, bookingID uint32) ([]models.Ticket, error) {
 	// query
 	getQuery := `
-	SELECT id, booking_id, ticket_code, issued_at
-	FROM tickets
-	WHERE booking_id = $1;
+	SELECT t.id, t.booking_id, CASE WHEN own THEN t.ticket_code ELSE '' END, t.status,
+		CASE WHEN own THEN t.attendee_name END, CASE WHEN own THEN t.attendee_email END,
+		t.assigned_at, CASE WHEN own THEN t.answers ELSE '{}'::jsonb END, t.holder_id, t.transferred_from,
+		CASE WHEN own THEN t.access_token ELSE '' END,
+		t.issued_at, t.voided_at
+	FROM tickets t
+	JOIN bookings b ON b.id = t.booking_id
+	CROSS JOIN LATERAL (SELECT COALESCE(t.holder_id, b.user_id) = b.user_id AS own) h
+	WHERE t.booking_id = $1 AND b.deleted_at IS NULL;
 	`
 
 	// fetch number of rows
@@ -137,7 +188,21 @@ func GetTicketsByBookingID(ctx context.Context, db *pgxpool.Pool, bookingID uint
 	tickets := []models.Ticket{}
 	for rows.Next() {
 		var ticket models.Ticket
-		err := rows.Scan(&ticket.ID, &ticket.BookingID, &ticket.TicketCode, &ticket.IssuedAt)
+		err := rows.Scan(
+			&ticket.ID,
+			&ticket.BookingID,
+			&ticket.TicketCode,
+			&ticket.Status,
+			&ticket.AttendeeName,
+			&ticket.AttendeeEmail,
+			&ticket.AssignedAt,
+			&ticket.Answers,
+			&ticket.HolderID,
+			&ticket.TransferredFrom,
+			&ticket.AccessToken,
+			&ticket.IssuedAt,
+			&ticket.VoidedAt,
+		)
 		if err != nil {
 			return nil, err
 		}
@@ -147,6 +212,190 @@ func GetTicketsByBookingID(ctx context.Context, db *pgxpool.Pool, bookingID uint
 	return tickets, nil
 }
 
+// listing filters of customer bookings and tickets
+const (
+	ListAll       = ""
+	ListUpcoming  = "upcoming"
+	ListPast      = "past"
+	ListCancelled = "cancelled"
+)
+
+// ErrInvalidListing is returned when a listing filter or page is out of bounds
+var ErrInvalidListing = errors.New("invalid listing")
+
+// checks listing filter and page bounds, the limit defaults to 20
+func validateListing(filter string, limit, offset int) (int, error) {
+	switch filter {
+	case ListAll, ListUpcoming, ListPast, ListCancelled:
+	default:
+		return 0, fmt.Errorf("%w: filter must be upcoming, past or cancelled", ErrInvalidListing)
+	}
+
+	if limit == 0 {
+		limit = 20
+	}
+	if limit < 0 || limit > 100 {
+		return 0, fmt.Errorf("%w: limit must be between 1 and 100", ErrInvalidListing)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("%w: offset cannot be negative", ErrInvalidListing)
+	}
+
+	return limit, nil
+}
+
+// fetches a page of a customer's bookings with their conference, and how many match in total
+// upcoming ones come soonest first, the others latest event first
+func GetBookingsByUserID(ctx context.Context, db *pgxpool.Pool, userID uint32, filter string, limit, offset int) ([]models.BookingListItem, int, error) {
+	limit, err := validateListing(filter, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// queries, the page and the total share their filter
+	fromQuery := `
+		FROM bookings b
+		JOIN conferences c ON c.id = b.conference_id
+		JOIN ticket_types t ON t.id = b.ticket_type_id
+		WHERE b.user_id = $1 AND b.deleted_at IS NULL
+			AND CASE $2::text
+				WHEN 'upcoming' THEN b.status IN ('pending_payment', 'paid') AND c.status <> 'cancelled' AND c.event_time > $3
+				WHEN 'past' THEN b.status IN ('pending_payment', 'paid') AND c.status <> 'cancelled' AND c.event_time <= $3
+				WHEN 'cancelled' THEN b.status IN ('cancelled', 'refunded', 'failed') OR c.status = 'cancelled'
+				ELSE true
+			END
+	`
+	getQuery := `
+		SELECT b.id, b.ticket_type_id, t.name, b.tickets_booked, b.total_price, b.currency,
+			b.status, b.order_id, b.booked_at, b.cancelled_at,
+			c.id, c.title, c.location, c.event_time, c.status
+	` + fromQuery + `
+		ORDER BY CASE WHEN $2::text = 'upcoming' THEN c.event_time END, c.event_time DESC, b.id DESC
+		LIMIT $4 OFFSET $5;
+	`
+	countQuery := `SELECT COUNT(*)` + fromQuery + `;`
+
+	// counted apart so a page past the end still reports the total
+	now := time.Now()
+	var total int
+	if err := db.QueryRow(ctx, countQuery, userID, filter, now).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(ctx, getQuery, userID, filter, now, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	bookings := []models.BookingListItem{}
+	for rows.Next() {
+		var booking models.BookingListItem
+		err := rows.Scan(
+			&booking.ID,
+			&booking.TicketTypeID,
+			&booking.TicketType,
+			&booking.TicketsBooked,
+			&booking.TotalPrice,
+			&booking.Currency,
+			&booking.Status,
+			&booking.OrderID,
+			&booking.BookedAt,
+			&booking.CancelledAt,
+			&booking.Conference.ID,
+			&booking.Conference.Title,
+			&booking.Conference.Location,
+			&booking.Conference.EventTime,
+			&booking.Conference.Status,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		bookings = append(bookings, booking)
+	}
+
+	return bookings, total, rows.Err()
+}
+
+// fetches a page of the tickets a customer holds, bought or received by transfer, with their conference
+// void tickets and tickets of cancelled conferences are listed as cancelled only
+func GetTicketsByUserID(ctx context.Context, db *pgxpool.Pool, userID uint32, filter string, limit, offset int) ([]models.TicketListItem, int, error) {
+	limit, err := validateListing(filter, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// queries, the page and the total share their filter
+	fromQuery := `
+		FROM tickets t
+		JOIN bookings b ON b.id = t.booking_id
+		JOIN conferences c ON c.id = b.conference_id
+		JOIN ticket_types tt ON tt.id = b.ticket_type_id
+		WHERE COALESCE(t.holder_id, b.user_id) = $1 AND b.deleted_at IS NULL
+			AND CASE $2::text
+				WHEN 'upcoming' THEN t.status = 'active' AND c.status <> 'cancelled' AND c.event_time > $3
+				WHEN 'past' THEN t.status = 'active' AND c.status <> 'cancelled' AND c.event_time <= $3
+				WHEN 'cancelled' THEN t.status = 'void' OR c.status = 'cancelled'
+				ELSE true
+			END
+	`
+	getQuery := `
+		SELECT t.id, t.booking_id, t.ticket_code, t.status, t.attendee_name, t.attendee_email,
+			t.assigned_at, t.answers, t.holder_id, t.transferred_from, t.access_token,
+			t.issued_at, t.voided_at, tt.name,
+			c.id, c.title, c.location, c.event_time, c.status
+	` + fromQuery + `
+		ORDER BY CASE WHEN $2::text = 'upcoming' THEN c.event_time END, c.event_time DESC, t.id DESC
+		LIMIT $4 OFFSET $5;
+	`
+	countQuery := `SELECT COUNT(*)` + fromQuery + `;`
+
+	// counted apart so a page past the end still reports the total
+	now := time.Now()
+	var total int
+	if err := db.QueryRow(ctx, countQuery, userID, filter, now).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(ctx, getQuery, userID, filter, now, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	tickets := []models.TicketListItem{}
+	for rows.Next() {
+		var ticket models.TicketListItem
+		err := rows.Scan(
+			&ticket.ID,
+			&ticket.BookingID,
+			&ticket.TicketCode,
+			&ticket.Status,
+			&ticket.AttendeeName,
+			&ticket.AttendeeEmail,
+			&ticket.AssignedAt,
+			&ticket.Answers,
+			&ticket.HolderID,
+			&ticket.TransferredFrom,
+			&ticket.AccessToken,
+			&ticket.IssuedAt,
+			&ticket.VoidedAt,
+			&ticket.TicketType,
+			&ticket.Conference.ID,
+			&ticket.Conference.Title,
+			&ticket.Conference.Location,
+			&ticket.Conference.EventTime,
+			&ticket.Conference.Status,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	return tickets, total, rows.Err()
+}
+
 // fetches upcoming conferences
 func GetUpcomingConferences(ctx context.Context, db *pgxpool.Pool, days int) ([]models.Conference, error) {
 	// time validate
@@ -156,9 +405,18 @@ func GetUpcomingConferences(ctx context.Context, db *pgxpool.Pool, days int) ([]
 
 	// get query
 	getQuery := `
-		SELECT id, title, description, location, event_time, total_tickets, available_tickets, organizer_id, status
-		FROM conferences
-		WHERE event_time BETWEEN NOW() AND NOW() + ($1 * INTERVAL '1 day');
+		SELECT c.id, c.title, c.description, c.location, c.event_time,
+			COALESCE(t.total, 0)::int, COALESCE(t.available, 0)::int,
+			c.organizer_id, c.status, c.currency
+		FROM conferences c
+		LEFT JOIN LATERAL (
+			SELECT SUM(tt.quota) AS total, SUM(a.available) AS available
+			FROM ticket_types tt
+			JOIN ticket_availability a ON a.ticket_type_id = tt.id
+			WHERE tt.conference_id = c.id
+		) t ON true
+		WHERE c.event_time BETWEEN NOW() AND NOW() + ($1 * INTERVAL '1 day')
+			AND c.deleted_at IS NULL;
 	`
 
 	// fetches available conferences
@@ -181,6 +439,7 @@ func GetUpcomingConferences(ctx context.Context, db *pgxpool.Pool, days int) ([]
 			&conference.AvailableTickets,
 			&conference.OrganizerID,
 			&conference.Status,
+			&conference.Currency,
 		)
 		if err != nil {
 			return nil, err
@@ -190,3 +449,81 @@ func GetUpcomingConferences(ctx context.Context, db *pgxpool.Pool, days int) ([]
 
 	return conferences, nil
 }
+
+// fetches ids of ongoing conferences whose event time has passed
+func GetPastOngoingConferenceIDs(ctx context.Context, db *pgxpool.Pool) ([]uint32, error) {
+	// query
+	getQuery := `
+		SELECT id FROM conferences
+		WHERE status = 'ongoing' AND event_time <= NOW() AND deleted_at IS NULL
+		ORDER BY event_time;
+	`
+
+	rows, err := db.Query(ctx, getQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conferenceIDs := []uint32{}
+	for rows.Next() {
+		var conferenceID uint32
+		if err := rows.Scan(&conferenceID); err != nil {
+			return nil, err
+		}
+		conferenceIDs = append(conferenceIDs, conferenceID)
+	}
+
+	return conferenceIDs, rows.Err()
+}
+
+// fetches latest scheduled job runs across all replicas
+func GetRecentJobRuns(ctx context.Context, db *pgxpool.Pool, limit int) ([]models.JobRun, error) {
+	// limit validate
+	if limit <= 0 || limit > 500 {
+		return nil, errors.New("invalid limit: must be between 1 and 500")
+	}
+
+	// query
+	getQuery := `
+		SELECT id, job_name, instance, started_at, finished_at, error
+		FROM job_runs
+		ORDER BY started_at DESC
+		LIMIT $1;
+	`
+
+	rows, err := db.Query(ctx, getQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.JobRun{}
+	for rows.Next() {
+		var run models.JobRun
+		err := rows.Scan(&run.ID, &run.JobName, &run.Instance, &run.StartedAt, &run.FinishedAt, &run.Error)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// paid bookings holding fewer tickets than they booked => ticket recovery job
+func GetBookingsMissingTickets(ctx context.Context, db Querier) ([]uint32, error) {
+	getQuery := `
+		SELECT b.id FROM bookings b
+		WHERE b.status = 'paid' AND b.deleted_at IS NULL
+			AND b.tickets_booked > (SELECT COUNT(*) FROM tickets t WHERE t.booking_id = b.id AND t.status = 'active')
+		ORDER BY b.id;
+	`
+
+	rows, err := db.Query(ctx, getQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[uint32])
+}
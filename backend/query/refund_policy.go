@@ -0,0 +1,250 @@
+package query
+
+import (
+	"backend/models"
+	"backend/pricing"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// only performed by organizer
+// replaces every rule of the conference, an empty list restores the default full refund
+func SetRefundPolicy(ctx context.Context, db *pgxpool.Pool, conferenceID, organizerID uint32, rules []models.RefundRule) error {
+	// queries
+	getQuery := `
+		SELECT organizer_id FROM conferences
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE;
+	`
+	deleteQuery := `
+		DELETE FROM refund_policy_rules WHERE conference_id = $1;
+	`
+	insertQuery := `
+		INSERT INTO refund_policy_rules (conference_id, hours_before, refund_percent)
+		VALUES ($1, $2, $3);
+	`
+
+	// validate input
+	seen := make(map[uint32]bool, len(rules))
+	for _, rule := range rules {
+		if rule.RefundPercent > 100 {
+			return errors.New("refund percent must be between 0 and 100")
+		}
+		if seen[rule.HoursBefore] {
+			return errors.New("only one rule per hours before the event")
+		}
+		seen[rule.HoursBefore] = true
+	}
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// validate organizer
+	var existingOrganizerID uint32
+	err = tx.QueryRow(ctx, getQuery, conferenceID).Scan(&existingOrganizerID)
+	if err != nil {
+		return errors.New("conference not found")
+	}
+
+	if existingOrganizerID != organizerID {
+		return errors.New("unauthorized: you are not the correct organizer")
+	}
+
+	// replace rules
+	_, err = tx.Exec(ctx, deleteQuery, conferenceID)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		_, err = tx.Exec(ctx, insertQuery, conferenceID, rule.HoursBefore, rule.RefundPercent)
+		if err != nil {
+			return err
+		}
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
+
+// fetches refund rules of a conference, furthest from the event first
+func GetRefundPolicy(ctx context.Context, db *pgxpool.Pool, conferenceID uint32) ([]models.RefundRule, error) {
+	rows, err := db.Query(ctx, refundPolicyQuery, conferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.RefundRule])
+}
+
+const refundPolicyQuery = `
+	SELECT id, conference_id, hours_before, refund_percent
+	FROM refund_policy_rules
+	WHERE conference_id = $1
+	ORDER BY hours_before DESC;
+`
+
+// performed by customer
+// an unpaid booking is released, a paid one has its tickets voided and
+// the refund owed under the conference policy is queued with the payments layer
+func CancelBooking(ctx context.Context, db *pgxpool.Pool, bookingID, userID uint32) (*models.Booking, error) {
+	// query
+	getQuery := `
+		SELECT user_id FROM bookings
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var bookingUserID uint32
+	err = tx.QueryRow(ctx, getQuery, bookingID).Scan(&bookingUserID)
+	if err != nil {
+		return nil, errors.New("booking not found")
+	}
+
+	if bookingUserID != userID {
+		return nil, errors.New("unauthorised: not your booking")
+	}
+
+	if err := cancelBookingTx(ctx, tx, bookingID, "cancelled by customer", time.Now()); err != nil {
+		return nil, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetBookingByID(ctx, db, bookingID)
+}
+
+// cancels a locked booking inside a transaction under its conference refund policy
+func cancelBookingTx(ctx context.Context, tx pgx.Tx, bookingID uint32, reason string, now time.Time) error {
+	// queries
+	getQuery := `
+		SELECT b.conference_id, b.status, b.total_price - b.refunded_amount, c.event_time
+		FROM bookings b
+		JOIN conferences c ON c.id = b.conference_id
+		WHERE b.id = $1;
+	`
+	updateQuery := `
+		UPDATE bookings
+		SET status = 'cancelled', refund_due = $1, cancelled_at = $2
+		WHERE id = $3;
+	`
+	voidQuery := `
+		UPDATE tickets SET status = 'void', voided_at = $1
+		WHERE booking_id = $2 AND status = 'active';
+	`
+	inventoryQuery := `
+		UPDATE ticket_types t SET available = t.available + b.tickets_booked
+		FROM bookings b
+		WHERE b.id = $1 AND t.id = b.ticket_type_id;
+	`
+	paymentQuery := `
+		SELECT id FROM payments
+		WHERE (booking_id = $1 OR order_id = (SELECT order_id FROM bookings WHERE id = $1)) AND status = 'succeeded'
+		ORDER BY id DESC
+		LIMIT 1;
+	`
+	transferredQuery := `
+		SELECT EXISTS (
+			SELECT 1 FROM tickets t
+			JOIN bookings b ON b.id = t.booking_id
+			WHERE t.booking_id = $1 AND t.status = 'active' AND t.holder_id <> b.user_id
+		);
+	`
+
+	var conferenceID uint32
+	var status string
+	var held int64
+	var eventTime time.Time
+	err := tx.QueryRow(ctx, getQuery, bookingID).Scan(&conferenceID, &status, &held, &eventTime)
+	if err != nil {
+		return errors.New("booking not found")
+	}
+
+	switch status {
+	case BookingPendingPayment:
+		released, err := releasePendingBooking(ctx, tx, bookingID, BookingCancelled)
+		if err != nil {
+			return err
+		}
+		if released {
+			_, err = tx.Exec(ctx, updateQuery, 0, now, bookingID)
+		}
+		return err
+	case BookingPaid:
+	default:
+		return errors.New("only pending or paid bookings can be cancelled")
+	}
+
+	// tickets given away belong to their new holders, the buyer cannot void them for a refund
+	var transferred bool
+	if err := tx.QueryRow(ctx, transferredQuery, bookingID).Scan(&transferred); err != nil {
+		return err
+	}
+	if transferred {
+		return errors.New("booking has tickets transferred to other attendees and cannot be cancelled")
+	}
+
+	// refund owed under the policy
+	rows, err := tx.Query(ctx, refundPolicyQuery, conferenceID)
+	if err != nil {
+		return err
+	}
+	rules, err := pgx.CollectRows(rows, pgx.RowToStructByPos[models.RefundRule])
+	if err != nil {
+		return err
+	}
+
+	percent, ok := pricing.RefundPercent(rules, eventTime, now)
+	if !ok {
+		return errors.New("bookings cannot be cancelled after the event has started")
+	}
+	refund := pricing.Refund(percent, held)
+
+	// cancel and void tickets
+	_, err = tx.Exec(ctx, updateQuery, refund, now, bookingID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, voidQuery, now, bookingID)
+	if err != nil {
+		return err
+	}
+
+	// seats go back on sale
+	_, err = tx.Exec(ctx, inventoryQuery, bookingID)
+	if err != nil {
+		return err
+	}
+
+	// free bookings have no payment to refund
+	var paymentID uint32
+	err = tx.QueryRow(ctx, paymentQuery, bookingID).Scan(&paymentID)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return queueRefund(ctx, tx, bookingID, paymentID, refund, reason)
+}
@@ -0,0 +1,229 @@
+package query
+
+import (
+	"backend/models"
+	"backend/tax"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// fetches countries with their tax id format => admin
+func GetTaxCountries(ctx context.Context, db *pgxpool.Pool) ([]models.TaxCountry, error) {
+	getQuery := `
+		SELECT code, name, vat_area, vat_id_pattern
+		FROM tax_countries
+		ORDER BY code;
+	`
+
+	rows, err := db.Query(ctx, getQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.TaxCountry])
+}
+
+// fetches tax rates, all countries when country is empty => admin
+func GetTaxRates(ctx context.Context, db *pgxpool.Pool, country string) ([]models.TaxRate, error) {
+	getQuery := `
+		SELECT id, country, category, rate_bp, valid_from, valid_until
+		FROM tax_rates
+		WHERE $1 = '' OR country = $1
+		ORDER BY country, category, valid_from;
+	`
+
+	rows, err := db.Query(ctx, getQuery, strings.ToUpper(strings.TrimSpace(country)))
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.TaxRate])
+}
+
+// creates or replaces a country and its tax id format => admin
+func SaveTaxCountry(ctx context.Context, db *pgxpool.Pool, country *models.TaxCountry) error {
+	upsertQuery := `
+		INSERT INTO tax_countries (code, name, vat_area, vat_id_pattern)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (code) DO UPDATE
+		SET name = EXCLUDED.name,
+			vat_area = EXCLUDED.vat_area,
+			vat_id_pattern = EXCLUDED.vat_id_pattern;
+	`
+
+	// validate input
+	country.Code = strings.ToUpper(strings.TrimSpace(country.Code))
+	country.Name = strings.TrimSpace(country.Name)
+	country.VATArea = strings.ToUpper(strings.TrimSpace(country.VATArea))
+
+	if !countryPattern.MatchString(country.Code) {
+		return errors.New("country must be a 2 letter ISO code")
+	}
+
+	if country.Name == "" {
+		return errors.New("country name cannot be empty")
+	}
+
+	if _, err := regexp.Compile(country.VATIDPattern); err != nil {
+		return errors.New("invalid tax id pattern")
+	}
+
+	_, err := db.Exec(ctx, upsertQuery, country.Code, country.Name, country.VATArea, country.VATIDPattern)
+	return err
+}
+
+// adds a rate from a date, closing the open rate of the same country and category => admin
+// past bookings keep the rate they were charged
+func SaveTaxRate(ctx context.Context, db *pgxpool.Pool, rate *models.TaxRate) (uint32, error) {
+	// queries
+	closeQuery := `
+		UPDATE tax_rates SET valid_until = $3
+		WHERE country = $1 AND category = $2 AND valid_until IS NULL AND valid_from < $3;
+	`
+	insertQuery := `
+		INSERT INTO tax_rates (country, category, rate_bp, valid_from, valid_until)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id;
+	`
+
+	// validate input
+	rate.Country = strings.ToUpper(strings.TrimSpace(rate.Country))
+	rate.Category = strings.ToLower(strings.TrimSpace(rate.Category))
+	if rate.Category == "" {
+		rate.Category = "standard"
+	}
+
+	if rate.RateBP > 10000 {
+		return 0, errors.New("rate cannot exceed 10000 basis points")
+	}
+
+	if rate.ValidFrom.IsZero() {
+		return 0, errors.New("valid from is required")
+	}
+
+	if rate.ValidUntil != nil && !rate.ValidUntil.After(rate.ValidFrom) {
+		return 0, errors.New("valid until must be after valid from")
+	}
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if rate.ValidUntil == nil {
+		_, err = tx.Exec(ctx, closeQuery, rate.Country, rate.Category, rate.ValidFrom)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var rateID uint32
+	err = tx.QueryRow(ctx, insertQuery,
+		rate.Country,
+		rate.Category,
+		rate.RateBP,
+		rate.ValidFrom,
+		rate.ValidUntil,
+	).Scan(&rateID)
+	if err != nil {
+		return 0, errors.New("unknown country or a rate already starts on that date")
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return rateID, nil
+}
+
+// tax on an order of an organizer's conference inside the booking transaction
+// buyers without a billing country are taxed as if they were in the organizer's country
+func calculateBookingTax(
+	ctx context.Context,
+	tx pgx.Tx,
+	organizerID uint32,
+	billingCountry, vatID string,
+	amount int64,
+	now time.Time,
+) (tax.Breakdown, error) {
+	settingsQuery := `
+		SELECT COALESCE(tax_country, ''), charges_tax, prices_include_tax, tax_category
+		FROM organizer_profiles
+		WHERE organizer_id = $1;
+	`
+
+	var settings tax.Settings
+	var category string
+	err := tx.QueryRow(ctx, settingsQuery, organizerID).Scan(
+		&settings.Country,
+		&settings.ChargesTax,
+		&settings.PricesIncludeTax,
+		&category,
+	)
+	if err != nil && err != pgx.ErrNoRows {
+		return tax.Breakdown{}, err
+	}
+
+	if billingCountry == "" {
+		billingCountry = settings.Country
+	}
+
+	// organizers without a profile or registration charge no tax
+	if settings.Country == "" {
+		return tax.Calculate(amount, settings, tax.Jurisdiction{}, tax.Jurisdiction{Country: billingCountry}, "")
+	}
+
+	seller, err := getJurisdictionTx(ctx, tx, settings.Country, category, now)
+	if err != nil {
+		return tax.Breakdown{}, err
+	}
+
+	buyer, err := getJurisdictionTx(ctx, tx, billingCountry, category, now)
+	if err != nil {
+		return tax.Breakdown{}, err
+	}
+
+	return tax.Calculate(amount, settings, seller, buyer, vatID)
+}
+
+// loads a country and its rate on the given day from the rate tables
+// countries without a rate are outside the tax scope and charged 0
+func getJurisdictionTx(ctx context.Context, tx pgx.Tx, country, category string, at time.Time) (tax.Jurisdiction, error) {
+	getQuery := `
+		SELECT tc.code, tc.vat_area, tc.vat_id_pattern, COALESCE(r.rate_bp, 0)
+		FROM tax_countries tc
+		LEFT JOIN LATERAL (
+			SELECT rate_bp FROM tax_rates
+			WHERE country = tc.code AND category = $2
+				AND valid_from <= $3::date AND (valid_until IS NULL OR valid_until > $3::date)
+			ORDER BY valid_from DESC
+			LIMIT 1
+		) r ON true
+		WHERE tc.code = $1;
+	`
+
+	j := tax.Jurisdiction{Country: country}
+	err := tx.QueryRow(ctx, getQuery, country, category, at).Scan(
+		&j.Country,
+		&j.VATArea,
+		&j.VATIDPattern,
+		&j.RateBP,
+	)
+	if err == pgx.ErrNoRows {
+		return j, nil
+	}
+
+	return j, err
+}
@@ -0,0 +1,214 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// queues the email an attendee gets for a named ticket, $1 ticket id, $2 public url of the api
+const ticketEmailQuery = `
+	INSERT INTO notifications (user_id, email, subject, body)
+	SELECT NULL, t.attendee_email, 'Your ticket: ' || c.title,
+		format(E'Hi %s,\n\nyou have a ticket for %s on %s at %s.\n\nTicket code: %s\nView it online: %s/ticket/view/%s',
+			t.attendee_name, c.title, to_char(c.event_time, 'YYYY-MM-DD HH24:MI TZ'), c.location,
+			t.ticket_code, $2::text, t.access_token)
+	FROM tickets t
+	JOIN bookings b ON b.id = t.booking_id
+	JOIN conferences c ON c.id = b.conference_id
+	WHERE t.id = $1 AND t.attendee_email IS NOT NULL;
+`
+
+// base url ticket links in emails point to
+func publicURL() string {
+	if url := os.Getenv("PUBLIC_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:8080"
+}
+
+// trims an attendee and checks both name and a valid email are given
+func validateAttendee(attendee *models.Attendee) error {
+	attendee.Name = strings.TrimSpace(attendee.Name)
+	attendee.Email = strings.ToLower(strings.TrimSpace(attendee.Email))
+
+	if attendee.Name == "" {
+		return errors.New("attendee name is required")
+	}
+
+	address, err := mail.ParseAddress(attendee.Email)
+	if err != nil || address.Address != attendee.Email {
+		return errors.New("attendee email is invalid")
+	}
+
+	return nil
+}
+
+// performed by customer
+// names the attendee of an active ticket with their registration answers, or clears it when name and email are empty
+// the access link changes with every assignment so a previous attendee loses access
+func AssignTicket(ctx context.Context, db *pgxpool.Pool, ticketID, userID uint32, attendee models.Attendee) (*models.Ticket, error) {
+	// queries
+	getQuery := `
+		SELECT COALESCE(t.holder_id, b.user_id), t.status, b.conference_id, b.ticket_type_id
+		FROM tickets t
+		JOIN bookings b ON b.id = t.booking_id
+		WHERE t.id = $1 AND b.deleted_at IS NULL
+		FOR UPDATE OF t;
+	`
+	updateQuery := `
+		UPDATE tickets
+		SET attendee_name = NULLIF($1, ''), attendee_email = NULLIF($2, ''),
+			assigned_at = CASE WHEN $1 = '' THEN NULL ELSE $3::timestamptz END,
+			answers = $4, access_token = replace(gen_random_uuid()::text, '-', '')
+		WHERE id = $5
+		RETURNING id, booking_id, ticket_code, status, attendee_name, attendee_email,
+			assigned_at, answers, holder_id, transferred_from, access_token, issued_at, voided_at;
+	`
+
+	clearing := strings.TrimSpace(attendee.Name) == "" && strings.TrimSpace(attendee.Email) == ""
+	if clearing {
+		attendee = models.Attendee{}
+	} else if err := validateAttendee(&attendee); err != nil {
+		return nil, err
+	}
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var ownerID, conferenceID, ticketTypeID uint32
+	var status string
+	err = tx.QueryRow(ctx, getQuery, ticketID).Scan(&ownerID, &status, &conferenceID, &ticketTypeID)
+	if err != nil || ownerID != userID {
+		return nil, errors.New("ticket not found")
+	}
+
+	if status != "active" {
+		return nil, errors.New("only active tickets can be assigned")
+	}
+
+	attendee.Answers = map[uint32]any{}
+	if !clearing {
+		attendee.Answers, err = validateAnswers(ctx, tx, conferenceID, ticketTypeID, attendee.Answers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ticket models.Ticket
+	err = tx.QueryRow(ctx, updateQuery, attendee.Name, attendee.Email, time.Now(), attendee.Answers, ticketID).Scan(
+		&ticket.ID,
+		&ticket.BookingID,
+		&ticket.TicketCode,
+		&ticket.Status,
+		&ticket.AttendeeName,
+		&ticket.AttendeeEmail,
+		&ticket.AssignedAt,
+		&ticket.Answers,
+		&ticket.HolderID,
+		&ticket.TransferredFrom,
+		&ticket.AccessToken,
+		&ticket.IssuedAt,
+		&ticket.VoidedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !clearing {
+		if _, err := tx.Exec(ctx, ticketEmailQuery, ticketID, publicURL()); err != nil {
+			return nil, err
+		}
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
+
+// public => the ticket behind an access link, for attendees without an account
+func GetTicketByAccessToken(ctx context.Context, db *pgxpool.Pool, token string) (*models.TicketView, error) {
+	getQuery := `
+		SELECT t.ticket_code, t.status, t.attendee_name, c.title, c.location, c.event_time, tt.name
+		FROM tickets t
+		JOIN bookings b ON b.id = t.booking_id
+		JOIN conferences c ON c.id = b.conference_id
+		JOIN ticket_types tt ON tt.id = b.ticket_type_id
+		WHERE t.access_token = $1 AND b.deleted_at IS NULL;
+	`
+
+	var view models.TicketView
+	err := db.QueryRow(ctx, getQuery, token).Scan(
+		&view.TicketCode,
+		&view.Status,
+		&view.AttendeeName,
+		&view.Conference,
+		&view.Location,
+		&view.EventTime,
+		&view.TicketType,
+	)
+	if err != nil {
+		return nil, errors.New("ticket not found")
+	}
+
+	return &view, nil
+}
+
+// only performed by organizer
+// every active ticket of the conference with its attendee and the buyer behind it
+func GetConferenceAttendees(ctx context.Context, db *pgxpool.Pool, conferenceID, organizerID uint32) ([]models.ConferenceAttendee, error) {
+	getQuery := `
+		SELECT t.id, t.ticket_code, tt.name, t.attendee_name, t.attendee_email, t.assigned_at, t.answers,
+			b.id, u.first_name || ' ' || u.last_name, u.email
+		FROM tickets t
+		JOIN bookings b ON b.id = t.booking_id
+		JOIN conferences c ON c.id = b.conference_id
+		JOIN ticket_types tt ON tt.id = b.ticket_type_id
+		JOIN users u ON u.id = b.user_id
+		WHERE c.id = $1 AND c.organizer_id = $2 AND t.status = 'active' AND b.deleted_at IS NULL
+		ORDER BY t.attendee_name NULLS LAST, t.id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, conferenceID, organizerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendees := []models.ConferenceAttendee{}
+	for rows.Next() {
+		var attendee models.ConferenceAttendee
+		err := rows.Scan(
+			&attendee.TicketID,
+			&attendee.TicketCode,
+			&attendee.TicketType,
+			&attendee.AttendeeName,
+			&attendee.AttendeeEmail,
+			&attendee.AssignedAt,
+			&attendee.Answers,
+			&attendee.BookingID,
+			&attendee.BuyerName,
+			&attendee.BuyerEmail,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attendees = append(attendees, attendee)
+	}
+
+	return attendees, rows.Err()
+}
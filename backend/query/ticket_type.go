@@ -0,0 +1,275 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// normalises and validates a ticket type before insert or update
+// ticket types are priced in the currency of their conference
+func validateTicketType(ticketType *models.TicketType, currency string) error {
+	ticketType.Name = strings.TrimSpace(ticketType.Name)
+	ticketType.Currency = strings.ToUpper(strings.TrimSpace(ticketType.Currency))
+	if ticketType.Currency == "" {
+		ticketType.Currency = currency
+	}
+	if ticketType.MinPerOrder == 0 {
+		ticketType.MinPerOrder = 1
+	}
+
+	if ticketType.Name == "" {
+		return errors.New("ticket type name cannot be empty")
+	}
+
+	if ticketType.Price < 0 {
+		return errors.New("price cannot be negative")
+	}
+
+	if ticketType.Currency != currency {
+		return errors.New("ticket type currency must match the conference currency " + currency)
+	}
+
+	if ticketType.Quota == 0 {
+		return errors.New("quota should be greater than 0")
+	}
+
+	if ticketType.MaxPerOrder != nil && *ticketType.MaxPerOrder < ticketType.MinPerOrder {
+		return errors.New("max per order cannot be lower than min per order")
+	}
+
+	if ticketType.SalesStart != nil && ticketType.SalesEnd != nil && !ticketType.SalesEnd.After(*ticketType.SalesStart) {
+		return errors.New("sales end must be after sales start")
+	}
+
+	return nil
+}
+
+// inserts a validated ticket type inside a transaction, the full quota is available
+func insertTicketType(ctx context.Context, tx pgx.Tx, ticketType *models.TicketType, currency string) (uint32, error) {
+	insertQuery := `
+		INSERT INTO ticket_types (
+			conference_id, name, price, currency, quota, available,
+			sales_start, sales_end, min_per_order, max_per_order, hidden
+		)
+		VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $8, $9, $10)
+		RETURNING id;
+	`
+
+	if err := validateTicketType(ticketType, currency); err != nil {
+		return 0, err
+	}
+
+	var ticketTypeID uint32
+	err := tx.QueryRow(ctx, insertQuery,
+		ticketType.ConferenceID,
+		ticketType.Name,
+		ticketType.Price,
+		ticketType.Currency,
+		ticketType.Quota,
+		ticketType.SalesStart,
+		ticketType.SalesEnd,
+		ticketType.MinPerOrder,
+		ticketType.MaxPerOrder,
+		ticketType.Hidden,
+	).Scan(&ticketTypeID)
+
+	return ticketTypeID, err
+}
+
+// only performed by organizer
+func CreateTicketType(ctx context.Context, db *pgxpool.Pool, ticketType *models.TicketType, organizerID uint32) (uint32, error) {
+	// query
+	getQuery := `
+		SELECT organizer_id, currency FROM conferences
+		WHERE id = $1 AND deleted_at IS NULL;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// validate organizer
+	var existingOrganizerID uint32
+	var currency string
+	err = tx.QueryRow(ctx, getQuery, ticketType.ConferenceID).Scan(&existingOrganizerID, &currency)
+	if err != nil {
+		return 0, errors.New("conference not found")
+	}
+
+	if existingOrganizerID != organizerID {
+		return 0, errors.New("unauthorized: you are not the correct organizer")
+	}
+
+	ticketTypeID, err := insertTicketType(ctx, tx, ticketType, currency)
+	if err != nil {
+		return 0, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return ticketTypeID, nil
+}
+
+// fetches ticket types of a conference, hidden types only when asked => organizer
+func GetTicketTypesByConferenceID(ctx context.Context, db *pgxpool.Pool, conferenceID uint32, includeHidden bool) ([]models.TicketType, error) {
+	// query
+	getQuery := `
+		SELECT t.id, t.conference_id, t.name, t.price, t.currency, t.quota, a.available, a.held,
+			t.sales_start, t.sales_end, t.min_per_order, t.max_per_order, t.hidden, t.created_at
+		FROM ticket_types t
+		JOIN ticket_availability a ON a.ticket_type_id = t.id
+		WHERE t.conference_id = $1 AND (NOT t.hidden OR $2)
+		ORDER BY t.price, t.id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, conferenceID, includeHidden)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanTicketTypes(rows)
+}
+
+// fetches hidden ticket types a currently valid promo code unlocks
+func GetTicketTypesUnlockedByCode(ctx context.Context, db *pgxpool.Pool, conferenceID uint32, code string) ([]models.TicketType, error) {
+	// query
+	getQuery := `
+		SELECT t.id, t.conference_id, t.name, t.price, t.currency, t.quota, a.available, a.held,
+			t.sales_start, t.sales_end, t.min_per_order, t.max_per_order, t.hidden, t.created_at
+		FROM promo_codes p
+		JOIN promo_code_ticket_types pt ON pt.promo_code_id = p.id
+		JOIN ticket_types t ON t.id = pt.ticket_type_id
+		JOIN ticket_availability a ON a.ticket_type_id = t.id
+		WHERE p.conference_id = $1 AND p.code = upper($2) AND t.hidden
+			AND (p.valid_from IS NULL OR p.valid_from <= NOW())
+			AND (p.valid_until IS NULL OR p.valid_until > NOW())
+			AND (p.max_uses IS NULL OR p.uses < p.max_uses)
+		ORDER BY t.price, t.id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, conferenceID, strings.TrimSpace(code))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanTicketTypes(rows)
+}
+
+// creates array of ticket types from rows
+func scanTicketTypes(rows pgx.Rows) ([]models.TicketType, error) {
+	defer rows.Close()
+
+	ticketTypes := []models.TicketType{}
+	for rows.Next() {
+		var ticketType models.TicketType
+		err := rows.Scan(
+			&ticketType.ID,
+			&ticketType.ConferenceID,
+			&ticketType.Name,
+			&ticketType.Price,
+			&ticketType.Currency,
+			&ticketType.Quota,
+			&ticketType.Available,
+			&ticketType.Held,
+			&ticketType.SalesStart,
+			&ticketType.SalesEnd,
+			&ticketType.MinPerOrder,
+			&ticketType.MaxPerOrder,
+			&ticketType.Hidden,
+			&ticketType.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ticketTypes = append(ticketTypes, ticketType)
+	}
+
+	return ticketTypes, rows.Err()
+}
+
+// only performed by organizer
+// changing the quota moves availability by the same amount, it can never drop below what is sold
+func UpdateTicketType(ctx context.Context, db *pgxpool.Pool, ticketType *models.TicketType, organizerID uint32) error {
+	// queries
+	getQuery := `
+		SELECT c.organizer_id, c.currency, t.quota, t.available
+		FROM ticket_types t
+		JOIN conferences c ON c.id = t.conference_id
+		WHERE t.id = $1 AND t.conference_id = $2 AND c.deleted_at IS NULL
+		FOR UPDATE OF t;
+	`
+	updateQuery := `
+		UPDATE ticket_types
+		SET name = $1,
+			price = $2,
+			currency = $3,
+			quota = $4,
+			available = $5,
+			sales_start = $6,
+			sales_end = $7,
+			min_per_order = $8,
+			max_per_order = $9,
+			hidden = $10
+		WHERE id = $11;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// validate organizer and lock inventory
+	var existingOrganizerID, quota, available uint32
+	var currency string
+	err = tx.QueryRow(ctx, getQuery, ticketType.ID, ticketType.ConferenceID).Scan(&existingOrganizerID, &currency, &quota, &available)
+	if err != nil {
+		return errors.New("ticket type not found")
+	}
+
+	if existingOrganizerID != organizerID {
+		return errors.New("unauthorized: you are not the correct organizer")
+	}
+
+	if err := validateTicketType(ticketType, currency); err != nil {
+		return err
+	}
+
+	sold := quota - available
+	if ticketType.Quota < sold {
+		return errors.New("quota cannot be lower than tickets already sold")
+	}
+
+	_, err = tx.Exec(ctx, updateQuery,
+		ticketType.Name,
+		ticketType.Price,
+		ticketType.Currency,
+		ticketType.Quota,
+		ticketType.Quota-sold,
+		ticketType.SalesStart,
+		ticketType.SalesEnd,
+		ticketType.MinPerOrder,
+		ticketType.MaxPerOrder,
+		ticketType.Hidden,
+		ticketType.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
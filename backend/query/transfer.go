@@ -0,0 +1,317 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ticket transfer statuses
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferDeclined  = "declined"
+	TransferCancelled = "cancelled"
+	TransferExpired   = "expired"
+)
+
+// transfers of a conference are open while enabled and before the cut-off, $1 conference id, $2 now
+const transferOpenQuery = `
+	SELECT transfers_enabled AND status = 'ongoing'
+		AND $2 < event_time - transfer_cutoff_hours * INTERVAL '1 hour'
+	FROM conferences
+	WHERE id = $1 AND deleted_at IS NULL;
+`
+
+// fetches the transfer settings of a conference
+func GetTransferPolicy(ctx context.Context, db *pgxpool.Pool, conferenceID uint32) (*models.TransferPolicy, error) {
+	getQuery := `
+		SELECT transfers_enabled, transfer_cutoff_hours FROM conferences
+		WHERE id = $1 AND deleted_at IS NULL;
+	`
+
+	var policy models.TransferPolicy
+	err := db.QueryRow(ctx, getQuery, conferenceID).Scan(&policy.Enabled, &policy.CutoffHours)
+	if err != nil {
+		return nil, errors.New("conference not found")
+	}
+
+	return &policy, nil
+}
+
+// only performed by organizer
+// pending transfers past the new cut-off can no longer be accepted
+func SetTransferPolicy(ctx context.Context, db *pgxpool.Pool, conferenceID, organizerID uint32, policy models.TransferPolicy) error {
+	updateQuery := `
+		UPDATE conferences SET transfers_enabled = $1, transfer_cutoff_hours = $2
+		WHERE id = $3 AND organizer_id = $4 AND deleted_at IS NULL;
+	`
+
+	cmdTag, err := db.Exec(ctx, updateQuery, policy.Enabled, policy.CutoffHours, conferenceID, organizerID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("conference not found or not your conference")
+	}
+
+	return nil
+}
+
+// performed by ticket holder
+// offers an active ticket to whoever holds an account with the email, the ticket stays valid until accepted
+func StartTransfer(ctx context.Context, db *pgxpool.Pool, ticketID, userID uint32, email string) (*models.TicketTransfer, error) {
+	// queries
+	getQuery := `
+		SELECT COALESCE(t.holder_id, b.user_id), t.status, b.status, b.conference_id, u.email
+		FROM tickets t
+		JOIN bookings b ON b.id = t.booking_id
+		JOIN users u ON u.id = $2
+		WHERE t.id = $1 AND b.deleted_at IS NULL
+		FOR UPDATE OF t;
+	`
+	insertQuery := `
+		INSERT INTO ticket_transfers (ticket_id, from_user_id, to_email)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at;
+	`
+	notifyQuery := `
+		INSERT INTO notifications (user_id, email, subject, body)
+		SELECT r.id, $1, 'A ticket was sent to you: ' || c.title,
+			format(E'%s %s wants to give you their ticket for %s on %s at %s.\n\nAccept transfer %s to receive your own ticket.',
+				s.first_name, s.last_name, c.title, to_char(c.event_time, 'YYYY-MM-DD HH24:MI TZ'), c.location, $4::text)
+		FROM users s
+		JOIN conferences c ON c.id = $3
+		LEFT JOIN users r ON lower(r.email) = $1
+		WHERE s.id = $2;
+	`
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return nil, errors.New("recipient email is invalid")
+	}
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	transfer := models.TicketTransfer{TicketID: ticketID, FromUserID: &userID, ToEmail: email, Status: TransferPending}
+	var holderID uint32
+	var ticketStatus, bookingStatus, ownEmail string
+	err = tx.QueryRow(ctx, getQuery, ticketID, userID).Scan(&holderID, &ticketStatus, &bookingStatus, &transfer.ConferenceID, &ownEmail)
+	if err != nil || holderID != userID {
+		return nil, errors.New("ticket not found")
+	}
+
+	if ticketStatus != "active" || bookingStatus != BookingPaid {
+		return nil, errors.New("only active tickets of paid bookings can be transferred")
+	}
+
+	if strings.EqualFold(ownEmail, email) {
+		return nil, errors.New("cannot transfer a ticket to yourself")
+	}
+
+	var open bool
+	if err := tx.QueryRow(ctx, transferOpenQuery, transfer.ConferenceID, time.Now()).Scan(&open); err != nil {
+		return nil, err
+	}
+	if !open {
+		return nil, errors.New("transfers are closed for this conference")
+	}
+
+	err = tx.QueryRow(ctx, insertQuery, ticketID, userID, email).Scan(&transfer.ID, &transfer.CreatedAt)
+	if err != nil {
+		return nil, errors.New("ticket already has a pending transfer")
+	}
+
+	if _, err := tx.Exec(ctx, notifyQuery, email, userID, transfer.ConferenceID, transfer.ID); err != nil {
+		return nil, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transfer, nil
+}
+
+// fetches transfers a user sent or that were sent to their email, newest first
+func GetTransfers(ctx context.Context, db *pgxpool.Pool, userID uint32) ([]models.TicketTransfer, error) {
+	getQuery := `
+		SELECT tr.id, tr.ticket_id, t.ticket_code, c.id, c.title, tr.from_user_id, tr.to_email,
+			tr.to_user_id, tr.new_ticket_id, tr.status, tr.created_at, tr.resolved_at
+		FROM ticket_transfers tr
+		JOIN tickets t ON t.id = tr.ticket_id
+		JOIN bookings b ON b.id = t.booking_id
+		JOIN conferences c ON c.id = b.conference_id
+		JOIN users u ON u.id = $1
+		WHERE tr.from_user_id = u.id OR tr.to_user_id = u.id OR tr.to_email = lower(u.email)
+		ORDER BY tr.created_at DESC, tr.id DESC;
+	`
+
+	rows, err := db.Query(ctx, getQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.TicketTransfer])
+}
+
+// performed by the recipient
+// the old ticket code is voided and a new ticket is issued to the recipient on the same booking
+// so inventory and the booking's ticket count are untouched, the transfer row keeps the history
+func AcceptTransfer(ctx context.Context, db *pgxpool.Pool, transferID, userID uint32) (*models.Ticket, error) {
+	// queries
+	getQuery := `
+		SELECT tr.ticket_id, tr.from_user_id, tr.status, t.status, COALESCE(t.holder_id, b.user_id),
+			b.id, b.status, b.conference_id, u.first_name || ' ' || u.last_name, u.email
+		FROM ticket_transfers tr
+		JOIN tickets t ON t.id = tr.ticket_id
+		JOIN bookings b ON b.id = t.booking_id
+		JOIN users u ON u.id = $2
+		WHERE tr.id = $1 AND tr.to_email = lower(u.email) AND b.deleted_at IS NULL
+		FOR UPDATE OF tr, t;
+	`
+	expireQuery := `
+		UPDATE ticket_transfers SET status = 'expired', resolved_at = $1
+		WHERE id = $2;
+	`
+	voidQuery := `
+		UPDATE tickets SET status = 'void', voided_at = $1
+		WHERE id = $2;
+	`
+	insertQuery := `
+		INSERT INTO tickets (booking_id, ticket_code, attendee_name, attendee_email, assigned_at, holder_id, transferred_from)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, booking_id, ticket_code, status, attendee_name, attendee_email,
+			assigned_at, answers, holder_id, transferred_from, access_token, issued_at, voided_at;
+	`
+	acceptQuery := `
+		UPDATE ticket_transfers
+		SET status = 'accepted', to_user_id = $1, new_ticket_id = $2, resolved_at = $3
+		WHERE id = $4;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var ticketID, holderID, bookingID, conferenceID uint32
+	var fromUserID *uint32
+	var transferStatus, ticketStatus, bookingStatus, name, email string
+	err = tx.QueryRow(ctx, getQuery, transferID, userID).Scan(
+		&ticketID,
+		&fromUserID,
+		&transferStatus,
+		&ticketStatus,
+		&holderID,
+		&bookingID,
+		&bookingStatus,
+		&conferenceID,
+		&name,
+		&email,
+	)
+	if err != nil {
+		return nil, errors.New("transfer not found")
+	}
+
+	if transferStatus != TransferPending {
+		return nil, errors.New("transfer is " + transferStatus)
+	}
+
+	// the sender no longer holds a usable ticket or transfers closed meanwhile
+	now := time.Now()
+	var open bool
+	if err := tx.QueryRow(ctx, transferOpenQuery, conferenceID, now).Scan(&open); err != nil {
+		return nil, err
+	}
+	valid := ticketStatus == "active" && bookingStatus == BookingPaid && fromUserID != nil && *fromUserID == holderID
+	if !open || !valid {
+		if _, err := tx.Exec(ctx, expireQuery, now, transferID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("transfer has expired")
+	}
+
+	if _, err := tx.Exec(ctx, voidQuery, now, ticketID); err != nil {
+		return nil, err
+	}
+
+	var ticket models.Ticket
+	ticketCode := fmt.Sprintf("TCKT-%d-%d", bookingID, now.UnixNano())
+	err = tx.QueryRow(ctx, insertQuery, bookingID, ticketCode, name, strings.ToLower(email), now, userID, ticketID).Scan(
+		&ticket.ID,
+		&ticket.BookingID,
+		&ticket.TicketCode,
+		&ticket.Status,
+		&ticket.AttendeeName,
+		&ticket.AttendeeEmail,
+		&ticket.AssignedAt,
+		&ticket.Answers,
+		&ticket.HolderID,
+		&ticket.TransferredFrom,
+		&ticket.AccessToken,
+		&ticket.IssuedAt,
+		&ticket.VoidedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, acceptQuery, userID, ticket.ID, now, transferID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, ticketEmailQuery, ticket.ID, publicURL()); err != nil {
+		return nil, err
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
+
+// the sender cancels a pending transfer, the recipient declines it
+func CancelTransfer(ctx context.Context, db *pgxpool.Pool, transferID, userID uint32) (string, error) {
+	updateQuery := `
+		UPDATE ticket_transfers tr
+		SET status = CASE WHEN tr.from_user_id = u.id THEN 'cancelled' ELSE 'declined' END,
+			resolved_at = $3
+		FROM users u
+		WHERE tr.id = $1 AND u.id = $2 AND tr.status = 'pending'
+			AND (tr.from_user_id = u.id OR tr.to_email = lower(u.email))
+		RETURNING tr.status;
+	`
+
+	var status string
+	err := db.QueryRow(ctx, updateQuery, transferID, userID, time.Now()).Scan(&status)
+	if err != nil {
+		return "", errors.New("no pending transfer found")
+	}
+
+	return status, nil
+}
@@ -0,0 +1,253 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// conference statuses
+const (
+	ConferenceOngoing   = "ongoing"
+	ConferenceCompleted = "completed"
+	ConferenceCancelled = "cancelled"
+)
+
+// allowed status transitions => completed and cancelled are final
+var conferenceTransitions = map[string][]string{
+	ConferenceOngoing: {ConferenceCompleted, ConferenceCancelled},
+}
+
+// side effect executed inside the transition transaction
+type TransitionHook func(ctx context.Context, tx pgx.Tx, transition models.ConferenceTransition) error
+
+// side effects keyed by target status
+var transitionHooks = map[string][]TransitionHook{
+	ConferenceCancelled: {cancelConferenceBookings},
+}
+
+// registers an extra side effect for a target status
+func OnConferenceTransition(status string, hook TransitionHook) {
+	transitionHooks[status] = append(transitionHooks[status], hook)
+}
+
+// checks whether the state machine allows from -> to
+func CanTransitionConference(from, to string) bool {
+	for _, allowed := range conferenceTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// moves a conference to a new status and records who did it and why
+// changedBy is nil for system triggered transitions
+func TransitionConference(
+	ctx context.Context,
+	db *pgxpool.Pool,
+	conferenceID uint32,
+	changedBy *uint32,
+	toStatus, reason string,
+) (*models.ConferenceTransition, error) {
+	// queries
+	getQuery := `
+		SELECT organizer_id, status, event_time FROM conferences
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE;
+	`
+	updateQuery := `
+		UPDATE conferences SET status = $1 WHERE id = $2;
+	`
+	insertQuery := `
+		INSERT INTO conference_transitions (conference_id, from_status, to_status, changed_by, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at;
+	`
+
+	// validate input
+	toStatus = strings.ToLower(strings.TrimSpace(toStatus))
+	reason = strings.TrimSpace(reason)
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// lock conference row so concurrent transitions are serialized
+	var organizerID uint32
+	var fromStatus string
+	var eventTime time.Time
+	err = tx.QueryRow(ctx, getQuery, conferenceID).Scan(&organizerID, &fromStatus, &eventTime)
+	if err != nil {
+		return nil, errors.New("conference not found")
+	}
+
+	if changedBy != nil && *changedBy != organizerID {
+		return nil, errors.New("you are not authorised to change this conference")
+	}
+
+	if !CanTransitionConference(fromStatus, toStatus) {
+		return nil, fmt.Errorf("cannot move conference from %s to %s", fromStatus, toStatus)
+	}
+
+	if toStatus == ConferenceCompleted && eventTime.After(time.Now()) {
+		return nil, errors.New("cannot complete a conference before its event time")
+	}
+
+	// update status
+	_, err = tx.Exec(ctx, updateQuery, toStatus, conferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// record transition
+	transition := models.ConferenceTransition{
+		ConferenceID: conferenceID,
+		FromStatus:   fromStatus,
+		ToStatus:     toStatus,
+		ChangedBy:    changedBy,
+		Reason:       reason,
+	}
+	err = tx.QueryRow(ctx, insertQuery,
+		conferenceID,
+		fromStatus,
+		toStatus,
+		changedBy,
+		reason,
+	).Scan(&transition.ID, &transition.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// run side effects
+	for _, hook := range transitionHooks[toStatus] {
+		if err := hook(ctx, tx, transition); err != nil {
+			return nil, err
+		}
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transition, nil
+}
+
+// fetches status history of a conference
+func GetConferenceTransitions(ctx context.Context, db *pgxpool.Pool, conferenceID uint32) ([]models.ConferenceTransition, error) {
+	// query
+	getQuery := `
+		SELECT id, conference_id, from_status, to_status, changed_by, reason, created_at
+		FROM conference_transitions
+		WHERE conference_id = $1
+		ORDER BY created_at, id;
+	`
+
+	rows, err := db.Query(ctx, getQuery, conferenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []models.ConferenceTransition{}
+	for rows.Next() {
+		var transition models.ConferenceTransition
+		err := rows.Scan(
+			&transition.ID,
+			&transition.ConferenceID,
+			&transition.FromStatus,
+			&transition.ToStatus,
+			&transition.ChangedBy,
+			&transition.Reason,
+			&transition.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, transition)
+	}
+
+	return transitions, rows.Err()
+}
+
+// cancelled conference => bookings are cancelled, tickets voided and returned, payments refunded and attendees notified
+// buyers, holders of transferred tickets and named attendees each get one message
+// records are kept so attendees still see their history
+func cancelConferenceBookings(ctx context.Context, tx pgx.Tx, transition models.ConferenceTransition) error {
+	cancelQuery := `
+		WITH previous AS (
+			SELECT id, status FROM bookings
+			WHERE conference_id = $1 AND status IN ('pending_payment', 'paid') AND deleted_at IS NULL
+			FOR UPDATE
+		), cancelled AS (
+			UPDATE bookings b
+			SET status = 'cancelled',
+				cancelled_at = NOW(),
+				refund_due = CASE WHEN previous.status = 'paid' THEN b.total_price - b.refunded_amount ELSE 0 END
+			FROM previous
+			WHERE b.id = previous.id
+			RETURNING b.id, b.user_id, b.order_id, b.ticket_type_id, b.tickets_booked, b.refund_due, previous.status AS previous_status
+		), voided AS (
+			UPDATE tickets SET status = 'void', voided_at = NOW()
+			WHERE booking_id IN (SELECT id FROM cancelled) AND status = 'active'
+			RETURNING attendee_email, holder_id
+		), restored AS (
+			UPDATE ticket_types t SET available = t.available + r.quantity
+			FROM (
+				SELECT ticket_type_id, SUM(tickets_booked) AS quantity
+				FROM cancelled GROUP BY ticket_type_id
+			) r
+			WHERE t.id = r.ticket_type_id
+		), refunded AS (
+			INSERT INTO refunds (booking_id, payment_id, amount, reason)
+			SELECT cb.id, p.id, cb.refund_due, 'conference cancelled'
+			FROM cancelled cb
+			JOIN payments p ON p.booking_id = cb.id OR p.order_id = cb.order_id
+			WHERE cb.previous_status = 'paid' AND p.status = 'succeeded' AND cb.refund_due > 0
+		), recipients AS (
+			SELECT DISTINCT ON (lower(r.email)) r.user_id, r.email
+			FROM (
+				SELECT u.id AS user_id, u.email FROM cancelled cb JOIN users u ON u.id = cb.user_id
+				UNION ALL
+				SELECT u.id, u.email FROM voided v JOIN users u ON u.id = v.holder_id
+				UNION ALL
+				SELECT NULL, v.attendee_email FROM voided v WHERE v.attendee_email IS NOT NULL
+			) r
+			ORDER BY lower(r.email), r.user_id NULLS LAST
+		)
+		INSERT INTO notifications (user_id, email, subject, body)
+		SELECT r.user_id, r.email, 'Cancelled: ' || c.title,
+			format(E'%s on %s has been cancelled by the organizer. Your tickets are no longer valid and any payment will be refunded to the buyer.\n\nMessage from the organizer:\n%s',
+				c.title, to_char(c.event_time, 'YYYY-MM-DD HH24:MI TZ'), $2::text)
+		FROM recipients r
+		JOIN conferences c ON c.id = $1;
+	`
+
+	message := transition.Reason
+	if message == "" {
+		message = "No message was given."
+	}
+
+	_, err := tx.Exec(ctx, cancelQuery, transition.ConferenceID, message)
+	return err
+}
+
+// cancels a conference keeping its records => organizer
+func CancelConference(ctx context.Context, db *pgxpool.Pool, conferenceID, organizerID uint32, message string) (*models.ConferenceTransition, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, errors.New("a message to attendees is required")
+	}
+
+	return TransitionConference(ctx, db, conferenceID, &organizerID, ConferenceCancelled, message)
+}
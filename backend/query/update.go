@@ -1,16 +1,19 @@
 package query
 
 import (
+	"backend/money"
 	"context"
 	"errors"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // universal method
-func UpdateUserInfo(ctx context.Context, db *pgxpool.Pool, userID uint32, firstName, lastName, role string) error {
+// a nil preferred currency keeps the current one, an empty one clears it
+func UpdateUserInfo(ctx context.Context, db *pgxpool.Pool, userID uint32, firstName, lastName, role string, preferredCurrency *string) error {
 	// validate input
 	if strings.TrimSpace(firstName) == "" || strings.TrimSpace(lastName) == "" {
 		return errors.New("first name and last name cannot be empty")
@@ -21,14 +24,23 @@ func UpdateUserInfo(ctx context.Context, db *pgxpool.Pool, userID uint32, firstN
 		return errors.New("invalid role, must be 'customer' or 'organizer'")
 	}
 
+	if preferredCurrency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*preferredCurrency))
+		if currency != "" && !money.ValidCurrency(currency) {
+			return errors.New("preferred currency must be a 3 letter ISO code")
+		}
+		preferredCurrency = &currency
+	}
+
 	// update query
 	query := `
 		UPDATE users
-		SET first_name = $1, last_name = $2, role = $3
-		WHERE id = $4
+		SET first_name = $1, last_name = $2, role = $3,
+			preferred_currency = CASE WHEN $5::text IS NULL THEN preferred_currency ELSE NULLIF($5, '') END
+		WHERE id = $4 AND deleted_at IS NULL
 	`
 
-	cmdTag, err := db.Exec(ctx, query, firstName, lastName, role, userID)
+	cmdTag, err := db.Exec(ctx, query, firstName, lastName, role, userID, preferredCurrency)
 	if err != nil {
 		return err
 	}
@@ -48,35 +60,28 @@ func UpdateConference(
 	organizerID uint32,
 	title, description, location string,
 	eventTime time.Time,
-	status string,
 ) error {
 	// Queries
 	getQuery := `
-		SELECT organizer_id FROM conferences WHERE id = $1
+		SELECT organizer_id FROM conferences WHERE id = $1 AND deleted_at IS NULL
 	`
 	updateQuery := `
 		UPDATE conferences
 		SET title = $1,
 			description = $2,
 			location = $3,
-			event_time = $4,
-			status = $5
-		WHERE id = $6;
+			event_time = $4
+		WHERE id = $5;
 	`
 
 	// validate input
 	title = strings.TrimSpace(title)
 	location = strings.TrimSpace(location)
-	status = strings.ToLower(strings.TrimSpace(status))
 
 	if title == "" || location == "" {
 		return errors.New("title and location cannot be empty")
 	}
 
-	if status != "ongoing" && status != "completed" && status != "cancelled" {
-		return errors.New("invalid status")
-	}
-
 	// check is conference belongs to the organizer
 	var existingOrganizerID uint32
 	err := db.QueryRow(ctx, getQuery, conferenceID).Scan(&existingOrganizerID)
@@ -94,7 +99,6 @@ func UpdateConference(
 		description,
 		location,
 		eventTime,
-		status,
 		conferenceID,
 	)
 	if err != nil {
@@ -109,6 +113,10 @@ func UpdateConference(
 }
 
 // performed by customer
+// payment states are driven by the provider, customers may only cancel
+// which follows the conference refund policy
+// only free bookings change their ticket count, priced ones were paid for as booked
+// inventory and tickets follow the new count in the same transaction
 func UpdateBooking(
 	ctx context.Context,
 	db *pgxpool.Pool,
@@ -118,32 +126,41 @@ func UpdateBooking(
 ) error {
 	// queries
 	getQuery := `
-		SELECT user_id, booked_at FROM bookings
-		WHERE id = $1;
-	`
-	updateQuery := `
-		UPDATE bookings
-		SET tickets_booked = $1,
-			status = $2
-		WHERE id = $3;
+		SELECT b.user_id, b.status, b.conference_id, b.ticket_type_id, b.tickets_booked, b.total_price,
+			c.event_time, t.min_per_order, t.max_per_order
+		FROM bookings b
+		JOIN conferences c ON c.id = b.conference_id
+		JOIN ticket_types t ON t.id = b.ticket_type_id
+		WHERE b.id = $1 AND b.deleted_at IS NULL
+		FOR UPDATE OF b;
 	`
 
 	// validate inputs
 	status = strings.ToLower(strings.TrimSpace(status))
-	if status != "completed" && status != "cancelled" && status != "failed" {
-		return errors.New("invalid status value")
+	if status != "" && status != BookingCancelled {
+		return errors.New("invalid status value, bookings can only be cancelled")
 	}
 
-	if ticketsBooked <= 0 {
+	if status == "" && ticketsBooked <= 0 {
 		return errors.New("number of tickets booked should be greater than 0")
 	}
 
-	// get booked time and user check
-	var bookingAt time.Time
-	var bookingUserID uint32
-	err := db.QueryRow(ctx, getQuery,
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// get event time and user check
+	var eventTime time.Time
+	var bookingUserID, conferenceID, ticketTypeID, currentTickets, minPerOrder uint32
+	var maxPerOrder *uint32
+	var currentStatus string
+	var totalPrice int64
+	err = tx.QueryRow(ctx, getQuery,
 		bookingID,
-	).Scan(&bookingUserID, &bookingAt)
+	).Scan(&bookingUserID, &currentStatus, &conferenceID, &ticketTypeID, &currentTickets, &totalPrice, &eventTime, &minPerOrder, &maxPerOrder)
 	if err != nil {
 		return errors.New("booking not found")
 	}
@@ -153,24 +170,110 @@ func UpdateBooking(
 	}
 
 	// time constraint
-	if time.Since(bookingAt) > 4*time.Hour {
-		return errors.New("update window expired: can only update within 4 hours after booking")
+	now := time.Now()
+	if !now.Before(eventTime) {
+		return errors.New("update window expired: the event has already started")
 	}
 
-	cmdTag, err := db.Exec(ctx, updateQuery,
-		ticketsBooked,
-		status,
-		bookingID,
-	)
+	switch {
+	case status == BookingCancelled:
+		if currentStatus != BookingCancelled {
+			err = cancelBookingTx(ctx, tx, bookingID, "cancelled by customer", now)
+		}
+	case ticketsBooked == currentTickets:
+	case currentStatus != BookingPaid || totalPrice != 0:
+		err = errors.New("only free bookings can change their ticket count, cancel and book again instead")
+	case ticketsBooked < minPerOrder || (maxPerOrder != nil && ticketsBooked > *maxPerOrder):
+		err = errors.New("number of tickets is outside the allowed range per order")
+	case ticketsBooked > currentTickets:
+		err = checkBookingLimits(ctx, tx, userID, conferenceID, ticketsBooked-currentTickets, ticketsBooked)
+		if err == nil {
+			err = resizeBookingTx(ctx, tx, bookingID, ticketTypeID, currentTickets, ticketsBooked, now)
+		}
+	default:
+		err = resizeBookingTx(ctx, tx, bookingID, ticketTypeID, currentTickets, ticketsBooked, now)
+	}
 	if err != nil {
 		return err
 	}
 
-	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no update performed")
+	// commit transaction
+	return tx.Commit(ctx)
+}
+
+// changes the ticket count of a locked paid booking
+// added tickets come out of availability not reserved for the waitlist and are issued,
+// removed ones are voided newest first and go back on sale
+// tickets given away by transfer belong to their new holders and are never voided
+func resizeBookingTx(ctx context.Context, tx pgx.Tx, bookingID, ticketTypeID, from, to uint32, now time.Time) error {
+	// queries
+	takeQuery := `
+		UPDATE ticket_types
+		SET available = available - $1
+		WHERE id = $2 AND available >= $1 + $3
+		RETURNING available;
+	`
+	returnQuery := `
+		UPDATE ticket_types
+		SET available = available + $1
+		WHERE id = $2;
+	`
+	voidQuery := `
+		UPDATE tickets SET status = 'void', voided_at = $1
+		WHERE id IN (
+			SELECT t.id FROM tickets t
+			JOIN bookings b ON b.id = t.booking_id
+			WHERE t.booking_id = $2 AND t.status = 'active' AND COALESCE(t.holder_id, b.user_id) = b.user_id
+			ORDER BY t.id DESC
+			LIMIT $3
+		);
+	`
+	updateQuery := `
+		UPDATE bookings SET tickets_booked = $1
+		WHERE id = $2;
+	`
+
+	if to < from {
+		removed := from - to
+		if _, err := tx.Exec(ctx, returnQuery, removed, ticketTypeID); err != nil {
+			return err
+		}
+		cmdTag, err := tx.Exec(ctx, voidQuery, now, bookingID, removed)
+		if err != nil {
+			return err
+		}
+		if cmdTag.RowsAffected() < int64(removed) {
+			return errors.New("cannot remove tickets transferred to other attendees")
+		}
+		_, err = tx.Exec(ctx, updateQuery, to, bookingID)
+		return err
 	}
 
-	return nil
+	// tickets of expired holds are free again
+	var released uint32
+	if err := tx.QueryRow(ctx, releaseExpiredHoldsQuery, now, ticketTypeID).Scan(&released); err != nil {
+		return err
+	}
+
+	var reserved uint32
+	if err := tx.QueryRow(ctx, waitlistReservedQuery, ticketTypeID).Scan(&reserved); err != nil {
+		return err
+	}
+
+	var remaining uint32
+	err := tx.QueryRow(ctx, takeQuery, to-from, ticketTypeID, reserved).Scan(&remaining)
+	if err == pgx.ErrNoRows {
+		return ErrSoldOut
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, updateQuery, to, bookingID); err != nil {
+		return err
+	}
+
+	return GenerateTickets(ctx, tx, bookingID)
 }
 
 // administration service
@@ -187,7 +290,7 @@ func UpdateTicket(
 	`
 	checkQuery := `
 		SELECT user_id FROM bookings
-		WHERE id = $1;
+		WHERE id = $1 AND deleted_at IS NULL;
 	`
 	updateQuery := `
 		UPDATE tickets
@@ -239,3 +342,65 @@ func UpdateTicket(
 
 	return nil
 }
+
+// administration service => undo a user soft delete
+func RestoreUser(ctx context.Context, db *pgxpool.Pool, userID uint32) error {
+	// the email may have been taken by a new account in the meantime
+	restoreQuery := `
+		UPDATE users SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM users other
+				WHERE other.email = users.email AND other.deleted_at IS NULL
+			);
+	`
+
+	cmdTag, err := db.Exec(ctx, restoreQuery, userID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("no deleted user found or email is in use by another account")
+	}
+
+	return nil
+}
+
+// administration service => undo a conference soft delete
+func RestoreConference(ctx context.Context, db *pgxpool.Pool, conferenceID uint32) error {
+	restoreQuery := `
+		UPDATE conferences SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL;
+	`
+
+	cmdTag, err := db.Exec(ctx, restoreQuery, conferenceID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("no deleted conference found with the given ID")
+	}
+
+	return nil
+}
+
+// administration service => undo a booking soft delete
+func RestoreBooking(ctx context.Context, db *pgxpool.Pool, bookingID uint32) error {
+	restoreQuery := `
+		UPDATE bookings SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL;
+	`
+
+	cmdTag, err := db.Exec(ctx, restoreQuery, bookingID)
+	if err != nil {
+		return err
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("no deleted booking found with the given ID")
+	}
+
+	return nil
+}
@@ -0,0 +1,337 @@
+package query
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// waitlist entry statuses
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistOffered = "offered"
+	WaitlistClaimed = "claimed"
+	WaitlistExpired = "expired"
+	WaitlistLeft    = "left"
+	WaitlistClosed  = "closed"
+)
+
+// performed by customer
+// lines up for tickets of a sold out conference, or of one of its ticket types
+// joining is refused while enough tickets are still on sale, tickets reserved for the waitlist are not
+func JoinWaitlist(ctx context.Context, db *pgxpool.Pool, entry *models.WaitlistEntry) error {
+	// queries
+	conferenceQuery := `
+		SELECT status, event_time FROM conferences
+		WHERE id = $1 AND deleted_at IS NULL;
+	`
+	typeQuery := `
+		SELECT min_per_order, max_per_order FROM ticket_types
+		WHERE id = $1 AND conference_id = $2 AND NOT hidden;
+	`
+	availableQuery := `
+		SELECT COUNT(*) FROM ticket_types t
+		JOIN ticket_availability a ON a.ticket_type_id = t.id
+		LEFT JOIN waitlist_reservations r ON r.ticket_type_id = t.id
+		WHERE t.conference_id = $1 AND NOT t.hidden
+			AND ($2::int IS NULL OR t.id = $2)
+			AND a.available - COALESCE(r.reserved, 0) >= $3;
+	`
+	insertQuery := `
+		INSERT INTO waitlist_entries (user_id, conference_id, ticket_type_id, quantity)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, created_at;
+	`
+
+	if entry.Quantity == 0 {
+		return errors.New("quantity should be greater than 0")
+	}
+
+	var status string
+	var eventTime time.Time
+	err := db.QueryRow(ctx, conferenceQuery, entry.ConferenceID).Scan(&status, &eventTime)
+	if err != nil {
+		return errors.New("conference not found")
+	}
+
+	if status != "ongoing" || !eventTime.After(time.Now()) {
+		return errors.New("conference is not available for booking")
+	}
+
+	if entry.TicketTypeID != nil {
+		var minPerOrder uint32
+		var maxPerOrder *uint32
+		err = db.QueryRow(ctx, typeQuery, *entry.TicketTypeID, entry.ConferenceID).Scan(&minPerOrder, &maxPerOrder)
+		if err != nil {
+			return errors.New("ticket type not found for this conference")
+		}
+		if entry.Quantity < minPerOrder || (maxPerOrder != nil && entry.Quantity > *maxPerOrder) {
+			return errors.New("number of tickets is outside the allowed range per order")
+		}
+	}
+
+	// an entry could never be offered if it breaks the order limits
+	if err := checkBookingLimits(ctx, db, entry.UserID, entry.ConferenceID, entry.Quantity, entry.Quantity); err != nil {
+		return err
+	}
+
+	var onSale int
+	err = db.QueryRow(ctx, availableQuery, entry.ConferenceID, entry.TicketTypeID, entry.Quantity).Scan(&onSale)
+	if err != nil {
+		return err
+	}
+	if onSale > 0 {
+		return errors.New("tickets are still available, book them instead")
+	}
+
+	err = db.QueryRow(ctx, insertQuery,
+		entry.UserID,
+		entry.ConferenceID,
+		entry.TicketTypeID,
+		entry.Quantity,
+	).Scan(&entry.ID, &entry.Status, &entry.CreatedAt)
+	if err != nil {
+		return errors.New("already on the waitlist for this conference")
+	}
+
+	return nil
+}
+
+// fetches the waitlist entries of a user, waiting ones with their place in line
+func GetWaitlistEntries(ctx context.Context, db *pgxpool.Pool, userID uint32) ([]models.WaitlistEntry, error) {
+	getQuery := `
+		SELECT w.id, w.user_id, w.conference_id, w.ticket_type_id, w.quantity, w.status,
+			w.hold_id, w.offered_at, w.offer_expires_at, w.created_at,
+			CASE WHEN w.status = 'waiting' THEN (
+				SELECT COUNT(*) + 1 FROM waitlist_entries o
+				WHERE o.conference_id = w.conference_id AND o.status = 'waiting'
+					AND (o.created_at, o.id) < (w.created_at, w.id)
+					AND (o.ticket_type_id IS NULL OR w.ticket_type_id IS NULL OR o.ticket_type_id = w.ticket_type_id)
+			)::int END
+		FROM waitlist_entries w
+		WHERE w.user_id = $1
+		ORDER BY w.created_at DESC, w.id DESC;
+	`
+
+	rows, err := db.Query(ctx, getQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[models.WaitlistEntry])
+}
+
+// performed by customer
+// an open offer is given up with the entry, its tickets go to the next person
+func LeaveWaitlist(ctx context.Context, db *pgxpool.Pool, entryID, userID uint32) error {
+	// queries
+	updateQuery := `
+		UPDATE waitlist_entries SET status = 'left'
+		WHERE id = $1 AND user_id = $2 AND status IN ('waiting', 'offered')
+		RETURNING hold_id;
+	`
+	releaseQuery := `
+		WITH released AS (
+			UPDATE holds SET status = 'released'
+			WHERE id = $1 AND status = 'active'
+			RETURNING ticket_type_id, quantity
+		)
+		UPDATE ticket_types t SET available = t.available + r.quantity
+		FROM released r
+		WHERE t.id = r.ticket_type_id;
+	`
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var holdID *string
+	err = tx.QueryRow(ctx, updateQuery, entryID, userID).Scan(&holdID)
+	if err != nil {
+		return errors.New("no open waitlist entry found")
+	}
+
+	if holdID != nil {
+		if _, err := tx.Exec(ctx, releaseQuery, *holdID); err != nil {
+			return err
+		}
+	}
+
+	// commit transaction
+	return tx.Commit(ctx)
+}
+
+// waitlist service => offers freed tickets to waiting customers in the order they joined
+// freed tickets that fit a waiting entry are reserved for it meanwhile, see waitlist_reservations
+// each offer is a hold lasting offerTTL, confirming it books the tickets like any other hold
+// offers that ran out or were released go back on sale and reach the next person on the following run
+// an entry that does not fit the tickets left is skipped so smaller requests behind it are still served
+func PromoteWaitlist(ctx context.Context, db *pgxpool.Pool, offerTTL time.Duration) (int, error) {
+	// queries
+	settleQuery := `
+		UPDATE waitlist_entries w
+		SET status = CASE WHEN h.status = 'confirmed' THEN 'claimed' ELSE 'expired' END
+		FROM holds h
+		WHERE h.id = w.hold_id AND w.status = 'offered' AND h.status <> 'active';
+	`
+	closeQuery := `
+		UPDATE waitlist_entries w SET status = 'closed'
+		FROM conferences c
+		WHERE c.id = w.conference_id AND w.status = 'waiting'
+			AND (c.status <> 'ongoing' OR c.event_time <= $1 OR c.deleted_at IS NOT NULL);
+	`
+	getQuery := `
+		SELECT w.id, w.user_id, w.conference_id, w.ticket_type_id, w.quantity
+		FROM waitlist_entries w
+		WHERE w.status = 'waiting'
+			AND EXISTS (
+				SELECT 1 FROM ticket_types t
+				JOIN ticket_availability a ON a.ticket_type_id = t.id
+				WHERE t.conference_id = w.conference_id
+					AND (t.id = w.ticket_type_id OR (w.ticket_type_id IS NULL AND NOT t.hidden))
+					AND a.available >= w.quantity
+			)
+		ORDER BY w.created_at, w.id
+		FOR UPDATE OF w SKIP LOCKED;
+	`
+	typesQuery := `
+		SELECT id FROM ticket_types
+		WHERE conference_id = $1 AND NOT hidden
+		ORDER BY id;
+	`
+	offerQuery := `
+		UPDATE waitlist_entries
+		SET status = 'offered', hold_id = $1, offered_at = $2, offer_expires_at = $3
+		WHERE id = $4;
+	`
+	notifyQuery := `
+		INSERT INTO notifications (user_id, email, subject, body)
+		SELECT u.id, u.email, 'Tickets available: ' || c.title,
+			format(E'%s ticket(s) for %s on %s are held for you until %s.\n\nConfirm hold %s to book them. Unclaimed tickets are offered to the next person on the waitlist.',
+				$3::int, c.title, to_char(c.event_time, 'YYYY-MM-DD HH24:MI TZ'), to_char($4::timestamptz, 'YYYY-MM-DD HH24:MI TZ'), $5::text)
+		FROM users u
+		JOIN conferences c ON c.id = $2
+		WHERE u.id = $1;
+	`
+
+	if offerTTL <= 0 {
+		return 0, errors.New("offer window must be positive")
+	}
+
+	// transaction phase
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// free expired holds first, their tickets are what the waitlist is waiting for
+	now := time.Now()
+	var released int64
+	if err := tx.QueryRow(ctx, releaseExpiredHoldsQuery, now, nil).Scan(&released); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, settleQuery); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, closeQuery, now); err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(ctx, getQuery)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.WaitlistEntry, error) {
+		var entry models.WaitlistEntry
+		err := row.Scan(&entry.ID, &entry.UserID, &entry.ConferenceID, &entry.TicketTypeID, &entry.Quantity)
+		return entry, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	offered := 0
+	for _, entry := range entries {
+		ticketTypeIDs := []uint32{}
+		if entry.TicketTypeID != nil {
+			ticketTypeIDs = append(ticketTypeIDs, *entry.TicketTypeID)
+		} else {
+			rows, err := tx.Query(ctx, typesQuery, entry.ConferenceID)
+			if err != nil {
+				return 0, err
+			}
+			ticketTypeIDs, err = pgx.CollectRows(rows, pgx.RowTo[uint32])
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		hold, err := offerHoldTx(ctx, tx, entry, ticketTypeIDs, offerTTL, now)
+		if err != nil {
+			return 0, err
+		}
+		if hold == nil {
+			continue
+		}
+
+		if _, err := tx.Exec(ctx, offerQuery, hold.ID, now, hold.ExpiresAt, entry.ID); err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(ctx, notifyQuery, entry.UserID, entry.ConferenceID, entry.Quantity, hold.ExpiresAt, hold.ID)
+		if err != nil {
+			return 0, err
+		}
+		offered++
+	}
+
+	// commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return offered, nil
+}
+
+// holds tickets of the first ticket type that can serve a waitlist entry, nil when none can
+// each attempt runs in a savepoint so a refused one leaves the transaction usable
+// types refused for other reasons than sold out, e.g. outside their sales window, keep the entry waiting
+func offerHoldTx(ctx context.Context, tx pgx.Tx, entry models.WaitlistEntry, ticketTypeIDs []uint32, ttl time.Duration, now time.Time) (*models.Hold, error) {
+	for _, ticketTypeID := range ticketTypeIDs {
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		hold := models.Hold{
+			UserID:       entry.UserID,
+			ConferenceID: entry.ConferenceID,
+			TicketTypeID: ticketTypeID,
+			Quantity:     entry.Quantity,
+		}
+		err = holdTicketsTx(ctx, savepoint, &hold, "", true, ttl, now)
+		if err != nil {
+			savepoint.Rollback(ctx)
+			continue
+		}
+
+		if err := savepoint.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("waitlist entry %d: %w", entry.ID, err)
+		}
+		return &hold, nil
+	}
+
+	return nil, nil
+}
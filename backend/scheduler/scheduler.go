@@ -0,0 +1,243 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// advisory lock key shared by every replica, only the holder runs jobs
+const leaderLockKey int64 = 7_264_001
+
+// how often followers retry election and the leader checks its lock connection
+const electionInterval = 10 * time.Second
+
+// work executed periodically by the leader replica
+type JobFunc func(ctx context.Context, db *pgxpool.Pool) error
+
+type job struct {
+	name     string
+	interval time.Duration
+	fn       JobFunc
+}
+
+// snapshot of a job for observability
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Interval     string     `json:"interval"`
+	Running      bool       `json:"running"`
+	Runs         uint64     `json:"runs"`
+	Failures     uint64     `json:"failures"`
+	LastRunAt    *time.Time `json:"last_run_at"`
+	LastDuration string     `json:"last_duration"`
+	LastError    string     `json:"last_error"`
+}
+
+// in-process job scheduler with leader election through a postgres advisory lock
+type Scheduler struct {
+	db       *pgxpool.Pool
+	instance string
+
+	mu     sync.RWMutex
+	jobs   []*job
+	status map[string]*JobStatus
+	conn   *pgxpool.Conn // holds the session advisory lock while leader
+}
+
+func New(db *pgxpool.Pool) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		db:       db,
+		instance: fmt.Sprintf("%s-%d", host, os.Getpid()),
+		status:   make(map[string]*JobStatus),
+	}
+}
+
+// adds a job, must be called before Start
+func (s *Scheduler) Register(name string, interval time.Duration, fn JobFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs = append(s.jobs, &job{name: name, interval: interval, fn: fn})
+	s.status[name] = &JobStatus{Name: name, Interval: interval.String()}
+}
+
+// runs election and job loops until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	go s.elect(ctx)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, j := range s.jobs {
+		go s.loop(ctx, j)
+	}
+}
+
+// name of this replica
+func (s *Scheduler) Instance() string {
+	return s.instance
+}
+
+// reports whether this replica currently holds the leader lock
+func (s *Scheduler) IsLeader() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.conn != nil
+}
+
+// snapshot of every registered job
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		statuses = append(statuses, *s.status[j.name])
+	}
+	return statuses
+}
+
+// leader election loop
+func (s *Scheduler) elect(ctx context.Context) {
+	ticker := time.NewTicker(electionInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.IsLeader() {
+			s.checkLeadership(ctx)
+		} else {
+			s.tryLead(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tries to take the advisory lock on a dedicated connection
+func (s *Scheduler) tryLead(ctx context.Context) {
+	conn, err := s.db.Acquire(ctx)
+	if err != nil {
+		log.Printf("scheduler: acquire connection: %v", err)
+		return
+	}
+
+	var locked bool
+	err = conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, leaderLockKey).Scan(&locked)
+	if err != nil || !locked {
+		conn.Release()
+		return
+	}
+
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	log.Printf("scheduler: %s became leader", s.instance)
+}
+
+// the lock lives as long as the session, a dead connection means lost leadership
+func (s *Scheduler) checkLeadership(ctx context.Context) {
+	s.mu.RLock()
+	conn := s.conn
+	s.mu.RUnlock()
+
+	if _, err := conn.Exec(ctx, `SELECT 1`); err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.conn = nil
+	s.mu.Unlock()
+
+	conn.Conn().Close(context.Background())
+	conn.Release()
+	log.Printf("scheduler: %s lost leadership", s.instance)
+}
+
+// releases the lock so another replica can take over quickly
+func (s *Scheduler) resign() {
+	s.mu.Lock()
+	conn := s.conn
+	s.conn = nil
+	s.mu.Unlock()
+
+	if conn == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, leaderLockKey)
+	conn.Release()
+}
+
+// per job ticker, only the leader executes
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.IsLeader() {
+				s.run(ctx, j)
+			}
+		}
+	}
+}
+
+// executes one job run and records its outcome
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	s.mu.Lock()
+	s.status[j.name].Running = true
+	s.mu.Unlock()
+
+	startedAt := time.Now()
+	err := j.fn(ctx, s.db)
+	duration := time.Since(startedAt)
+
+	// in-memory status
+	s.mu.Lock()
+	status := s.status[j.name]
+	status.Running = false
+	status.Runs++
+	status.LastRunAt = &startedAt
+	status.LastDuration = duration.String()
+	status.LastError = ""
+	if err != nil {
+		status.Failures++
+		status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("scheduler: job %s failed after %s: %v", j.name, duration, err)
+	}
+
+	// persisted run history, visible across replicas
+	var errText *string
+	if err != nil {
+		msg := err.Error()
+		errText = &msg
+	}
+
+	insertQuery := `
+		INSERT INTO job_runs (job_name, instance, started_at, finished_at, error)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+	_, dbErr := s.db.Exec(ctx, insertQuery, j.name, s.instance, startedAt, startedAt.Add(duration), errText)
+	if dbErr != nil {
+		log.Printf("scheduler: record run of %s: %v", j.name, dbErr)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"backend/models"
+	"backend/query"
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// BookingService runs every booking step that changes inventory or issues tickets as one unit of work
+// query functions are handed the shared transaction, so either all of them apply or none does
+type BookingService struct {
+	DB *pgxpool.Pool
+}
+
+func NewBookingService(db *pgxpool.Pool) *BookingService {
+	return &BookingService{DB: db}
+}
+
+// books tickets, free bookings get their tickets in the same transaction
+func (s *BookingService) Book(ctx context.Context, booking models.Booking, promoCode string) (*models.Booking, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	bookingID, err := query.CreateBooking(ctx, tx, booking, promoCode)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := query.GetBookingByID(ctx, tx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+
+	if created.Status == query.BookingPaid {
+		if err := query.GenerateTickets(ctx, tx, bookingID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// books the whole cart under one order, free bookings of the order get their tickets in the same transaction
+func (s *BookingService) Checkout(ctx context.Context, template models.Booking) (*models.Order, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	orderID, err := query.Checkout(ctx, tx, template)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := query.GetOrder(ctx, tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, booking := range order.Bookings {
+		if booking.Status != query.BookingPaid {
+			continue
+		}
+		if err := query.GenerateTickets(ctx, tx, booking.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// records a succeeded intent and issues the tickets of every booking it pays in the same transaction
+func (s *BookingService) CompletePayment(ctx context.Context, intentID string) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	paid, err := query.CompletePayment(ctx, tx, intentID)
+	if err != nil {
+		return err
+	}
+
+	for _, bookingID := range paid {
+		if err := query.GenerateTickets(ctx, tx, bookingID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// issues missing tickets of paid bookings, left behind by runs before booking and tickets were atomic
+// each booking is repaired on its own so one failure does not block the rest
+func (s *BookingService) RecoverTickets(ctx context.Context) (int, error) {
+	bookingIDs, err := query.GetBookingsMissingTickets(ctx, s.DB)
+	if err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	var firstErr error
+	for _, bookingID := range bookingIDs {
+		if err := query.GenerateTickets(ctx, s.DB, bookingID); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("booking %d: %w", bookingID, err)
+			}
+			continue
+		}
+		recovered++
+	}
+
+	return recovered, firstErr
+}
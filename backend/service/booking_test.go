@@ -0,0 +1,145 @@
+package service
+
+import (
+	"backend/models"
+	"backend/query"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// fires parallel bookings at one conference and checks no more tickets are sold than exist
+// needs a database with the schema loaded, skipped without DATABASE_URL
+func TestBookDoesNotOversell(t *testing.T) {
+	const (
+		tickets  = 50
+		bookings = 500
+	)
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	config, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		t.Fatalf("invalid DATABASE_URL: %v", err)
+	}
+	config.MaxConns = 50
+
+	ctx := context.Background()
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("unable to connect to database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	// setup
+	run := time.Now().UnixNano()
+	organizerIDs := createAccounts(t, db, run, "organizer", 1)
+	customerIDs := createAccounts(t, db, run, "customer", bookings)
+
+	conference := models.Conference{
+		Title:        fmt.Sprintf("Oversell check %d", run),
+		Location:     "Nowhere",
+		EventTime:    time.Now().Add(24 * time.Hour),
+		OrganizerID:  organizerIDs[0],
+		Status:       "ongoing",
+		TotalTickets: tickets,
+	}
+	conferenceID, err := query.CreateConference(ctx, db, &conference)
+	if err != nil {
+		t.Fatalf("creating conference: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec(ctx, `DELETE FROM conferences WHERE id = $1;`, conferenceID)
+		db.Exec(ctx, `DELETE FROM users WHERE id = ANY($1);`, append(customerIDs, organizerIDs...))
+	})
+
+	// fire every booking at once
+	bookingService := NewBookingService(db)
+	errs := make([]error, len(customerIDs))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, customerID := range customerIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			_, errs[i] = bookingService.Book(ctx, models.Booking{
+				UserID:        customerID,
+				ConferenceID:  conferenceID,
+				TicketsBooked: 1,
+			}, "")
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	sold := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			sold++
+		case !errors.Is(err, query.ErrSoldOut):
+			t.Errorf("booking failed with %v, want sold out", err)
+		}
+	}
+
+	if sold > tickets {
+		t.Errorf("sold %d tickets, only %d exist", sold, tickets)
+	}
+
+	// check
+	var available, held, booked, issued int
+	err = db.QueryRow(ctx, `
+		SELECT
+			(SELECT COALESCE(SUM(available), 0) FROM ticket_types WHERE conference_id = $1)::int,
+			(SELECT COALESCE(SUM(quantity), 0) FROM holds WHERE conference_id = $1 AND status = 'active')::int,
+			(SELECT COALESCE(SUM(tickets_booked), 0) FROM bookings WHERE conference_id = $1 AND status IN ('pending_payment', 'paid'))::int,
+			(SELECT COUNT(*) FROM tickets t JOIN bookings b ON b.id = t.booking_id WHERE b.conference_id = $1)::int;
+	`, conferenceID).Scan(&available, &held, &booked, &issued)
+	if err != nil {
+		t.Fatalf("reading results: %v", err)
+	}
+
+	if booked != sold {
+		t.Errorf("booked %d tickets, %d bookings succeeded", booked, sold)
+	}
+	if booked+held+available != tickets {
+		t.Errorf("inventory drift: booked %d + held %d + available %d != %d", booked, held, available, tickets)
+	}
+	if issued != booked {
+		t.Errorf("issued %d tickets for %d booked", issued, booked)
+	}
+}
+
+// inserts throwaway accounts directly, hashing a password for each would dominate the run
+// the password hash is not a valid bcrypt hash so nobody can log in as them
+func createAccounts(t *testing.T, db *pgxpool.Pool, run int64, role string, count int) []uint32 {
+	t.Helper()
+
+	rows, err := db.Query(context.Background(), `
+		INSERT INTO users (first_name, last_name, email, role, password_hash)
+		SELECT 'Oversell', $2::text || ' ' || g, 'oversell-' || $1::text || '-' || $2::text || '-' || g || '@example.com', $2::text, '!'
+		FROM generate_series(1, $3::int) g
+		RETURNING id;
+	`, fmt.Sprint(run), role, count)
+	if err != nil {
+		t.Fatalf("creating %s accounts: %v", role, err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uint32])
+	if err != nil {
+		t.Fatalf("creating %s accounts: %v", role, err)
+	}
+	return ids
+}
@@ -0,0 +1,120 @@
+package tax
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidVATID = errors.New("tax id does not match the format of the billing country")
+
+// organizer tax settings
+type Settings struct {
+	Country          string // where the organizer is registered
+	ChargesTax       bool   // false for organizers below the registration threshold
+	PricesIncludeTax bool   // ticket prices are gross when true
+}
+
+// a country with the rate that applies to the sale, loaded from the rate tables
+type Jurisdiction struct {
+	Country      string
+	VATArea      string // countries sharing an area may reverse charge between them, e.g. EU
+	VATIDPattern string // empty when tax ids are not checked
+	RateBP       uint32 // basis points, 1900 = 19%
+}
+
+// tax charged on an order, amounts in minor units
+type Breakdown struct {
+	Country       string `json:"country"`
+	RateBP        uint32 `json:"rate_bp"`
+	Net           int64  `json:"net"`
+	Tax           int64  `json:"tax"`
+	Gross         int64  `json:"gross"`
+	Inclusive     bool   `json:"inclusive"`
+	ReverseCharge bool   `json:"reverse_charge"`
+}
+
+// strips spaces, dots and dashes and upper cases a tax id
+func NormalizeVATID(vatID string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(vatID)))
+}
+
+// checks a normalized tax id against the format of its country
+func ValidVATID(vatID string, j Jurisdiction) bool {
+	if j.VATIDPattern == "" {
+		return true
+	}
+	pattern, err := regexp.Compile(j.VATIDPattern)
+	if err != nil {
+		return false
+	}
+	return pattern.MatchString(vatID)
+}
+
+// tax on an order amount for a buyer
+// business buyers with a valid tax id in another country of the seller's area pay no tax (reverse charge),
+// everyone else pays the rate of their billing country
+func Calculate(amount int64, settings Settings, seller, buyer Jurisdiction, buyerVATID string) (Breakdown, error) {
+	breakdown := Breakdown{
+		Country:   buyer.Country,
+		Net:       amount,
+		Gross:     amount,
+		Inclusive: settings.PricesIncludeTax,
+	}
+
+	if buyerVATID != "" && !ValidVATID(buyerVATID, buyer) {
+		return Breakdown{}, ErrInvalidVATID
+	}
+
+	if !settings.ChargesTax || amount <= 0 {
+		return breakdown, nil
+	}
+
+	reverseCharge := buyerVATID != "" &&
+		seller.VATArea != "" &&
+		seller.VATArea == buyer.VATArea &&
+		seller.Country != buyer.Country
+	if reverseCharge {
+		// inclusive prices are charged net, the buyer accounts for the tax
+		breakdown.ReverseCharge = true
+		breakdown.Net, _ = Split(amount, buyer.RateBP, settings.PricesIncludeTax)
+		breakdown.Gross = breakdown.Net
+		return breakdown, nil
+	}
+
+	breakdown.RateBP = buyer.RateBP
+	breakdown.Net, breakdown.Tax = Split(amount, buyer.RateBP, settings.PricesIncludeTax)
+	breakdown.Gross = breakdown.Net + breakdown.Tax
+	return breakdown, nil
+}
+
+// net and tax of an amount, rounded half up to the minor unit
+// inclusive amounts already contain the tax, exclusive amounts are net
+func Split(amount int64, rateBP uint32, inclusive bool) (int64, int64) {
+	rate := int64(rateBP)
+	if inclusive {
+		net := (amount*10000 + (10000+rate)/2) / (10000 + rate)
+		return net, amount - net
+	}
+	return amount, (amount*rate + 5000) / 10000
+}
+
+// share of tax belonging to part of a gross amount, used for partial refunds
+// previous is what was already refunded, so the shares of successive parts add up to the full tax
+func Prorate(previous, part, gross, tax int64) int64 {
+	return taxShare(previous+part, gross, tax) - taxShare(previous, gross, tax)
+}
+
+// tax on the first amount of a gross amount, rounded half up
+func taxShare(amount, gross, tax int64) int64 {
+	if gross <= 0 || amount >= gross {
+		return tax
+	}
+	return (amount*tax + gross/2) / gross
+}
@@ -0,0 +1,143 @@
+package tax
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		amount    int64
+		rateBP    uint32
+		inclusive bool
+		net, tax  int64
+	}{
+		// exclusive amounts are net
+		{10000, 1900, false, 10000, 1900},
+		{1, 1900, false, 1, 0},
+		{3, 1900, false, 3, 1},   // 0.57 rounds up
+		{25, 1000, false, 25, 3}, // 2.5 rounds half up
+		{10000, 0, false, 10000, 0},
+
+		// inclusive amounts contain the tax
+		{11900, 1900, true, 10000, 1900},
+		{100, 2000, true, 83, 17},
+		{1, 1900, true, 1, 0},
+		{10000, 0, true, 10000, 0},
+	}
+
+	for _, tt := range tests {
+		net, tax := Split(tt.amount, tt.rateBP, tt.inclusive)
+		if net != tt.net || tax != tt.tax {
+			t.Errorf("Split(%d, %d, %t) = %d, %d, want %d, %d", tt.amount, tt.rateBP, tt.inclusive, net, tax, tt.net, tt.tax)
+		}
+		if tt.inclusive && net+tax != tt.amount {
+			t.Errorf("Split(%d, %d, inclusive) does not add up: %d + %d", tt.amount, tt.rateBP, net, tax)
+		}
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	germany := Jurisdiction{Country: "DE", VATArea: "EU", VATIDPattern: `^DE[0-9]{9}$`, RateBP: 1900}
+	france := Jurisdiction{Country: "FR", VATArea: "EU", VATIDPattern: `^FR[0-9A-Z]{2}[0-9]{9}$`, RateBP: 2000}
+	swiss := Jurisdiction{Country: "CH", RateBP: 810}
+
+	exclusive := Settings{Country: "DE", ChargesTax: true}
+	inclusive := Settings{Country: "DE", ChargesTax: true, PricesIncludeTax: true}
+
+	tests := []struct {
+		name     string
+		amount   int64
+		settings Settings
+		buyer    Jurisdiction
+		vatID    string
+		want     Breakdown
+		err      error
+	}{
+		{
+			name: "exclusive domestic", amount: 10000, settings: exclusive, buyer: germany,
+			want: Breakdown{Country: "DE", RateBP: 1900, Net: 10000, Tax: 1900, Gross: 11900},
+		},
+		{
+			name: "inclusive domestic", amount: 11900, settings: inclusive, buyer: germany,
+			want: Breakdown{Country: "DE", RateBP: 1900, Net: 10000, Tax: 1900, Gross: 11900, Inclusive: true},
+		},
+		{
+			name: "exclusive buyer country rate", amount: 10000, settings: exclusive, buyer: france,
+			want: Breakdown{Country: "FR", RateBP: 2000, Net: 10000, Tax: 2000, Gross: 12000},
+		},
+		{
+			name: "exclusive reverse charge", amount: 10000, settings: exclusive, buyer: france, vatID: "FRXX123456789",
+			want: Breakdown{Country: "FR", Net: 10000, Gross: 10000, ReverseCharge: true},
+		},
+		{
+			name: "inclusive reverse charge is charged net", amount: 12000, settings: inclusive, buyer: france, vatID: "FRXX123456789",
+			want: Breakdown{Country: "FR", Net: 10000, Gross: 10000, Inclusive: true, ReverseCharge: true},
+		},
+		{
+			name: "domestic business pays tax", amount: 10000, settings: exclusive, buyer: germany, vatID: "DE123456789",
+			want: Breakdown{Country: "DE", RateBP: 1900, Net: 10000, Tax: 1900, Gross: 11900},
+		},
+		{
+			name: "business outside the area pays tax", amount: 10000, settings: exclusive, buyer: swiss, vatID: "CHE123",
+			want: Breakdown{Country: "CH", RateBP: 810, Net: 10000, Tax: 810, Gross: 10810},
+		},
+		{
+			name: "organizer not charging tax", amount: 10000, settings: Settings{Country: "DE", PricesIncludeTax: true}, buyer: germany,
+			want: Breakdown{Country: "DE", Net: 10000, Gross: 10000, Inclusive: true},
+		},
+		{
+			name: "free order", amount: 0, settings: exclusive, buyer: germany,
+			want: Breakdown{Country: "DE"},
+		},
+		{
+			name: "invalid tax id", amount: 10000, settings: exclusive, buyer: france, vatID: "DE123456789",
+			err: ErrInvalidVATID,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Calculate(tt.amount, tt.settings, germany, tt.buyer, tt.vatID)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: Calculate error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Calculate = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProrate(t *testing.T) {
+	tests := []struct {
+		name       string
+		gross, tax int64
+		parts      []int64
+		shares     []int64
+	}{
+		{"full refund", 11900, 1900, []int64{11900}, []int64{1900}},
+		{"half refund", 11900, 1900, []int64{5950}, []int64{950}},
+		{"thirds", 300, 100, []int64{100, 100, 100}, []int64{33, 34, 33}},
+		{"uneven parts", 10001, 1597, []int64{3333, 3333, 3335}, []int64{532, 532, 533}},
+		{"many small parts", 1000, 7, []int64{100, 100, 100, 100, 100, 100, 100, 100, 100, 100}, []int64{1, 0, 1, 1, 1, 0, 1, 1, 0, 1}},
+		{"refund past gross", 1000, 190, []int64{600, 600}, []int64{114, 76}},
+		{"no tax", 1000, 0, []int64{400, 600}, []int64{0, 0}},
+	}
+
+	for _, tt := range tests {
+		var previous, sum int64
+		for i, part := range tt.parts {
+			share := Prorate(previous, part, tt.gross, tt.tax)
+			if share != tt.shares[i] {
+				t.Errorf("%s: share of part %d = %d, want %d", tt.name, i, share, tt.shares[i])
+			}
+			previous += part
+			sum += share
+		}
+
+		// refunding the whole gross returns exactly the tax charged
+		if previous >= tt.gross && sum != tt.tax {
+			t.Errorf("%s: shares sum to %d, want the full tax %d", tt.name, sum, tt.tax)
+		}
+	}
+}
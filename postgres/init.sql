@@ -3,10 +3,132 @@ create table if not exists users(
     id serial primary key,
     first_name text not null,
     last_name text not null,
-    email text not null unique,
+    email text not null,
     password_hash text not null,
-    role text not null check (role in ('customer', 'organizer')),
-    created_at timestamptz not null default now()
+    role text not null check (role in ('customer', 'organizer', 'admin')),
+    preferred_currency text check (preferred_currency ~ '^[A-Z]{3}$'), -- indicative prices are shown in it
+    created_at timestamptz not null default now(),
+    deleted_at timestamptz
+);
+
+-- emails are unique among live accounts only, so soft deleted users can be restored
+create unique index if not exists users_email_live_idx on users (email) where deleted_at is null;
+
+-- Tax Country Table (finance maintained, vat_id_pattern includes the country prefix)
+create table if not exists tax_countries (
+    code text primary key check (code ~ '^[A-Z]{2}$'),
+    name text not null,
+    vat_area text not null default '',
+    vat_id_pattern text not null default ''
+);
+
+-- Tax Rate Table (finance maintained, basis points: 1900 = 19%)
+create table if not exists tax_rates (
+    id serial primary key,
+    country text not null references tax_countries(code) on delete cascade,
+    category text not null default 'standard',
+    rate_bp int not null check (rate_bp between 0 and 10000),
+    valid_from date not null,
+    valid_until date,
+    unique (country, category, valid_from),
+    check (valid_until is null or valid_until > valid_from)
+);
+
+insert into tax_countries (code, name, vat_area, vat_id_pattern) values
+    ('AT', 'Austria', 'EU', '^ATU[0-9]{8}$'),
+    ('BE', 'Belgium', 'EU', '^BE[01][0-9]{9}$'),
+    ('BG', 'Bulgaria', 'EU', '^BG[0-9]{9,10}$'),
+    ('CY', 'Cyprus', 'EU', '^CY[0-9]{8}[A-Z]$'),
+    ('CZ', 'Czechia', 'EU', '^CZ[0-9]{8,10}$'),
+    ('DE', 'Germany', 'EU', '^DE[0-9]{9}$'),
+    ('DK', 'Denmark', 'EU', '^DK[0-9]{8}$'),
+    ('EE', 'Estonia', 'EU', '^EE[0-9]{9}$'),
+    ('ES', 'Spain', 'EU', '^ES[0-9A-Z][0-9]{7}[0-9A-Z]$'),
+    ('FI', 'Finland', 'EU', '^FI[0-9]{8}$'),
+    ('FR', 'France', 'EU', '^FR[0-9A-Z]{2}[0-9]{9}$'),
+    ('GR', 'Greece', 'EU', '^EL[0-9]{9}$'),
+    ('HR', 'Croatia', 'EU', '^HR[0-9]{11}$'),
+    ('HU', 'Hungary', 'EU', '^HU[0-9]{8}$'),
+    ('IE', 'Ireland', 'EU', '^IE[0-9][0-9A-Z+*][0-9]{5}[A-Z]{1,2}$'),
+    ('IT', 'Italy', 'EU', '^IT[0-9]{11}$'),
+    ('LT', 'Lithuania', 'EU', '^LT([0-9]{9}|[0-9]{12})$'),
+    ('LU', 'Luxembourg', 'EU', '^LU[0-9]{8}$'),
+    ('LV', 'Latvia', 'EU', '^LV[0-9]{11}$'),
+    ('MT', 'Malta', 'EU', '^MT[0-9]{8}$'),
+    ('NL', 'Netherlands', 'EU', '^NL[0-9]{9}B[0-9]{2}$'),
+    ('PL', 'Poland', 'EU', '^PL[0-9]{10}$'),
+    ('PT', 'Portugal', 'EU', '^PT[0-9]{9}$'),
+    ('RO', 'Romania', 'EU', '^RO[0-9]{2,10}$'),
+    ('SE', 'Sweden', 'EU', '^SE[0-9]{12}$'),
+    ('SI', 'Slovenia', 'EU', '^SI[0-9]{8}$'),
+    ('SK', 'Slovakia', 'EU', '^SK[0-9]{10}$'),
+    ('GB', 'United Kingdom', '', '^GB([0-9]{9}|[0-9]{12}|GD[0-9]{3}|HA[0-9]{3})$'),
+    ('CH', 'Switzerland', '', '^CHE[0-9]{9}(MWST|TVA|IVA)?$'),
+    ('NO', 'Norway', '', '^NO[0-9]{9}(MVA)?$'),
+    ('US', 'United States', '', ''),
+    ('IN', 'India', '', '^[0-9]{2}[A-Z]{5}[0-9]{4}[A-Z][0-9A-Z]Z[0-9A-Z]$')
+on conflict (code) do nothing;
+
+insert into tax_rates (country, category, rate_bp, valid_from, valid_until) values
+    ('AT', 'standard', 2000, '2016-01-01', null),
+    ('BE', 'standard', 2100, '2016-01-01', null),
+    ('BG', 'standard', 2000, '2016-01-01', null),
+    ('CY', 'standard', 1900, '2016-01-01', null),
+    ('CZ', 'standard', 2100, '2016-01-01', null),
+    ('DE', 'standard', 1900, '2021-01-01', null),
+    ('DK', 'standard', 2500, '2016-01-01', null),
+    ('EE', 'standard', 2200, '2024-01-01', '2025-07-01'),
+    ('EE', 'standard', 2400, '2025-07-01', null),
+    ('ES', 'standard', 2100, '2016-01-01', null),
+    ('FI', 'standard', 2550, '2024-09-01', null),
+    ('FR', 'standard', 2000, '2016-01-01', null),
+    ('GR', 'standard', 2400, '2016-06-01', null),
+    ('HR', 'standard', 2500, '2016-01-01', null),
+    ('HU', 'standard', 2700, '2016-01-01', null),
+    ('IE', 'standard', 2300, '2021-03-01', null),
+    ('IT', 'standard', 2200, '2016-01-01', null),
+    ('LT', 'standard', 2100, '2016-01-01', null),
+    ('LU', 'standard', 1700, '2024-01-01', null),
+    ('LV', 'standard', 2100, '2016-01-01', null),
+    ('MT', 'standard', 1800, '2016-01-01', null),
+    ('NL', 'standard', 2100, '2016-01-01', null),
+    ('PL', 'standard', 2300, '2016-01-01', null),
+    ('PT', 'standard', 2300, '2016-01-01', null),
+    ('RO', 'standard', 1900, '2017-01-01', '2025-08-01'),
+    ('RO', 'standard', 2100, '2025-08-01', null),
+    ('SE', 'standard', 2500, '2016-01-01', null),
+    ('SI', 'standard', 2200, '2016-01-01', null),
+    ('SK', 'standard', 2300, '2025-01-01', null),
+    ('GB', 'standard', 2000, '2011-01-04', null),
+    ('CH', 'standard', 810, '2024-01-01', null),
+    ('NO', 'standard', 2500, '2016-01-01', null),
+    ('IN', 'standard', 1800, '2017-07-01', null)
+on conflict (country, category, valid_from) do nothing;
+
+-- Exchange Rate Table (one unit of base is worth rate units of quote, loaded from a file or by an admin)
+create table if not exists exchange_rates (
+    base text not null check (base ~ '^[A-Z]{3}$'),
+    quote text not null check (quote ~ '^[A-Z]{3}$'),
+    rate numeric(20, 10) not null check (rate > 0),
+    source text not null default '',
+    updated_at timestamptz not null default now(),
+    primary key (base, quote),
+    check (base <> quote)
+);
+
+-- Organizer Billing Profile Table (seller details printed on invoices)
+create table if not exists organizer_profiles (
+    organizer_id int primary key references users(id) on delete cascade,
+    legal_name text not null,
+    address text not null default '',
+    tax_id text not null default '',
+    invoice_prefix text not null default 'INV' check (invoice_prefix ~ '^[A-Z0-9]{1,10}$'),
+    tax_country text references tax_countries(code),
+    charges_tax boolean not null default false,
+    prices_include_tax boolean not null default false,
+    tax_category text not null default 'standard',
+    updated_at timestamptz not null default now(),
+    check (not charges_tax or tax_country is not null)
 );
 
 -- Conference Table
@@ -16,10 +138,201 @@ create table if not exists conferences(
     description text,
     location text not null,
     event_time timestamptz not null,
-    total_tickets int not null check(total_tickets > 0),
-    available_tickets int not null check(available_tickets >= 0),
     organizer_id int not null references users(id) on delete cascade,
     status text not null default 'ongoing' check (status in ('ongoing', 'completed', 'cancelled')),
+    currency text not null default 'USD' check (currency ~ '^[A-Z]{3}$'), -- every ticket type is priced in it
+    transfers_enabled boolean not null default true,
+    transfer_cutoff_hours int not null default 0 check (transfer_cutoff_hours >= 0), -- transfers close this many hours before the event
+    max_tickets_per_order int check (max_tickets_per_order > 0), -- larger orders go through a group booking request
+    max_tickets_per_user int check (max_tickets_per_user > 0), -- held and booked tickets of one account
+    created_at timestamptz not null default now(),
+    deleted_at timestamptz
+);
+
+-- Ticket Type Table (conference availability is the sum of its types)
+create table if not exists ticket_types (
+    id serial primary key,
+    conference_id int not null references conferences(id) on delete cascade,
+    name text not null,
+    price bigint not null default 0 check (price >= 0), -- minor units, e.g. cents
+    currency text not null default 'USD' check (currency ~ '^[A-Z]{3}$'),
+    quota int not null check (quota > 0),
+    available int not null check (available >= 0 and available <= quota),
+    sales_start timestamptz,
+    sales_end timestamptz,
+    min_per_order int not null default 1 check (min_per_order > 0),
+    max_per_order int check (max_per_order >= min_per_order),
+    hidden boolean not null default false, -- only bookable with a promo code that unlocks it
+    created_at timestamptz not null default now(),
+    unique (conference_id, name),
+    check (sales_end is null or sales_start is null or sales_end > sales_start)
+);
+
+-- Price Tier Table (first matching tier by position wins, otherwise the ticket type price applies)
+create table if not exists price_tiers (
+    id serial primary key,
+    ticket_type_id int not null references ticket_types(id) on delete cascade,
+    name text not null,
+    price bigint not null check (price >= 0),
+    starts_at timestamptz,
+    ends_at timestamptz,
+    max_sold int check (max_sold > 0), -- tier applies while fewer tickets than this are sold
+    position int not null default 0,
+    created_at timestamptz not null default now(),
+    check (ends_at is null or starts_at is null or ends_at > starts_at)
+);
+
+-- Registration Question Table (asked of every attendee, without a ticket type of all types of the conference)
+create table if not exists registration_questions (
+    id serial primary key,
+    conference_id int not null references conferences(id) on delete cascade,
+    ticket_type_id int references ticket_types(id) on delete cascade,
+    label text not null,
+    kind text not null check (kind in ('text', 'choice', 'multi_choice', 'boolean', 'number')),
+    options jsonb not null default '[]', -- choices of choice and multi_choice questions
+    required boolean not null default false,
+    show_if_question_id int references registration_questions(id) on delete cascade,
+    show_if_answer text, -- only asked when that question was answered with this value
+    position int not null default 0,
+    created_at timestamptz not null default now(),
+    check ((show_if_question_id is null) = (show_if_answer is null))
+);
+
+create index if not exists registration_questions_conference_idx on registration_questions (conference_id);
+
+-- Promo Code Table (percent amounts are whole percents, fixed amounts are minor units per order)
+create table if not exists promo_codes (
+    id serial primary key,
+    conference_id int not null references conferences(id) on delete cascade,
+    code text not null check (code = upper(code)),
+    discount_type text not null check (discount_type in ('percent', 'fixed')),
+    amount bigint not null check (amount > 0),
+    max_uses int check (max_uses > 0),
+    per_user_limit int check (per_user_limit > 0),
+    uses int not null default 0,
+    valid_from timestamptz,
+    valid_until timestamptz,
+    created_at timestamptz not null default now(),
+    unique (conference_id, code),
+    check (discount_type <> 'percent' or amount <= 100),
+    check (max_uses is null or uses <= max_uses)
+);
+
+-- ticket types a promo code is restricted to, no rows means every visible type
+create table if not exists promo_code_ticket_types (
+    promo_code_id int not null references promo_codes(id) on delete cascade,
+    ticket_type_id int not null references ticket_types(id) on delete cascade,
+    primary key (promo_code_id, ticket_type_id)
+);
+
+-- Refund Policy Table (rule with the largest hours_before still ahead of the event applies)
+create table if not exists refund_policy_rules (
+    id serial primary key,
+    conference_id int not null references conferences(id) on delete cascade,
+    hours_before int not null check (hours_before >= 0),
+    refund_percent int not null check (refund_percent between 0 and 100),
+    unique (conference_id, hours_before)
+);
+
+-- Hold Table (tickets taken out of availability during checkout, confirmed into a booking or released)
+create table if not exists holds (
+    id uuid primary key default gen_random_uuid(),
+    user_id int not null references users(id) on delete cascade,
+    conference_id int not null references conferences(id) on delete cascade,
+    ticket_type_id int not null references ticket_types(id) on delete cascade,
+    quantity int not null check (quantity > 0),
+    promo_code text not null default '',
+    status text not null default 'active' check (status in ('active', 'confirmed', 'released', 'expired')),
+    expires_at timestamptz not null,
+    created_at timestamptz not null default now()
+);
+
+create index if not exists holds_active_expiry_idx on holds (expires_at) where status = 'active';
+
+-- Group Booking Request Table (large orders approved by the organizer, approval holds the tickets for the group leader)
+create table if not exists group_booking_requests (
+    id serial primary key,
+    user_id int not null references users(id) on delete cascade,
+    conference_id int not null references conferences(id) on delete cascade,
+    ticket_type_id int not null references ticket_types(id) on delete cascade,
+    quantity int not null check (quantity > 0),
+    note text not null default '',
+    status text not null default 'pending' check (status in ('pending', 'approved', 'declined', 'cancelled', 'booked')),
+    decision_note text not null default '',
+    created_at timestamptz not null default now(),
+    decided_at timestamptz
+);
+
+create index if not exists group_booking_requests_conference_idx on group_booking_requests (conference_id, created_at);
+
+-- approved group booking, not bound by the order limits
+alter table holds add column if not exists group_request_id int references group_booking_requests(id) on delete set null;
+
+-- availability counting tickets of expired but not yet released holds as free
+create or replace view ticket_availability as
+select t.id as ticket_type_id,
+    t.available + coalesce(sum(h.quantity) filter (where h.expires_at <= now()), 0)::int as available,
+    coalesce(sum(h.quantity) filter (where h.expires_at > now()), 0)::int as held
+from ticket_types t
+left join holds h on h.ticket_type_id = t.id and h.status = 'active'
+group by t.id;
+
+-- Waitlist Entry Table (customers offered a hold in FIFO order when tickets free up)
+create table if not exists waitlist_entries (
+    id serial primary key,
+    user_id int not null references users(id) on delete cascade,
+    conference_id int not null references conferences(id) on delete cascade,
+    ticket_type_id int references ticket_types(id) on delete cascade, -- null takes any visible type
+    quantity int not null check (quantity > 0),
+    status text not null default 'waiting' check (status in ('waiting', 'offered', 'claimed', 'expired', 'left', 'closed')),
+    hold_id uuid references holds(id) on delete set null, -- the offer, claimed by confirming it into a booking
+    offered_at timestamptz,
+    offer_expires_at timestamptz,
+    created_at timestamptz not null default now()
+);
+
+create unique index if not exists waitlist_entries_open_idx
+    on waitlist_entries (user_id, conference_id, coalesce(ticket_type_id, 0))
+    where status in ('waiting', 'offered');
+create index if not exists waitlist_entries_waiting_idx on waitlist_entries (created_at, id) where status = 'waiting';
+
+-- tickets kept off general sale for waiting entries the next waitlist run can offer them to
+-- only entries that fit what is free count, one for any type against the first visible type it fits, as offers are made
+create or replace view waitlist_reservations as
+select a.ticket_type_id,
+    least(a.available, sum(w.quantity))::int as reserved
+from ticket_availability a
+join ticket_types t on t.id = a.ticket_type_id
+join waitlist_entries w on w.conference_id = t.conference_id and w.status = 'waiting'
+    and w.quantity <= a.available
+    and (w.ticket_type_id = t.id or (w.ticket_type_id is null and t.id = (
+        select o.id from ticket_types o
+        join ticket_availability oa on oa.ticket_type_id = o.id
+        where o.conference_id = w.conference_id and not o.hidden and oa.available >= w.quantity
+        order by o.id
+        limit 1
+    )))
+group by a.ticket_type_id, a.available;
+
+-- Cart Item Table (one open cart per user, reserved only at checkout)
+create table if not exists cart_items (
+    id serial primary key,
+    user_id int not null references users(id) on delete cascade,
+    conference_id int not null references conferences(id) on delete cascade,
+    ticket_type_id int not null references ticket_types(id) on delete cascade,
+    quantity int not null check (quantity > 0),
+    promo_code text not null default '',
+    added_at timestamptz not null default now(),
+    unique (user_id, ticket_type_id)
+);
+
+-- Order Table (bookings made in one checkout, paid with one payment)
+create table if not exists orders (
+    id serial primary key,
+    user_id int not null references users(id) on delete cascade,
+    status text not null default 'pending_payment' check (status in ('pending_payment', 'paid', 'failed')),
+    total bigint not null default 0, -- minor units, sum of the booking totals
+    currency text not null,
     created_at timestamptz not null default now()
 );
 
@@ -28,15 +341,241 @@ create table if not exists bookings (
     id serial primary key,
     user_id int not null references users(id) on delete cascade,
     conference_id int not null references conferences(id) on delete cascade,
+    ticket_type_id int not null references ticket_types(id) on delete cascade,
     tickets_booked int not null check(tickets_booked > 0),
-    status text not null default 'completed' check (status in ('completed', 'failed', 'cancelled')),
-    booked_at timestamptz not null default now()
+    unit_price bigint not null default 0, -- price of the first ticket, minor units
+    total_price bigint not null default 0, -- amount charged, minor units
+    currency text not null default 'USD',
+    price_tier_id int references price_tiers(id) on delete set null,
+    promo_code_id int references promo_codes(id) on delete set null,
+    discount bigint not null default 0, -- minor units, already subtracted from total_price
+    status text not null default 'pending_payment' check (status in ('pending_payment', 'paid', 'failed', 'refunded', 'cancelled')),
+    refund_due bigint not null default 0, -- minor units owed under the cancellation policy
+    refunded_amount bigint not null default 0, -- minor units returned to the customer
+    cancelled_at timestamptz,
+    billing_name text not null default '',
+    billing_address text not null default '',
+    billing_tax_id text not null default '',
+    billing_country text not null default '',
+    subtotal bigint not null default 0, -- ticket prices after discount, before tax is added or taken out
+    net_amount bigint not null default 0, -- total_price before tax, minor units
+    tax_amount bigint not null default 0, -- minor units, included in total_price
+    tax_rate_bp int not null default 0,
+    tax_country text not null default '',
+    tax_inclusive boolean not null default false,
+    reverse_charge boolean not null default false,
+    display_currency text, -- buyer's preferred currency at booking time
+    exchange_rate numeric(20, 10), -- one unit of currency in display_currency, snapshot for reporting
+    exchange_rate_at timestamptz, -- when the snapshot rate was published
+    converted_total bigint, -- total_price in display_currency minor units, indicative only
+    hold_id uuid unique references holds(id) on delete set null,
+    order_id int references orders(id) on delete set null,
+    attendees jsonb not null default '[]', -- names given when booking, assigned to tickets as they are issued
+    booked_at timestamptz not null default now(),
+    deleted_at timestamptz
 );
 
+create index if not exists bookings_order_id_idx on bookings (order_id) where order_id is not null;
+
 -- Ticket Table
 create table if not exists tickets (
     id serial primary key,
     booking_id int not null REFERENCES bookings(id) on delete CASCADE,
     ticket_code text NOT NULL UNIQUE,
-    issued_at TIMESTAMPTZ NOT NULL DEFAULT now()
-);
\ No newline at end of file
+    status text not null default 'active' check (status in ('active', 'void')),
+    attendee_name text,
+    attendee_email text,
+    assigned_at timestamptz,
+    answers jsonb not null default '{}', -- registration answers keyed by question id
+    holder_id int references users(id) on delete set null, -- set when received by transfer, otherwise the buyer holds it
+    transferred_from int references tickets(id), -- the voided ticket this one replaced
+    access_token text not null unique default replace(gen_random_uuid()::text, '-', ''), -- lets the attendee view the ticket without an account
+    issued_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    voided_at timestamptz
+);
+
+-- Ticket Transfer Table (the old ticket is voided and a new one issued to the recipient on accept)
+create table if not exists ticket_transfers (
+    id serial primary key,
+    ticket_id int not null references tickets(id) on delete cascade,
+    from_user_id int references users(id) on delete set null,
+    to_email text not null,
+    to_user_id int references users(id) on delete set null, -- set on accept
+    new_ticket_id int references tickets(id) on delete set null,
+    status text not null default 'pending' check (status in ('pending', 'accepted', 'declined', 'cancelled', 'expired')),
+    created_at timestamptz not null default now(),
+    resolved_at timestamptz
+);
+
+create unique index if not exists ticket_transfers_pending_idx on ticket_transfers (ticket_id) where status = 'pending';
+create index if not exists ticket_transfers_to_email_idx on ticket_transfers (to_email) where status = 'pending';
+
+-- Conference Status Transition Table
+create table if not exists conference_transitions (
+    id serial primary key,
+    conference_id int not null references conferences(id) on delete cascade,
+    from_status text not null,
+    to_status text not null,
+    changed_by int references users(id) on delete set null,
+    reason text not null default '',
+    created_at timestamptz not null default now()
+);
+
+-- Scheduled Job Run Table
+create table if not exists job_runs (
+    id bigserial primary key,
+    job_name text not null,
+    instance text not null,
+    started_at timestamptz not null,
+    finished_at timestamptz not null,
+    error text
+);
+
+create index if not exists job_runs_job_name_started_at_idx on job_runs (job_name, started_at desc);
+
+-- Notification Outbox Table
+create table if not exists notifications (
+    id bigserial primary key,
+    user_id int references users(id) on delete set null,
+    email text not null,
+    subject text not null,
+    body text not null,
+    status text not null default 'queued' check (status in ('queued', 'sent', 'failed')),
+    attempts int not null default 0,
+    last_error text,
+    created_at timestamptz not null default now(),
+    sent_at timestamptz
+);
+
+create index if not exists notifications_queued_idx on notifications (created_at) where status = 'queued';
+
+-- Conference Media Table (variants hold blob keys and sizes of each rendition)
+create table if not exists conference_media (
+    id serial primary key,
+    conference_id int not null references conferences(id) on delete cascade,
+    kind text not null check (kind in ('cover', 'speaker', 'venue')),
+    caption text not null default '',
+    content_type text not null,
+    variants jsonb not null,
+    uploaded_by int references users(id) on delete set null,
+    created_at timestamptz not null default now()
+);
+
+create index if not exists conference_media_conference_id_idx on conference_media (conference_id);
+
+-- Promo Code Redemption Table
+create table if not exists promo_redemptions (
+    id serial primary key,
+    promo_code_id int not null references promo_codes(id) on delete cascade,
+    booking_id int not null unique references bookings(id) on delete cascade,
+    user_id int not null references users(id) on delete cascade,
+    discount bigint not null,
+    created_at timestamptz not null default now()
+);
+
+create index if not exists promo_redemptions_code_user_idx on promo_redemptions (promo_code_id, user_id);
+
+-- Payment Table (one row per provider intent, a booking may retry with a new intent)
+create table if not exists payments (
+    id serial primary key,
+    booking_id int references bookings(id) on delete cascade,
+    order_id int references orders(id) on delete cascade, -- set instead of booking_id for a checkout
+    provider text not null,
+    intent_id text not null unique,
+    amount bigint not null check (amount > 0), -- minor units
+    currency text not null,
+    status text not null default 'requires_confirmation' check (status in ('requires_confirmation', 'succeeded', 'failed')),
+    failure_reason text,
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    check ((booking_id is null) <> (order_id is null))
+);
+
+create index if not exists payments_booking_id_idx on payments (booking_id);
+create index if not exists payments_order_id_idx on payments (order_id);
+
+-- Refund Queue Table (submitted to the provider by a background job)
+create table if not exists refunds (
+    id serial primary key,
+    booking_id int not null references bookings(id) on delete cascade,
+    payment_id int not null references payments(id) on delete cascade,
+    amount bigint not null check (amount > 0), -- minor units
+    reason text not null default '',
+    status text not null default 'queued' check (status in ('queued', 'pending', 'succeeded', 'failed')),
+    provider_refund_id text unique,
+    attempts int not null default 0,
+    last_error text,
+    created_at timestamptz not null default now(),
+    settled_at timestamptz
+);
+
+create index if not exists refunds_queued_idx on refunds (created_at) where status = 'queued';
+
+-- Invoice Number Sequence Table (row lock keeps numbering gap-free per organizer and kind)
+create table if not exists invoice_sequences (
+    organizer_id int not null references users(id) on delete cascade,
+    kind text not null check (kind in ('invoice', 'credit_note')),
+    last_number bigint not null,
+    primary key (organizer_id, kind)
+);
+
+-- Invoice and Credit Note Table (issued documents are immutable)
+create table if not exists invoices (
+    id serial primary key,
+    booking_id int references bookings(id) on delete set null,
+    organizer_id int references users(id) on delete set null,
+    kind text not null check (kind in ('invoice', 'credit_note')),
+    sequence bigint not null,
+    number text not null,
+    related_invoice_id int references invoices(id),
+    currency text not null,
+    subtotal bigint not null,
+    tax bigint not null,
+    total bigint not null,
+    document jsonb not null,
+    pdf bytea not null,
+    issued_at timestamptz not null default now(),
+    unique (organizer_id, kind, sequence)
+);
+
+create unique index if not exists invoices_booking_invoice_idx on invoices (booking_id) where kind = 'invoice';
+
+create or replace function invoices_immutable() returns trigger as $$
+begin
+    if tg_op = 'DELETE' then
+        raise exception 'issued invoices cannot be deleted';
+    end if;
+    -- only links to purged bookings and organizers may be cleared
+    if (new.kind, new.sequence, new.number, new.related_invoice_id, new.currency, new.subtotal,
+        new.tax, new.total, new.document, new.pdf, new.issued_at)
+        is distinct from
+       (old.kind, old.sequence, old.number, old.related_invoice_id, old.currency, old.subtotal,
+        old.tax, old.total, old.document, old.pdf, old.issued_at) then
+        raise exception 'issued invoices cannot be changed';
+    end if;
+    return new;
+end;
+$$ language plpgsql;
+
+create or replace trigger invoices_immutable
+    before update or delete on invoices
+    for each row execute function invoices_immutable();
+
+-- Idempotency Key Table (stored responses of mutating requests, replayed on retry)
+create table if not exists idempotency_keys (
+    id serial primary key,
+    user_id int not null default 0, -- 0 for unauthenticated requests
+    key text not null,
+    method text not null,
+    path text not null, -- request uri, query string included
+    fingerprint text not null, -- sha256 of method, request uri and body
+    status text not null default 'processing' check (status in ('processing', 'completed')),
+    status_code int,
+    content_type text,
+    body bytea,
+    locked_at timestamptz not null default now(), -- a processing key older than the lease is abandoned
+    created_at timestamptz not null default now(),
+    unique (user_id, key)
+);
+
+create index if not exists idempotency_keys_created_at_idx on idempotency_keys (created_at);